@@ -3,18 +3,27 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/minimax-agent/telegram-bot/internal/handler"
 	"github.com/minimax-agent/telegram-bot/internal/minimax"
+	"github.com/minimax-agent/telegram-bot/internal/profile"
+	"github.com/minimax-agent/telegram-bot/internal/server"
 	"github.com/minimax-agent/telegram-bot/internal/telegram"
+	"github.com/minimax-agent/telegram-bot/internal/wizard"
 	"github.com/minimax-agent/telegram-bot/pkg/config"
 	"github.com/minimax-agent/telegram-bot/pkg/logger"
+	"github.com/minimax-agent/telegram-bot/pkg/metrics"
 )
 
 const (
@@ -26,8 +35,26 @@ func main() {
 	// Load .env file if it exists (doesn't error if missing)
 	godotenv.Load()
 
-	// Load configuration
-	cfg := config.LoadFromEnv()
+	// Load configuration from the config file, environment and flags
+	cfg, cli, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if cfg != nil && len(cli.Args) > 0 {
+		os.Exit(runCommand(cfg, cli, err))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		os.Exit(2)
+	}
+
+	if cli.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to print configuration: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
@@ -36,12 +63,20 @@ func main() {
 	}
 
 	// Setup logger
-	log := logger.New(
-		logger.WithPrefix("bot"),
-		logger.WithLevel(logger.InfoLevel),
-	)
+	log, logFile, err := newLogger(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up logging: %v\n", err)
+		os.Exit(1)
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
+	slog.SetDefault(log.Slog())
 
 	log.Info("Starting %s v%s", appName, appVersion)
+	for _, p := range cfg.Check().Warnings() {
+		log.Warn("Configuration %s: %s", p.Key, p.Message)
+	}
 
 	// Create context with cancellation
 	ctx, cancel := context.WithCancel(context.Background())
@@ -49,8 +84,10 @@ func main() {
 
 	// Create Telegram client
 	telegramClient, err := telegram.NewClient(
-		cfg.TelegramBotToken,
-		telegram.WithLogger(log),
+		cfg.TelegramBotToken.Value(),
+		telegram.WithLogger(log.Named("telegram")),
+		// API calls are logged at debug level, subject to the log levels
+		telegram.WithDebug(true),
 	)
 	if err != nil {
 		log.Fatal("Failed to create Telegram client: %v", err)
@@ -65,19 +102,139 @@ func main() {
 
 	// Create Minimax client
 	minimaxClient, err := minimax.NewClient(
-		cfg.MinimaxAPIKey,
+		cfg.MinimaxAPIKey.Value(),
 		minimax.WithBaseURL(cfg.MinimaxBaseURL),
 		minimax.WithModel(cfg.MinimaxModel),
 		minimax.WithTimeout(cfg.MinimaxTimeout),
-		minimax.WithLogger(log),
+		minimax.WithLogger(log.Named("minimax")),
+		minimax.WithDebug(true),
 	)
 	if err != nil {
 		log.Fatal("Failed to create Minimax client: %v", err)
 	}
 	log.Info("Minimax client initialized with model: %s", cfg.MinimaxModel)
 
+	// Load prompt templates, failing fast if an override is invalid
+	prompts, err := wizard.NewPrompts(cfg.PromptsDir, wizard.WithPromptsLogger(log.Named("prompts")))
+	if err != nil {
+		log.Fatal("Failed to load prompt templates: %v", err)
+	}
+	if cfg.PromptsDir != "" {
+		log.Info("Loaded prompt templates from %s", cfg.PromptsDir)
+	}
+
+	// Create wizard manager, restoring sessions saved before the last shutdown
+	wizardOpts := []wizard.ManagerOption{
+		wizard.WithReminder(cfg.WizardReminder),
+		wizard.WithPrompts(prompts),
+		wizard.WithLogger(log.Named("wizard")),
+	}
+	if cfg.DataDir != "" {
+		store, err := wizard.NewFileStore(filepath.Join(cfg.DataDir, "wizard"))
+		if err != nil {
+			log.Fatal("Failed to create wizard session store: %v", err)
+		}
+		wizardOpts = append(wizardOpts, wizard.WithStore(store))
+	}
+	wizardManager := wizard.NewManager(cfg.WizardTimeout, wizardOpts...)
+	restored, err := wizardManager.Restore()
+	if err != nil {
+		log.Error("Failed to restore wizard sessions: %v", err)
+	} else if restored > 0 {
+		log.Info("Restored %d wizard session(s)", restored)
+	}
+
+	// Create the brand profile and template manager
+	var profileStore profile.Store
+	if cfg.DataDir != "" {
+		profileStore, err = profile.NewFileStore(filepath.Join(cfg.DataDir, "profiles"))
+		if err != nil {
+			log.Fatal("Failed to create profile store: %v", err)
+		}
+	}
+
 	// Create handler
-	h := handler.New(telegramClient, minimaxClient, cfg)
+	h := handler.New(telegramClient, minimaxClient, cfg,
+		handler.WithLogger(log.Named("handler")),
+		handler.WithWizardManager(wizardManager),
+		handler.WithProfiles(profile.NewManager(profileStore)),
+		handler.WithMiddleware(handler.Logging(log.Named("updates"))),
+	)
+
+	// The admin API may switch on debug logging, which reloads must not undo
+	var admin *server.Admin
+	if cfg.HTTPAddr != "" && cfg.AdminToken != "" {
+		admin = server.NewAdmin(cfg.AdminToken.Value(),
+			server.WithSessions(wizardManager),
+			server.WithConversations(minimaxClient),
+			server.WithLogLevels(log),
+			server.WithAdminLogger(log.Named("admin")),
+		)
+	}
+
+	// Apply configuration changes from the config file or SIGHUP without a restart
+	watcher := config.NewWatcher(cfg, func() (*config.Config, error) {
+		next, _, err := config.Load(os.Args[1:])
+		return next, err
+	}, config.WithWatchFile(cli.ConfigFile), config.WithWatcherLogger(log.Named("config")))
+	watcher.Subscribe(h.UpdateConfig)
+	watcher.Subscribe(func(c *config.Config) {
+		level, _ := logger.ParseLevel(c.LogLevel)
+		components, _ := logger.ParseComponentLevels(c.LogComponentLevels)
+		if admin != nil {
+			admin.SetLogLevel(level)
+		} else {
+			log.SetLevel(level)
+		}
+		log.SetComponentLevels(components)
+		minimaxClient.SetModel(c.MinimaxModel)
+		minimaxClient.SetTimeout(c.MinimaxTimeout)
+		wizardManager.SetTimeouts(c.WizardTimeout, c.WizardReminder)
+	})
+	go watcher.Run(ctx, 5*time.Second)
+
+	// Serve metrics, health checks and the admin API if enabled
+	var srv *server.Server
+	if cfg.HTTPAddr != "" {
+		metrics.NewGaugeFunc("bot_active_conversations", "Users with a Minimax conversation history.", func() float64 {
+			return float64(minimaxClient.ConversationCount())
+		})
+		metrics.NewGaugeFunc("bot_active_wizards", "Wizard sessions in progress.", func() float64 {
+			return float64(wizardManager.ActiveCount())
+		})
+
+		srv = server.New(cfg.HTTPAddr, server.WithLogger(log.Named("server")))
+		srv.Handle("/metrics", metrics.Default.Handler())
+		srv.AddReadinessCheck("telegram", func(ctx context.Context) error {
+			if telegramClient.BotInfo() == nil {
+				return errors.New("bot info not fetched")
+			}
+			return nil
+		})
+		srv.AddReadinessCheck("polling", func(ctx context.Context) error {
+			running, lastPoll := telegramClient.PollingStatus()
+			if !running {
+				return errors.New("polling loop not running")
+			}
+			if time.Since(lastPoll) > 90*time.Second {
+				return fmt.Errorf("no successful poll since %s", lastPoll.Format(time.RFC3339))
+			}
+			return nil
+		})
+		srv.AddReadinessCheck("minimax", minimaxClient.Ping)
+		if admin != nil {
+			srv.Handle("/admin/", admin)
+		}
+		if err := srv.Start(ctx); err != nil {
+			log.Fatal("Failed to start HTTP server: %v", err)
+		}
+	}
+
+	// Sweep timed-out wizard sessions in the background
+	go wizardManager.Run(ctx, 30*time.Second)
+
+	// Pick up edits to the prompt templates without a restart
+	go prompts.Watch(ctx, 5*time.Second)
 
 	// Start long polling
 	log.Info("Starting long polling...")
@@ -86,19 +243,49 @@ func main() {
 		log.Fatal("Failed to start long polling: %v", err)
 	}
 
-	// Handle updates in a goroutine
+	// Hand updates to the dispatcher until shutdown. While its workers and
+	// queue are full, updates pile up in the update channel and polling
+	// pauses once that is full too.
+	dispatcher := handler.NewDispatcher(h.HandleUpdate,
+		handler.WithWorkers(cfg.Workers),
+		handler.WithQueueSize(cfg.UpdateQueueSize),
+		handler.WithDispatchLogger(log.Named("dispatch")),
+	)
+	dispatcher.Start()
+	if srv != nil {
+		metrics.NewGaugeFunc("bot_pending_updates", "Updates queued or being handled.", func() float64 {
+			return float64(dispatcher.Pending())
+		})
+	}
+
+	// Updates in the update channel are confirmed to Telegram by the next
+	// getUpdates and never delivered again, so on shutdown the channel is
+	// drained into the dispatcher. Those it does not take before the
+	// shutdown deadline are kept in undelivered.
+	updatesCtx, stopUpdates := context.WithCancel(context.Background())
+	drainUpdates := make(chan struct{})
+	updatesDone := make(chan struct{})
+	var undelivered []telegram.Update
 	go func() {
+		defer close(updatesDone)
 		updateCh := telegramClient.GetUpdateChannel()
+		dispatch := func(update telegram.Update) {
+			if err := dispatcher.Dispatch(updatesCtx, update); err != nil {
+				undelivered = append(undelivered, update)
+			}
+		}
 		for {
 			select {
-			case <-ctx.Done():
-				return
-			case update, ok := <-updateCh:
-				if !ok {
-					return
-				}
-				if err := h.HandleUpdate(ctx, update); err != nil {
-					log.Error("Error handling update: %v", err)
+			case update := <-updateCh:
+				dispatch(update)
+			case <-drainUpdates:
+				for {
+					select {
+					case update := <-updateCh:
+						dispatch(update)
+					default:
+						return
+					}
 				}
 			}
 		}
@@ -109,16 +296,124 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
 	<-quit
-	log.Info("Shutting down...")
+	shutdownTimeout := watcher.Current().ShutdownTimeout
+	log.Info("Shutting down, waiting up to %s for requests in progress...", shutdownTimeout)
 
-	// Stop long polling
+	// Stop receiving updates and hand those already received to the
+	// dispatcher, giving up at the shutdown deadline
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	stopDispatching := context.AfterFunc(shutdownCtx, stopUpdates)
 	telegramClient.StopLongPolling()
+	close(drainUpdates)
+	<-updatesDone
+	stopDispatching()
+	stopUpdates()
 
-	// Cancel context
-	cancel()
+	// Let queued updates and requests in progress finish, aborting and
+	// notifying the users of those that take too long
+	dropped := append(undelivered, dispatcher.Shutdown(shutdownCtx)...)
+	if err := h.Shutdown(shutdownCtx); err != nil {
+		log.Warn("Shutdown: %v", err)
+	}
+	cancelShutdown()
+	if len(dropped) > 0 {
+		log.Warn("Shutdown: dropped %d queued updates", len(dropped))
+		h.NotifyDropped(dropped)
+	}
+	dispatcher.Wait()
+
+	// Save state before exiting
+	if err := wizardManager.Flush(); err != nil {
+		log.Error("Failed to save wizard sessions: %v", err)
+	}
 
-	// Give time for graceful shutdown
-	time.Sleep(time.Second)
+	// Stop background work and the HTTP server
+	cancel()
+	if srv != nil {
+		<-srv.Done()
+	}
 
 	log.Info("Bot stopped")
 }
+
+// runCommand runs a subcommand such as "config check" and returns the exit
+// code. loadErr is the error from loading the configuration, if any.
+func runCommand(cfg *config.Config, cli config.CommandLine, loadErr error) int {
+	if len(cli.Args) == 2 && cli.Args[0] == "config" && cli.Args[1] == "check" {
+		return checkConfig(cfg, cli, loadErr)
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q, expected \"config check\"\n", strings.Join(cli.Args, " "))
+	return 2
+}
+
+// checkConfig prints every problem with the configuration, including
+// settings that failed to load. It fails only if there are errors; warnings
+// are printed but allowed.
+func checkConfig(cfg *config.Config, cli config.CommandLine, loadErr error) int {
+	source := "environment and flags"
+	if cli.ConfigFile != "" {
+		source = cli.ConfigFile + ", environment and flags"
+	}
+	fmt.Printf("Checking configuration from %s\n", source)
+
+	errs := 0
+	if loadErr != nil {
+		for _, line := range strings.Split(loadErr.Error(), "\n") {
+			fmt.Printf("error: %s\n", line)
+			errs++
+		}
+	}
+
+	report := cfg.Check()
+	if len(report.Problems) > 0 {
+		fmt.Println(report)
+	}
+	errs += len(report.Errors())
+	warnings := len(report.Warnings())
+	fmt.Printf("%d error(s), %d warning(s)\n", errs, warnings)
+	if errs > 0 {
+		return 1
+	}
+	return 0
+}
+
+// newLogger creates the logger described by cfg, which must be valid. It
+// writes to stderr and, if configured, to a rotating log file, which the
+// caller must close.
+func newLogger(cfg *config.Config) (*logger.Logger, *logger.RotatingFile, error) {
+	level, _ := logger.ParseLevel(cfg.LogLevel)
+	format, _ := logger.ParseFormat(cfg.LogFormat)
+	components, _ := logger.ParseComponentLevels(cfg.LogComponentLevels)
+
+	opts := []logger.Option{
+		logger.WithPrefix("bot"),
+		logger.WithLevel(level),
+		logger.WithComponentLevels(components),
+		logger.WithFormat(format),
+		logger.WithRedactor(logger.NewRedactor(
+			logger.RedactSecrets(cfg.TelegramBotToken.Value(), cfg.MinimaxAPIKey.Value()),
+			logger.RedactContent(cfg.LogRedactContent),
+		)),
+	}
+
+	var file *logger.RotatingFile
+	if cfg.LogFile != "" {
+		var err error
+		file, err = logger.NewRotatingFile(cfg.LogFile,
+			logger.WithMaxFileSize(int64(cfg.LogFileMaxSize)*1024*1024),
+			logger.WithRotateInterval(cfg.LogFileRotateInterval),
+			logger.WithMaxBackups(cfg.LogFileMaxBackups),
+			logger.WithMaxBackupAge(cfg.LogFileMaxAge),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		fileLevel := level
+		if cfg.LogFileLevel != "" {
+			fileLevel, _ = logger.ParseLevel(cfg.LogFileLevel)
+		}
+		opts = append(opts, logger.WithSink(logger.Sink{Output: file, Level: fileLevel, Format: format}))
+	}
+
+	return logger.New(opts...), file, nil
+}
@@ -2,4 +2,8 @@ module github.com/minimax-agent/telegram-bot
 
 go 1.21
 
-require github.com/joho/godotenv v1.5.1 // indirect
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/joho/godotenv v1.5.1
+	gopkg.in/yaml.v3 v3.0.1
+)
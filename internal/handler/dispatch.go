@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/minimax-agent/telegram-bot/internal/telegram"
+	"github.com/minimax-agent/telegram-bot/pkg/logger"
+	"github.com/minimax-agent/telegram-bot/pkg/metrics"
+)
+
+var (
+	updatePanics = metrics.NewCounter("bot_update_panics_total",
+		"Updates whose handling panicked.")
+	dispatchWaits = metrics.NewCounter("bot_update_queue_full_total",
+		"Updates that had to wait because all workers and queue slots were busy.")
+)
+
+// ErrDispatcherClosed is returned by Dispatch once Shutdown was called.
+var ErrDispatcherClosed = errors.New("dispatcher is shut down")
+
+// Dispatcher hands updates to a pool of workers. Updates from the same
+// chat are handled one after another in the order they were dispatched,
+// except /stop and the Stop button, which must not wait for the update
+// they stop; updates from different chats are handled concurrently.
+type Dispatcher struct {
+	handle    UpdateHandler
+	workers   int
+	queueSize int
+	logger    *logger.Logger
+
+	// slots holds a token for every update queued or being handled, so
+	// Dispatch blocks while workers and queue are full
+	slots chan struct{}
+	// work receives chats with updates ready to be handled
+	work chan *chatQueue
+
+	mu       sync.Mutex
+	chats    map[chatKey]*chatQueue
+	seq      uint64
+	closed   bool
+	dropping bool
+	pending  sync.WaitGroup
+
+	closing  chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// chatKey identifies the queue an update is handled in. Updates without a
+// chat, and those stopping a generation in progress, get a queue of their
+// own, told apart by seq.
+type chatKey struct {
+	chatID int64
+	seq    uint64
+}
+
+// chatQueue holds the updates of a chat waiting to be handled. At most one
+// worker handles a chat at a time.
+type chatQueue struct {
+	key     chatKey
+	updates []telegram.Update
+}
+
+// DispatcherOption configures a Dispatcher.
+type DispatcherOption func(*Dispatcher)
+
+// WithWorkers sets how many updates are handled at the same time.
+func WithWorkers(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.workers = n
+	}
+}
+
+// WithQueueSize sets how many updates may wait for a worker before
+// Dispatch blocks.
+func WithQueueSize(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.queueSize = n
+	}
+}
+
+// WithDispatchLogger sets the logger for failed and panicking updates.
+func WithDispatchLogger(l *logger.Logger) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.logger = l
+	}
+}
+
+// NewDispatcher creates a dispatcher that handles updates with handle.
+// Call Start to start its workers.
+func NewDispatcher(handle UpdateHandler, opts ...DispatcherOption) *Dispatcher {
+	d := &Dispatcher{
+		handle:    handle,
+		workers:   8,
+		queueSize: 100,
+		logger:    logger.Default(),
+		chats:     make(map[chatKey]*chatQueue),
+		closing:   make(chan struct{}),
+		stop:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.workers < 1 {
+		d.workers = 1
+	}
+	if d.queueSize < 0 {
+		d.queueSize = 0
+	}
+	// One bad update must not take down the bot
+	d.handle = Recovery(d.logger)(d.handle)
+
+	d.slots = make(chan struct{}, d.workers+d.queueSize)
+	// Every chat in work holds at least one slot, so sends never block
+	d.work = make(chan *chatQueue, d.workers+d.queueSize)
+	return d
+}
+
+// Start starts the workers.
+func (d *Dispatcher) Start() {
+	for i := 0; i < d.workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+}
+
+// Dispatch queues an update. If workers and queue are full, it blocks until
+// a slot frees up, ctx is done or the dispatcher is shut down.
+func (d *Dispatcher) Dispatch(ctx context.Context, update telegram.Update) error {
+	select {
+	case d.slots <- struct{}{}:
+	default:
+		dispatchWaits.Inc()
+		d.logger.Debug("All %d workers and %d queue slots are busy, waiting", d.workers, d.queueSize)
+		select {
+		case d.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-d.closing:
+			return ErrDispatcherClosed
+		}
+	}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		<-d.slots
+		return ErrDispatcherClosed
+	}
+	d.pending.Add(1)
+
+	key := chatKey{chatID: updateChatID(update)}
+	if key.chatID == 0 || isStopUpdate(update) {
+		d.seq++
+		key.seq = d.seq
+	}
+	if q, ok := d.chats[key]; ok {
+		// A worker is handling the chat and will pick this up next
+		q.updates = append(q.updates, update)
+		d.mu.Unlock()
+		return nil
+	}
+	q := &chatQueue{key: key, updates: []telegram.Update{update}}
+	d.chats[key] = q
+	d.mu.Unlock()
+
+	d.work <- q
+	return nil
+}
+
+// Pending returns the number of updates queued or being handled.
+func (d *Dispatcher) Pending() int {
+	return len(d.slots)
+}
+
+func (d *Dispatcher) worker() {
+	defer d.wg.Done()
+	for {
+		select {
+		case q := <-d.work:
+			d.run(q)
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// run handles the updates of a chat until its queue is empty.
+func (d *Dispatcher) run(q *chatQueue) {
+	for {
+		d.mu.Lock()
+		if len(q.updates) == 0 || d.dropping {
+			delete(d.chats, q.key)
+			d.mu.Unlock()
+			return
+		}
+		update := q.updates[0]
+		q.updates = q.updates[1:]
+		d.mu.Unlock()
+
+		d.handleUpdate(update)
+		<-d.slots
+		d.pending.Done()
+	}
+}
+
+// handleUpdate handles an update, logging errors.
+func (d *Dispatcher) handleUpdate(update telegram.Update) {
+	ctx := logger.ContextWithCorrelationID(context.Background(), CorrelationID(update))
+	if err := d.handle(ctx, update); err != nil {
+		d.logger.WithContext(ctx).Error("Error handling update: %v", err)
+	}
+}
+
+// Shutdown stops accepting updates and waits for the queued ones to be
+// handled. If ctx is done first, updates that have not started are
+// dropped and returned; those being handled are left to finish, see
+// Handler.Shutdown. The workers exit once they are idle.
+func (d *Dispatcher) Shutdown(ctx context.Context) []telegram.Update {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.closing)
+	}
+	d.mu.Unlock()
+
+	idle := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(idle)
+	}()
+
+	var dropped []telegram.Update
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		d.mu.Lock()
+		d.dropping = true
+		for _, q := range d.chats {
+			for range q.updates {
+				<-d.slots
+				d.pending.Done()
+			}
+			dropped = append(dropped, q.updates...)
+			q.updates = nil
+		}
+		d.mu.Unlock()
+	}
+
+	d.stopOnce.Do(func() { close(d.stop) })
+	return dropped
+}
+
+// Wait waits for the workers to exit after Shutdown.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
@@ -7,26 +7,49 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/minimax-agent/telegram-bot/internal/minimax"
+	"github.com/minimax-agent/telegram-bot/internal/profile"
 	"github.com/minimax-agent/telegram-bot/internal/telegram"
 	"github.com/minimax-agent/telegram-bot/internal/wizard"
 	"github.com/minimax-agent/telegram-bot/pkg/config"
 	"github.com/minimax-agent/telegram-bot/pkg/logger"
+	"github.com/minimax-agent/telegram-bot/pkg/metrics"
 )
 
+var commandsExecuted = metrics.NewCounterVec("bot_commands_total",
+	"Bot commands received, by command, or unknown.", "command")
+
 // Handler handles incoming updates from Telegram and communicates with Minimax.
 type Handler struct {
 	telegramClient *telegram.Client
 	minimaxClient  *minimax.Client
-	config         *config.Config
 	logger         *logger.Logger
 
-	// User processing status
+	// Middleware added with WithMiddleware, and the update handling chain
+	// built from it
+	middleware []Middleware
+	handle     UpdateHandler
+
+	// Current configuration, replaced as a whole on reload
+	current atomic.Pointer[config.Config]
+
+	// User processing status: set while a user's inbox is being answered
 	processingMu sync.RWMutex
 	processing   map[int64]bool
 
+	// Chat messages waiting for a reply, by user
+	inboxMu sync.Mutex
+	inboxes map[int64]*inbox
+
+	// Cancels the reply being generated, by user
+	generationsMu sync.Mutex
+	generations   map[int64]context.CancelFunc
+
 	// Rate limiting
 	rateLimitMu     sync.RWMutex
 	lastMessageTime map[int64]time.Time
@@ -37,28 +60,103 @@ type Handler struct {
 
 	// Wizard manager
 	wizardManager *wizard.Manager
+
+	// Saved brand profiles and prompt templates
+	profiles *profile.Manager
+
+	// Updates being handled, tracked so Shutdown can wait for them
+	inflightMu sync.Mutex
+	inflight   map[*request]struct{}
+	inflightWG sync.WaitGroup
+	closing    bool
+	// Chats told on shutdown that their request was interrupted
+	notified map[int64]bool
 }
 
+// Callback data values used by inline keyboard buttons.
+const (
+	callbackWizardResume  = "wizard:resume"
+	callbackVariantPrefix = "variant:"
+)
+
 // CommandHandler is a function that handles a command.
 type CommandHandler func(ctx context.Context, msg *telegram.Message, args string) error
 
+// Option configures the Handler.
+type Option func(*Handler)
+
+// WithLogger sets a custom logger.
+func WithLogger(l *logger.Logger) Option {
+	return func(h *Handler) {
+		h.logger = l
+	}
+}
+
+// WithWizardManager sets the wizard manager, e.g. one backed by a persistent store.
+func WithWizardManager(m *wizard.Manager) Option {
+	return func(h *Handler) {
+		h.wizardManager = m
+	}
+}
+
+// WithProfiles sets the brand profile and template manager, e.g. one backed
+// by a persistent store.
+func WithProfiles(m *profile.Manager) Option {
+	return func(h *Handler) {
+		h.profiles = m
+	}
+}
+
+// WithMiddleware adds middleware around update handling, the first one
+// outermost. It runs inside the built-in metrics middleware and answering
+// of callback queries, and outside the built-in check of allowed users.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(h *Handler) {
+		h.middleware = append(h.middleware, middleware...)
+	}
+}
+
 // New creates a new Handler.
 func New(
 	telegramClient *telegram.Client,
 	minimaxClient *minimax.Client,
 	cfg *config.Config,
+	opts ...Option,
 ) *Handler {
 	h := &Handler{
 		telegramClient:  telegramClient,
 		minimaxClient:   minimaxClient,
-		config:          cfg,
 		logger:          logger.Default(),
 		processing:      make(map[int64]bool),
+		inboxes:         make(map[int64]*inbox),
 		lastMessageTime: make(map[int64]time.Time),
-		rateLimit:       1 * time.Second, // Rate limit per user
+		rateLimit:       cfg.RateLimit, // Rate limit per user
 		commands:        make(map[string]CommandHandler),
-		wizardManager:   wizard.NewManager(10 * time.Minute),
+		inflight:        make(map[*request]struct{}),
 	}
+	h.current.Store(cfg)
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.wizardManager == nil {
+		h.wizardManager = wizard.NewManager(cfg.WizardTimeout,
+			wizard.WithReminder(cfg.WizardReminder),
+			wizard.WithLogger(h.logger),
+		)
+	}
+	if h.profiles == nil {
+		h.profiles = profile.NewManager(nil)
+	}
+	h.wizardManager.SetHooks(wizard.Hooks{
+		OnReminder: h.wizardReminder,
+		OnExpire:   h.wizardExpired,
+	})
+
+	middleware := append([]Middleware{Metrics(), h.answerCallbackQueries}, h.middleware...)
+	middleware = append(middleware, Auth(h.logger, h.isAllowed))
+	h.handle = chain(h.route, middleware...)
 
 	// Register default commands
 	h.registerDefaultCommands()
@@ -66,8 +164,56 @@ func New(
 	return h
 }
 
-// HandleUpdate handles an incoming update from Telegram.
+// UpdateConfig switches the handler to a reloaded configuration.
+func (h *Handler) UpdateConfig(cfg *config.Config) {
+	h.current.Store(cfg)
+
+	h.rateLimitMu.Lock()
+	h.rateLimit = cfg.RateLimit
+	h.rateLimitMu.Unlock()
+}
+
+// config returns the current configuration.
+func (h *Handler) config() *config.Config {
+	return h.current.Load()
+}
+
+// isAllowed reports whether a user may use the bot. Everyone may if no
+// allowed users are configured.
+func (h *Handler) isAllowed(userID int64) bool {
+	allowed := h.config().AllowedUsers
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, id := range allowed {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleUpdate handles an incoming update from Telegram. Every log entry
+// written while handling it, including those of the Telegram and Minimax
+// clients, carries the correlation ID "update-<update_id>". Updates pass
+// through the middleware chain first; those received after Shutdown are
+// ignored.
 func (h *Handler) HandleUpdate(ctx context.Context, update telegram.Update) error {
+	ctx = logger.ContextWithCorrelationID(ctx, CorrelationID(update))
+
+	ctx, done, ok := h.begin(ctx, update)
+	if !ok {
+		h.log(ctx).Debug("Ignoring update received during shutdown")
+		return nil
+	}
+	defer done()
+
+	return h.handle(ctx, update)
+}
+
+// route hands an update that passed the middleware to the handler for its
+// type.
+func (h *Handler) route(ctx context.Context, update telegram.Update) error {
 	// Handle different update types
 	switch {
 	case update.Message != nil:
@@ -77,12 +223,22 @@ func (h *Handler) HandleUpdate(ctx context.Context, update telegram.Update) erro
 	case update.InlineQuery != nil:
 		return h.handleInlineQuery(ctx, update.InlineQuery)
 	default:
-		h.logger.Debug("Unhandled update type: %+v", update)
+		h.log(ctx).Debug("Unhandled update type: %+v", update)
 	}
 
 	return nil
 }
 
+// CorrelationID returns the correlation ID of log entries about update.
+func CorrelationID(update telegram.Update) string {
+	return fmt.Sprintf("update-%d", update.UpdateID)
+}
+
+// log returns the logger for entries about the request handled in ctx.
+func (h *Handler) log(ctx context.Context) *logger.Logger {
+	return h.logger.WithContext(ctx)
+}
+
 // handleMessage handles an incoming message.
 func (h *Handler) handleMessage(ctx context.Context, msg *telegram.Message) error {
 	if msg == nil || msg.Text == "" {
@@ -99,110 +255,8 @@ func (h *Handler) handleMessage(ctx context.Context, msg *telegram.Message) erro
 		return h.handleWizardMessage(ctx, msg, wiz)
 	}
 
-	// Check rate limiting
-	if !h.checkRateLimit(msg.From.ID) {
-		h.sendMessage(ctx, msg.Chat.ID, "Please wait a moment before sending another message.")
-		return nil
-	}
-
-	// Check if user is already processing
-	if h.isProcessing(msg.From.ID) {
-		h.sendMessage(ctx, msg.Chat.ID, "I'm still processing your previous message. Please wait.")
-		return nil
-	}
-
-	// Set user as processing
-	h.setProcessing(msg.From.ID, true)
-	defer h.setProcessing(msg.From.ID, false)
-
-	// Add user message to conversation
-	h.minimaxClient.Chat(ctx, minimax.ChatParams{
-		UserID: msg.From.ID,
-		Messages: []minimax.Message{
-			{
-				Role:    "user",
-				Content: msg.Text,
-			},
-		},
-	})
-
-	// Send thinking indicator
-	thinkingMsg, err := h.sendMessage(ctx, msg.Chat.ID, "🤔 Thinking...")
-	if err != nil {
-		h.logger.Error("Failed to send thinking message: %v", err)
-	}
-
-	// Get response from Minimax
-	response, err := h.minimaxClient.Chat(ctx, minimax.ChatParams{
-		UserID: msg.From.ID,
-	})
-	if err != nil {
-		h.logger.Error("Minimax error: %v", err)
-
-		// Delete thinking message
-		if thinkingMsg != nil {
-			h.telegramClient.DeleteMessage(ctx, msg.Chat.ID, thinkingMsg.MessageID)
-		}
-
-		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Sorry, I encountered an error: %v", err))
-		return err
-	}
-
-	// Delete thinking message
-	if thinkingMsg != nil {
-		h.telegramClient.DeleteMessage(ctx, msg.Chat.ID, thinkingMsg.MessageID)
-	}
-
-	// Send response
-	if len(response.Choices) > 0 {
-		responseText := response.Choices[0].Message.Content
-		h.sendMessage(ctx, msg.Chat.ID, responseText)
-	}
-
-	return nil
-}
-
-// handleWizardMessage handles a message in an active wizard session.
-func (h *Handler) handleWizardMessage(ctx context.Context, msg *telegram.Message, wiz *wizard.Wizard) error {
-	// Get current question key
-	key := wiz.GetCurrentKey()
-
-	// Save the answer
-	wiz.SetAnswer(key, msg.Text)
-
-	// Check if wizard is complete
-	if wiz.IsComplete() {
-		// Build prompt from answers
-		prompt := wiz.BuildPrompt()
-
-		// Clear wizard session
-		h.wizardManager.EndWizard(msg.From.ID)
-
-		// Generate content
-		h.sendMessage(ctx, msg.Chat.ID, "Generating content based on your answers...")
-
-		response, err := h.minimaxClient.Chat(ctx, minimax.ChatParams{
-			UserID: msg.From.ID,
-			Messages: []minimax.Message{
-				{Role: "user", Content: prompt},
-			},
-		})
-		if err != nil {
-			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Error generating content: %v", err))
-			return err
-		}
-
-		if len(response.Choices) > 0 {
-			h.sendMessage(ctx, msg.Chat.ID, response.Choices[0].Message.Content)
-		}
-		return nil
-	}
-
-	// Get next question
-	nextQuestion := wiz.GetCurrentQuestion()
-	progress := wiz.GetProgress()
-	h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Got it! %s\n\n%s\n\n(Type /cancel to cancel the wizard)", progress, nextQuestion))
-	return nil
+	// Answer in order, after any reply in progress
+	return h.queueChatMessage(ctx, msg)
 }
 
 // handleCommand handles a command message.
@@ -210,56 +264,78 @@ func (h *Handler) handleCommand(ctx context.Context, msg *telegram.Message) erro
 	// Remove the command prefix
 	text := strings.TrimSpace(msg.Text)
 
-	// Split command and arguments
-	parts := strings.Fields(text[1:]) // Remove leading /
-	if len(parts) == 0 {
+	// Split command and arguments, keeping the arguments as typed so
+	// commands can parse quoted values
+	command, args := text[1:], "" // Remove leading /
+	if i := strings.IndexFunc(command, unicode.IsSpace); i >= 0 {
+		command, args = command[:i], strings.TrimSpace(command[i:])
+	}
+	if command == "" {
 		return nil
 	}
 
-	command := strings.ToLower(parts[0])
-	args := ""
-	if len(parts) > 1 {
-		args = strings.Join(parts[1:], " ")
-	}
+	// Commands may be addressed to the bot, e.g. /create@MyBot
+	command, _, _ = strings.Cut(command, "@")
+	command = strings.ToLower(command)
 
 	// Look up command handler
 	handler, ok := h.commands[command]
 	if !ok {
+		// Not labeled with the command, which anyone can make up
+		commandsExecuted.With("unknown").Inc()
 		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Unknown command: /%s", command))
 		return nil
 	}
+	commandsExecuted.With(command).Inc()
 
 	return handler(ctx, msg, args)
 }
 
 // handleCallbackQuery handles a callback query.
 func (h *Handler) handleCallbackQuery(ctx context.Context, query *telegram.CallbackQuery) error {
-	// Answer the callback query
-	h.telegramClient.AnswerCallbackQuery(ctx, telegram.AnswerCallbackQueryParams{
-		CallbackQueryID: query.ID,
-	})
-
 	// Handle based on callback data
 	if query.Data == "" {
 		return nil
 	}
 
+	switch {
+	case query.Data == callbackStop:
+		return h.handleStopCallback(ctx, query)
+	case query.Data == callbackWizardResume:
+		return h.resumeWizard(ctx, query)
+	case strings.HasPrefix(query.Data, callbackVariantPrefix):
+		return h.handleVariantCallback(ctx, query)
+	}
+
 	// Process callback data (can be extended for more functionality)
-	h.logger.Debug("Callback query: %s", query.Data)
+	h.log(ctx).Debug("Callback query: %s", query.Data)
 
 	return nil
 }
 
+// answerCallbackQueries answers every callback query before handing it on,
+// so the button stops spinning even if middleware drops the update.
+func (h *Handler) answerCallbackQueries(next UpdateHandler) UpdateHandler {
+	return func(ctx context.Context, update telegram.Update) error {
+		if query := update.CallbackQuery; query != nil {
+			h.telegramClient.AnswerCallbackQuery(ctx, telegram.AnswerCallbackQueryParams{
+				CallbackQueryID: query.ID,
+			})
+		}
+		return next(ctx, update)
+	}
+}
+
 // handleInlineQuery handles an inline query.
 func (h *Handler) handleInlineQuery(ctx context.Context, query *telegram.InlineQuery) error {
 	// Process inline query if enabled
-	if !h.config.EnableInlineMode {
+	if !h.config().EnableInlineMode {
 		return nil
 	}
 
 	// This would require implementing the inline query response
 	// For now, we'll just log it
-	h.logger.Debug("Inline query from %s: %s", query.From.Username, query.Query)
+	h.log(ctx).Debug("Inline query from %s: %s", query.From.Username, query.Query)
 
 	return nil
 }
@@ -271,12 +347,23 @@ func escapeMarkdown(text string) string {
 	return re.ReplaceAllString(text, "\\$1")
 }
 
+// truncate shortens text that is too long for a message.
+func (h *Handler) truncate(text string) string {
+	if len(text) <= h.config().MaxMessageLength {
+		return text
+	}
+	// Cut on a rune boundary so the message stays valid UTF-8
+	cut := h.config().MaxMessageLength - 3
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "..."
+}
+
 // sendMessage sends a message to a chat.
 func (h *Handler) sendMessage(ctx context.Context, chatID int64, text string) (*telegram.Message, error) {
 	// Truncate message if too long
-	if len(text) > h.config.MaxMessageLength {
-		text = text[:h.config.MaxMessageLength-3] + "..."
-	}
+	text = h.truncate(text)
 
 	// Always send as plain text to avoid Markdown parsing issues
 	// The AI responses often contain characters that conflict with MarkdownV2
@@ -288,7 +375,7 @@ func (h *Handler) sendMessage(ctx context.Context, chatID int64, text string) (*
 	})
 
 	if err != nil {
-		h.logger.Error("Failed to send message: %v", err)
+		h.log(ctx).Error("Failed to send message: %v", err)
 		return nil, err
 	}
 
@@ -299,18 +386,21 @@ func (h *Handler) sendMessage(ctx context.Context, chatID int64, text string) (*
 func (h *Handler) registerDefaultCommands() {
 	// /start command
 	h.commands["start"] = func(ctx context.Context, msg *telegram.Message, args string) error {
-		welcomeText := "Welcome to Minimax Bot!\n\nI'm an AI assistant powered by Minimax. You can talk to me by sending messages.\n\nAvailable commands:\n/start - Show this welcome message\n/clear - Clear conversation history\n/help - Show help information\n/status - Show bot status\n/create - Content creation wizard"
+		welcomeText := "Welcome to Minimax Bot!\n\nI'm an AI assistant powered by Minimax. You can talk to me by sending messages.\n\nAvailable commands:\n/start - Show this welcome message\n/stop - Stop the reply being generated\n/clear - Clear conversation history\n/help - Show help information\n/status - Show bot status\n/create - Content creation wizard"
 		h.sendMessage(ctx, msg.Chat.ID, welcomeText)
 		return nil
 	}
 
 	// /help command
 	h.commands["help"] = func(ctx context.Context, msg *telegram.Message, args string) error {
-		helpText := "Help\n\nYou can communicate with me by sending messages. I'll respond using Minimax AI.\n\nCommands:\n/start - Start the bot\n/clear - Clear conversation history\n/help - Show this help message\n/status - Show bot status\n/create - Content creation wizard\n/cancel - Cancel active wizard\n\nTips:\n- Be specific in your questions\n- Provide context when needed\n- Use follow-up questions for more details"
+		helpText := "Help\n\nYou can communicate with me by sending messages. I'll respond using Minimax AI.\n\nCommands:\n/start - Start the bot\n/stop - Stop the reply being generated\n/clear - Clear conversation history\n/help - Show this help message\n/status - Show bot status\n/create - Content creation wizard\n/draft - Compare or roll back generated drafts\n/done - Finish refining a draft\n/profile - Manage brand profiles\n/template - Manage prompt templates\n/cancel - Cancel active wizard\n\nTips:\n- Be specific in your questions\n- Provide context when needed\n- Use follow-up questions for more details"
 		h.sendMessage(ctx, msg.Chat.ID, helpText)
 		return nil
 	}
 
+	// /stop command
+	h.commands["stop"] = h.handleStop
+
 	// /clear command
 	h.commands["clear"] = func(ctx context.Context, msg *telegram.Message, args string) error {
 		h.minimaxClient.ClearConversation(msg.From.ID)
@@ -332,7 +422,7 @@ func (h *Handler) registerDefaultCommands() {
 		conversation := h.minimaxClient.GetConversation(msg.From.ID)
 		msgCount := len(conversation)
 
-		statusText := fmt.Sprintf("Bot Status\n\nBot: @%s\nModel: %s\nYour messages in this conversation: %d", botInfo.Username, h.config.MinimaxModel, msgCount)
+		statusText := fmt.Sprintf("Bot Status\n\nBot: @%s\nModel: %s\nYour messages in this conversation: %d", botInfo.Username, h.config().MinimaxModel, msgCount)
 
 		_, err = h.telegramClient.SendMessage(ctx, telegram.SendMessageParams{
 			ChatID: msg.Chat.ID,
@@ -344,56 +434,107 @@ func (h *Handler) registerDefaultCommands() {
 	// /create command - starts content creation wizard
 	h.commands["create"] = func(ctx context.Context, msg *telegram.Message, args string) error {
 		// Parse content type and flags from args
-		flags, contentType := wizard.ParseFlags(args)
+		parsed, err := wizard.ParseArgs(args)
+		if err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("⚠️ %v\n\nSend /create for usage.", err))
+			return nil
+		}
 
-		if contentType == "" {
+		if parsed.ContentType == "" {
 			// Show help for /create command
-			helpText := "Content Creation Wizard\n\nUse /create to start an interactive wizard for creating content.\n\nUsage:\n/create <type> [flags]\n\nContent Types:\n- marketing - Marketing copy\n- email     - Email content\n- report    - Business report\n- script    - Video/podcast script\n- whitepaper - Whitepaper\n- story     - Creative story\n- poem       - Poem\n\nFlags:\n-t <text>  - Quick prompt (bypasses wizard)\n-m <text>  - Message/instructions\n-s <style> - Writing style\n-q          - Quick mode (fewer questions)\n\nExamples:\n/create marketing\n/create email -t newsletter signup\n/create report -s formal\n/create story -q"
+			helpText := "Content Creation Wizard\n\nUse /create to start an interactive wizard for creating content.\n\nUsage:\n/create <type> [flags]\n\nContent Types:\n- marketing - Marketing copy\n- email     - Email content\n- report    - Business report\n- script    - Video/podcast script\n- whitepaper - Whitepaper\n- story     - Creative story\n- poem       - Poem\n- twitter    - Twitter/X thread\n- linkedin   - LinkedIn post\n- instagram  - Instagram caption with hashtags\n- product    - E-commerce product description\n- pressrelease - Press release\n- googleads  - Google Ads headlines and descriptions\n\nFlags:\n-t, --prompt <text>  - Quick prompt (bypasses wizard)\n-m, --message <text> - Message/instructions (repeatable)\n-s, --style <style>  - Writing style\n-q, --quick          - Quick mode (essential questions only)\n-n, --count <count>  - Generate several variants to choose from\n-h, --help           - List all flags for a content type\n-p, --profile <name> - Pre-fill answers from a brand profile\n--template <name>    - Generate with a saved prompt template\n\nQuote values that contain flags or start with a dash, or put the prompt after --.\n\nExamples:\n/create marketing\n/create marketing -n 3\n/create email -t newsletter signup -s friendly\n/create email --subject=\"Spring sale\" --tone casual\n/create report -s formal\n/create story -q\n/create marketing -- -50% off this weekend"
 			h.sendMessage(ctx, msg.Chat.ID, helpText)
 			return nil
 		}
 
+		if parsed.Bool(wizard.FlagHelp) {
+			h.sendMessage(ctx, msg.Chat.ID, wizard.FlagUsage(parsed.ContentType))
+			return nil
+		}
+
+		// Validate the variant count before starting a session
+		if parsed.Has(wizard.FlagCount) {
+			if count := parsed.Int(wizard.FlagCount); count < 1 || count > maxVariants {
+				h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("--count must be between 1 and %d", maxVariants))
+				return nil
+			}
+		}
+
+		if parsed.Has(wizard.FlagTemplate) {
+			if parsed.Has(wizard.FlagPrompt) {
+				h.sendMessage(ctx, msg.Chat.ID, "--template cannot be combined with a quick prompt (-t)")
+				return nil
+			}
+			if _, err := h.profiles.Template(msg.From.ID, parsed.String(wizard.FlagTemplate)); err != nil {
+				h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("⚠️ %v. See /template for your templates.", err))
+				return nil
+			}
+		}
+
+		brand, err := h.profileAnswers(ctx, msg.From.ID, parsed)
+		if err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("⚠️ %v. See /profile for your profiles.", err))
+			return nil
+		}
+
 		// Start wizard session
-		wiz := h.wizardManager.StartWizard(msg.From.ID, wizard.ContentType(contentType))
+		wiz := h.wizardManager.StartWizard(msg.From.ID, msg.Chat.ID, parsed.ContentType)
+		wiz.SetFlags(parsed.Values())
+		wiz.SetLocale(msg.From.LanguageCode)
 
 		// If quick mode with prompt, skip wizard
-		if flags["t"] != "" {
+		if parsed.Has(wizard.FlagPrompt) {
 			// Build prompt from flags and generate content directly
-			prompt := flags["t"]
-			if flags["m"] != "" {
-				prompt = flags["m"] + ": " + prompt
+			prompt := parsed.String(wizard.FlagPrompt)
+			if messages := parsed.Strings(wizard.FlagMessage); len(messages) > 0 {
+				prompt = strings.Join(messages, "; ") + ": " + prompt
 			}
-			if flags["s"] != "" {
-				prompt += " (style: " + flags["s"] + ")"
+			if parsed.Has(wizard.FlagStyle) {
+				prompt += " (style: " + parsed.String(wizard.FlagStyle) + ")"
 			}
 
-			h.sendMessage(ctx, msg.Chat.ID, "Generating content...")
-
-			response, err := h.minimaxClient.Chat(ctx, minimax.ChatParams{
-				UserID: msg.From.ID,
-				Messages: []minimax.Message{
-					{Role: "user", Content: prompt},
-				},
+			return h.stoppable(ctx, msg.Chat.ID, wiz.UserID, "Generating content...", stoppedDraftText, func(ctx context.Context) error {
+				return h.generateDraft(ctx, msg.Chat.ID, wiz, prompt)
 			})
-			if err != nil {
-				h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Error: %v", err))
-				return err
-			}
+		}
 
-			if len(response.Choices) > 0 {
-				h.sendMessage(ctx, msg.Chat.ID, response.Choices[0].Message.Content)
+		// Answers from the brand profile and flags skip their questions, as
+		// do optional questions in quick mode. Flags win over the profile.
+		answers := make(map[string]string)
+		intro := fmt.Sprintf("Starting %s wizard!", parsed.ContentType)
+		if brand != nil {
+			for k, v := range brand.Answers {
+				answers[k] = v
 			}
-			return nil
+			intro = fmt.Sprintf("Starting %s wizard with profile %s!", parsed.ContentType, brand.Name)
+		}
+		for k, v := range parsed.Answers() {
+			answers[k] = v
+		}
+		wiz.Prefill(answers)
+		if wiz.IsComplete() {
+			return h.completeWizard(ctx, msg.Chat.ID, wiz)
 		}
 
 		// Get first question
 		question := wiz.GetCurrentQuestion()
-		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Starting %s wizard! %s\n\n%s",
-			contentType, wiz.GetProgress(), question))
+		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("%s %s\n\n%s", intro, wiz.GetProgress(), question))
 
 		return nil
 	}
 
+	// /draft command - manage versions of generated content
+	h.commands["draft"] = h.handleDraftCommand
+
+	// /done command - finish refining the current draft
+	h.commands["done"] = func(ctx context.Context, msg *telegram.Message, args string) error {
+		return h.handleDraftCommand(ctx, msg, "done")
+	}
+
+	// /profile and /template commands - manage saved brand profiles and prompt templates
+	h.commands["profile"] = h.handleProfileCommand
+	h.commands["template"] = h.handleTemplateCommand
+
 	// /cancel command - cancel wizard
 	h.commands["cancel"] = func(ctx context.Context, msg *telegram.Message, args string) error {
 		h.wizardManager.CancelWizard(msg.From.ID)
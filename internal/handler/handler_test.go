@@ -1,11 +1,23 @@
 package handler
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 
+	"github.com/minimax-agent/telegram-bot/internal/minimax"
 	"github.com/minimax-agent/telegram-bot/internal/telegram"
+	"github.com/minimax-agent/telegram-bot/pkg/config"
+	"github.com/minimax-agent/telegram-bot/pkg/logger"
 )
 
 func TestHandlerCommands(t *testing.T) {
@@ -86,3 +98,564 @@ func TestIsProcessing(t *testing.T) {
 		t.Error("Should not be processing")
 	}
 }
+
+func TestUpdateConfig(t *testing.T) {
+	cfg := config.Default()
+	h := New(nil, nil, cfg)
+
+	if !h.isAllowed(123) {
+		t.Error("Everyone should be allowed without allowed users")
+	}
+
+	reloaded := *cfg
+	reloaded.AllowedUsers = []int64{456}
+	reloaded.RateLimit = 0
+	h.UpdateConfig(&reloaded)
+
+	if h.isAllowed(123) || !h.isAllowed(456) {
+		t.Error("Only allowed users should be allowed after reload")
+	}
+
+	h.updateRateLimit(456)
+	if !h.checkRateLimit(456) {
+		t.Error("Rate limit should be disabled after reload")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	cfg := config.Default()
+	cfg.MaxMessageLength = 16
+	h := New(nil, nil, cfg)
+
+	if got := h.truncate("short"); got != "short" {
+		t.Errorf("truncate() = %q, want the text unchanged", got)
+	}
+	// "é" takes two bytes, so byte 13 falls inside one
+	got := h.truncate("abcdefghijkl" + strings.Repeat("é", 4))
+	if got != "abcdefghijkl..." || !utf8.ValidString(got) {
+		t.Errorf("truncate() = %q, want it cut before the split rune", got)
+	}
+}
+
+// newTestTelegram returns a Telegram client whose API records the bodies of
+// sendMessage calls.
+func newTestTelegram(t *testing.T) (*telegram.Client, func() []string) {
+	var (
+		mu   sync.Mutex
+		sent []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.HasSuffix(r.URL.Path, "/sendMessage") {
+			mu.Lock()
+			sent = append(sent, string(body))
+			mu.Unlock()
+		}
+		io.WriteString(w, `{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := telegram.NewClient("123:test", telegram.WithBaseURL(server.URL),
+		telegram.WithLogger(logger.New(logger.WithOutput(&bytes.Buffer{}))))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, sent...)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	client, sent := newTestTelegram(t)
+	h := New(client, nil, config.Default(), WithLogger(logger.New(logger.WithOutput(&bytes.Buffer{}))))
+
+	started := make(chan struct{}, 2)
+	h.RegisterCommand("quick", func(ctx context.Context, msg *telegram.Message, args string) error {
+		started <- struct{}{}
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	h.RegisterCommand("slow", func(ctx context.Context, msg *telegram.Message, args string) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	update := func(id int64, chatID int64, text string) telegram.Update {
+		return telegram.Update{UpdateID: id, Message: &telegram.Message{
+			Text: text,
+			From: &telegram.User{ID: chatID},
+			Chat: &telegram.Chat{ID: chatID},
+		}}
+	}
+
+	var wg sync.WaitGroup
+	for _, u := range []telegram.Update{update(1, 10, "/quick"), update(2, 20, "/slow")} {
+		wg.Add(1)
+		go func(u telegram.Update) {
+			defer wg.Done()
+			h.HandleUpdate(context.Background(), u)
+		}(u)
+	}
+	<-started
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := h.Shutdown(ctx); err == nil || !strings.Contains(err.Error(), "aborted 1 ") {
+		t.Errorf("Shutdown() error = %v, want one aborted request", err)
+	}
+	wg.Wait()
+
+	messages := sent()
+	if len(messages) != 1 || !strings.Contains(messages[0], `"chat_id":20`) || !strings.Contains(messages[0], "interrupted") {
+		t.Errorf("Only the user of the aborted request should be notified, sent %q", messages)
+	}
+
+	h.RegisterCommand("late", func(ctx context.Context, msg *telegram.Message, args string) error {
+		t.Error("Updates after Shutdown() should not be handled")
+		return nil
+	})
+	h.HandleUpdate(context.Background(), update(3, 10, "/late"))
+}
+
+func chatUpdate(id, chatID int64) telegram.Update {
+	return telegram.Update{UpdateID: id, Message: &telegram.Message{Chat: &telegram.Chat{ID: chatID}}}
+}
+
+func TestDispatcherOrdersUpdatesPerChat(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		handled = make(map[int64][]int64)
+		active  = make(map[int64]bool)
+	)
+	d := NewDispatcher(func(ctx context.Context, update telegram.Update) error {
+		chatID := update.Message.Chat.ID
+		mu.Lock()
+		if active[chatID] {
+			t.Errorf("Updates of chat %d handled concurrently", chatID)
+		}
+		active[chatID] = true
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		active[chatID] = false
+		handled[chatID] = append(handled[chatID], update.UpdateID)
+		mu.Unlock()
+		return nil
+	}, WithWorkers(4), WithDispatchLogger(logger.New(logger.WithOutput(&bytes.Buffer{}))))
+	d.Start()
+
+	for i := int64(0); i < 40; i++ {
+		if err := d.Dispatch(context.Background(), chatUpdate(i, i%3+1)); err != nil {
+			t.Fatalf("Dispatch() error = %v", err)
+		}
+	}
+	if dropped := d.Shutdown(context.Background()); len(dropped) != 0 {
+		t.Errorf("Shutdown() dropped %d updates", len(dropped))
+	}
+	d.Wait()
+
+	for chatID, ids := range handled {
+		for i := 1; i < len(ids); i++ {
+			if ids[i] < ids[i-1] {
+				t.Errorf("Updates of chat %d handled out of order: %v", chatID, ids)
+				break
+			}
+		}
+	}
+	if n := len(handled[1]) + len(handled[2]) + len(handled[3]); n != 40 {
+		t.Errorf("Handled %d updates, want 40", n)
+	}
+}
+
+func TestDispatcherBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	d := NewDispatcher(func(ctx context.Context, update telegram.Update) error {
+		<-release
+		return nil
+	}, WithWorkers(1), WithQueueSize(1), WithDispatchLogger(logger.New(logger.WithOutput(&bytes.Buffer{}))))
+	d.Start()
+
+	d.Dispatch(context.Background(), chatUpdate(1, 1))
+	d.Dispatch(context.Background(), chatUpdate(2, 2))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := d.Dispatch(ctx, chatUpdate(3, 3)); err != context.DeadlineExceeded {
+		t.Errorf("Dispatch() to a full dispatcher = %v, want to block until the deadline", err)
+	}
+
+	// Drop the queued update once the shutdown deadline passes
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelShutdown()
+	dropped := d.Shutdown(shutdownCtx)
+	if len(dropped) != 1 || dropped[0].UpdateID != 2 {
+		t.Errorf("Shutdown() dropped %v, want update 2", dropped)
+	}
+	if err := d.Dispatch(context.Background(), chatUpdate(4, 4)); err != ErrDispatcherClosed {
+		t.Errorf("Dispatch() after Shutdown() = %v, want ErrDispatcherClosed", err)
+	}
+	close(release)
+	d.Wait()
+}
+
+func TestUpdateChatID(t *testing.T) {
+	tests := []struct {
+		name   string
+		update telegram.Update
+		want   int64
+	}{
+		{"message", telegram.Update{Message: &telegram.Message{Chat: &telegram.Chat{ID: 7}}}, 7},
+		{"message without chat", telegram.Update{Message: &telegram.Message{}}, 0},
+		{"callback query", telegram.Update{CallbackQuery: &telegram.CallbackQuery{Message: &telegram.Message{Chat: &telegram.Chat{ID: 8}}}}, 8},
+		{"callback query without chat", telegram.Update{CallbackQuery: &telegram.CallbackQuery{Message: &telegram.Message{}}}, 0},
+		{"inline query", telegram.Update{InlineQuery: &telegram.InlineQuery{}}, 0},
+	}
+	for _, tt := range tests {
+		if got := updateChatID(tt.update); got != tt.want {
+			t.Errorf("%s: updateChatID() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDispatcherRecoversPanics(t *testing.T) {
+	buf := &bytes.Buffer{}
+	var handled []int64
+	d := NewDispatcher(func(ctx context.Context, update telegram.Update) error {
+		handled = append(handled, update.UpdateID)
+		if update.UpdateID == 1 {
+			panic("boom")
+		}
+		return nil
+	}, WithWorkers(1), WithDispatchLogger(logger.New(logger.WithOutput(buf))))
+	d.Start()
+
+	d.Dispatch(context.Background(), chatUpdate(1, 1))
+	d.Dispatch(context.Background(), chatUpdate(2, 1))
+	d.Shutdown(context.Background())
+	d.Wait()
+
+	if len(handled) != 2 {
+		t.Errorf("Handled %v, the worker should survive a panic", handled)
+	}
+	if !strings.Contains(buf.String(), "Panic handling update: boom") || !strings.Contains(buf.String(), "correlation_id=update-1") {
+		t.Errorf("Panic should be logged with the update, got %q", buf.String())
+	}
+}
+
+func TestInboxMergesQueuedMessages(t *testing.T) {
+	client, sent := newTestTelegram(t)
+
+	var (
+		mu       sync.Mutex
+		requests [][]minimax.Message
+	)
+	first := make(chan struct{})
+	release := make(chan struct{})
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req minimax.ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req.Messages)
+		n := len(requests)
+		mu.Unlock()
+		if n == 1 {
+			close(first)
+			<-release
+		}
+		fmt.Fprintf(w, `{"choices":[{"delta":{"content":"reply %d"},"finish_reason":"stop"}]}`, n)
+	}))
+	defer api.Close()
+	minimaxClient, err := minimax.NewClient("key", minimax.WithBaseURL(api.URL),
+		minimax.WithLogger(logger.New(logger.WithOutput(&bytes.Buffer{}))))
+	if err != nil {
+		t.Fatalf("minimax.NewClient() error = %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.RateLimit = 0
+	cfg.InboxSize = 2
+	h := New(client, minimaxClient, cfg, WithLogger(logger.New(logger.WithOutput(&bytes.Buffer{}))))
+
+	message := func(id int64, text string) telegram.Update {
+		return telegram.Update{UpdateID: id, Message: &telegram.Message{
+			Text: text,
+			From: &telegram.User{ID: 7},
+			Chat: &telegram.Chat{ID: 7},
+		}}
+	}
+	h.HandleUpdate(context.Background(), message(1, "a"))
+	<-first
+	for i, text := range []string{"b", "c", "d"} {
+		if err := h.HandleUpdate(context.Background(), message(int64(i+2), text)); err != nil {
+			t.Fatalf("HandleUpdate() error = %v", err)
+		}
+	}
+	close(release)
+	if err := h.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 Minimax requests, got %d: %v", len(requests), requests)
+	}
+	want := []minimax.Message{
+		{Role: "user", Content: "a"},
+		{Role: "assistant", Content: "reply 1"},
+		{Role: "user", Content: "b\n\nc"},
+	}
+	if fmt.Sprint(requests[1]) != fmt.Sprint(want) {
+		t.Errorf("Second request = %v, want %v", requests[1], want)
+	}
+	if !strings.Contains(fmt.Sprint(sent()), "2 messages waiting") {
+		t.Errorf("A message beyond the inbox size should be rejected, sent %q", sent())
+	}
+}
+
+func TestStopKeepsPartialReply(t *testing.T) {
+	edits := make(chan string, 10)
+	tg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.HasSuffix(r.URL.Path, "/editMessageText") {
+			edits <- string(body)
+		}
+		io.WriteString(w, `{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`)
+	}))
+	defer tg.Close()
+	client, err := telegram.NewClient("123:test", telegram.WithBaseURL(tg.URL),
+		telegram.WithLogger(logger.New(logger.WithOutput(&bytes.Buffer{}))))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	// Stream one chunk, then hang until the client goes away
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"choices":[{"delta":{"content":"partial"}}]}`+"\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer api.Close()
+	minimaxClient, err := minimax.NewClient("key", minimax.WithBaseURL(api.URL),
+		minimax.WithLogger(logger.New(logger.WithOutput(&bytes.Buffer{}))))
+	if err != nil {
+		t.Fatalf("minimax.NewClient() error = %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.RateLimit = 0
+	h := New(client, minimaxClient, cfg, WithLogger(logger.New(logger.WithOutput(&bytes.Buffer{}))))
+	message := func(text string) telegram.Update {
+		return telegram.Update{Message: &telegram.Message{
+			Text: text,
+			From: &telegram.User{ID: 7},
+			Chat: &telegram.Chat{ID: 7},
+		}}
+	}
+
+	h.HandleUpdate(context.Background(), message("hi"))
+	if edit := <-edits; !strings.Contains(edit, "partial") || !strings.Contains(edit, callbackStop) {
+		t.Fatalf("The streamed text should be shown with a Stop button, got %s", edit)
+	}
+	if err := h.HandleUpdate(context.Background(), message("/stop")); err != nil {
+		t.Fatalf("HandleUpdate() error = %v", err)
+	}
+	if err := h.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	if edit := <-edits; !strings.Contains(edit, `partial\n\n⏹ Stopped.`) || strings.Contains(edit, callbackStop) {
+		t.Errorf("The stopped reply should keep the partial text without the button, got %s", edit)
+	}
+	want := []minimax.Message{
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "partial"},
+	}
+	if history := minimaxClient.GetConversation(7); fmt.Sprint(history) != fmt.Sprint(want) {
+		t.Errorf("History = %v, want %v", history, want)
+	}
+	if h.stopGeneration(7) {
+		t.Error("No reply should be in progress after it was stopped")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	client, _ := newTestTelegram(t)
+	quiet := logger.New(logger.WithOutput(&bytes.Buffer{}))
+
+	var (
+		mu    sync.Mutex
+		trace []string
+	)
+	record := func(name string) Middleware {
+		return func(next UpdateHandler) UpdateHandler {
+			return func(ctx context.Context, update telegram.Update) error {
+				mu.Lock()
+				trace = append(trace, name)
+				mu.Unlock()
+				return next(ctx, update)
+			}
+		}
+	}
+
+	cfg := config.Default()
+	cfg.AllowedUsers = []int64{7}
+	h := New(client, nil, cfg, WithLogger(quiet), WithMiddleware(
+		record("outer"),
+		Recovery(quiet),
+		ChatTypes(quiet, "private"),
+		RateLimit(quiet, 2, time.Hour),
+		record("inner"),
+	))
+	handled := 0
+	h.RegisterCommand("ping", func(ctx context.Context, msg *telegram.Message, args string) error {
+		handled++
+		return nil
+	})
+	h.RegisterCommand("panic", func(ctx context.Context, msg *telegram.Message, args string) error {
+		panic("boom")
+	})
+	update := func(userID int64, chatType, text string) telegram.Update {
+		return telegram.Update{Message: &telegram.Message{
+			Text: text,
+			From: &telegram.User{ID: userID},
+			Chat: &telegram.Chat{ID: userID, Type: chatType},
+		}}
+	}
+
+	h.HandleUpdate(context.Background(), update(7, "private", "/ping"))
+	if fmt.Sprint(trace) != "[outer inner]" || handled != 1 {
+		t.Fatalf("Middleware should run in order around the handler, got %v and %d handled", trace, handled)
+	}
+
+	// Dropped by the chat type filter and the built-in allowed users check
+	h.HandleUpdate(context.Background(), update(7, "group", "/ping"))
+	h.HandleUpdate(context.Background(), update(8, "private", "/ping"))
+	if handled != 1 {
+		t.Errorf("Updates from groups and other users should be dropped, %d handled", handled)
+	}
+
+	// The panic is turned into an error
+	if err := h.HandleUpdate(context.Background(), update(7, "private", "/panic")); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("HandleUpdate() error = %v, want the panic", err)
+	}
+
+	// Two updates passed the rate limit already
+	h.HandleUpdate(context.Background(), update(7, "private", "/ping"))
+	if handled != 1 {
+		t.Errorf("Updates beyond the rate limit should be dropped, %d handled", handled)
+	}
+}
+
+func TestStopWizardGeneration(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent []string
+	)
+	tg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.HasSuffix(r.URL.Path, "/sendMessage") || strings.HasSuffix(r.URL.Path, "/editMessageText") {
+			mu.Lock()
+			sent = append(sent, string(body))
+			mu.Unlock()
+		}
+		io.WriteString(w, `{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`)
+	}))
+	defer tg.Close()
+	quiet := logger.New(logger.WithOutput(&bytes.Buffer{}))
+	client, err := telegram.NewClient("123:test", telegram.WithBaseURL(tg.URL), telegram.WithLogger(quiet))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	// Generate until the client goes away
+	requested := make(chan struct{}, 1)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		requested <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer api.Close()
+	minimaxClient, err := minimax.NewClient("key", minimax.WithBaseURL(api.URL), minimax.WithLogger(quiet))
+	if err != nil {
+		t.Fatalf("minimax.NewClient() error = %v", err)
+	}
+
+	h := New(client, minimaxClient, config.Default(), WithLogger(quiet))
+	d := NewDispatcher(h.HandleUpdate, WithDispatchLogger(quiet))
+	d.Start()
+	message := func(text string) telegram.Update {
+		return telegram.Update{Message: &telegram.Message{
+			Text: text,
+			From: &telegram.User{ID: 7},
+			Chat: &telegram.Chat{ID: 7},
+		}}
+	}
+
+	d.Dispatch(context.Background(), message(`/create marketing -t "a launch post"`))
+	select {
+	case <-requested:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The draft was not requested from Minimax")
+	}
+	// Handled although the generation holds up the chat's queue
+	d.Dispatch(context.Background(), message("/stop"))
+	if dropped := d.Shutdown(context.Background()); len(dropped) != 0 {
+		t.Errorf("Shutdown() dropped %d updates", len(dropped))
+	}
+	d.Wait()
+
+	if _, ok := h.wizardManager.GetWizard(7); ok {
+		t.Error("The wizard should end when its first draft is stopped")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	last := sent[len(sent)-1]
+	if !strings.Contains(last, "Stopped") || strings.Contains(last, callbackStop) {
+		t.Errorf("The progress message should say the generation stopped, got %s", last)
+	}
+	for _, body := range sent {
+		if strings.Contains(body, "Error") || strings.Contains(body, "Nothing to stop") {
+			t.Errorf("Unexpected message %s", body)
+		}
+	}
+}
+
+func TestDroppedCallbackQueryIsAnswered(t *testing.T) {
+	answered := make(chan string, 1)
+	tg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.HasSuffix(r.URL.Path, "/answerCallbackQuery") {
+			answered <- string(body)
+		}
+		io.WriteString(w, `{"ok":true,"result":true}`)
+	}))
+	defer tg.Close()
+	quiet := logger.New(logger.WithOutput(&bytes.Buffer{}))
+	client, err := telegram.NewClient("123:test", telegram.WithBaseURL(tg.URL), telegram.WithLogger(quiet))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.AllowedUsers = []int64{7}
+	h := New(client, nil, cfg, WithLogger(quiet))
+	h.HandleUpdate(context.Background(), telegram.Update{CallbackQuery: &telegram.CallbackQuery{
+		ID:   "q1",
+		From: &telegram.User{ID: 8},
+		Data: callbackStop,
+	}})
+
+	select {
+	case body := <-answered:
+		if !strings.Contains(body, "q1") {
+			t.Errorf("Answered the wrong callback query: %s", body)
+		}
+	default:
+		t.Error("A callback query from a user who is not allowed should still be answered")
+	}
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/minimax-agent/telegram-bot/internal/minimax"
+	"github.com/minimax-agent/telegram-bot/internal/telegram"
+)
+
+// streamEditInterval is the least time between two edits of a reply being
+// streamed, keeping well within Telegram's rate limits.
+const streamEditInterval = time.Second
+
+// inbox holds a user's chat messages waiting for a reply.
+type inbox struct {
+	messages []*telegram.Message
+}
+
+// queueChatMessage adds a chat message to the user's inbox. If no reply is
+// being generated for the user, it starts answering the inbox in the
+// background, so that messages sent meanwhile queue up behind it instead
+// of being rejected.
+func (h *Handler) queueChatMessage(ctx context.Context, msg *telegram.Message) error {
+	userID := msg.From.ID
+	limit := h.config().InboxSize
+
+	h.inboxMu.Lock()
+	if h.inboxes == nil {
+		h.inboxes = make(map[int64]*inbox)
+	}
+	box, ok := h.inboxes[userID]
+	if !ok {
+		box = &inbox{}
+		h.inboxes[userID] = box
+	}
+	if limit > 0 && len(box.messages) >= limit {
+		h.inboxMu.Unlock()
+		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("You have %d messages waiting for a reply. Please wait before sending more.", limit))
+		return nil
+	}
+	box.messages = append(box.messages, msg)
+	if h.isProcessing(userID) {
+		h.inboxMu.Unlock()
+		h.log(ctx).Debug("Queued message of user %d behind the reply in progress", userID)
+		return nil
+	}
+	h.setProcessing(userID, true)
+	h.inboxMu.Unlock()
+
+	// The reply outlives the update, so it is tracked for shutdown on its
+	// own, keeping the update's correlation ID
+	replyCtx, done, ok := h.track(context.WithoutCancel(ctx), msg.Chat.ID)
+	if !ok {
+		h.dropInbox(userID)
+		return nil
+	}
+	go func() {
+		defer done()
+		defer func() {
+			if r := recover(); r != nil {
+				updatePanics.Inc()
+				h.log(replyCtx).Error("Panic answering messages of user %d: %v\n%s", userID, r, debug.Stack())
+				h.dropInbox(userID)
+			}
+		}()
+		h.answerInbox(replyCtx, userID)
+	}()
+	return nil
+}
+
+// answerInbox replies to the user's queued messages in order until the
+// inbox is empty.
+func (h *Handler) answerInbox(ctx context.Context, userID int64) {
+	for {
+		if err := h.waitRateLimit(ctx, userID); err != nil {
+			h.dropInbox(userID)
+			return
+		}
+		batch := h.nextBatch(userID)
+		if batch == nil {
+			return
+		}
+		if err := h.reply(ctx, userID, batch); err != nil {
+			h.log(ctx).Error("Failed to reply to user %d: %v", userID, err)
+		}
+		h.updateRateLimit(userID)
+	}
+}
+
+// nextBatch takes the messages to answer next from the user's inbox: the
+// oldest one, followed by those from the same chat if messages are merged.
+// It returns nil and marks the user as idle once the inbox is empty.
+func (h *Handler) nextBatch(userID int64) []*telegram.Message {
+	h.inboxMu.Lock()
+	defer h.inboxMu.Unlock()
+
+	box := h.inboxes[userID]
+	if box == nil || len(box.messages) == 0 {
+		delete(h.inboxes, userID)
+		h.setProcessing(userID, false)
+		return nil
+	}
+
+	n := 1
+	if h.config().MergeMessages {
+		for n < len(box.messages) && box.messages[n].Chat.ID == box.messages[0].Chat.ID {
+			n++
+		}
+	}
+	batch := box.messages[:n:n]
+	box.messages = box.messages[n:]
+	return batch
+}
+
+// dropInbox discards the user's queued messages and marks them as idle.
+func (h *Handler) dropInbox(userID int64) {
+	h.inboxMu.Lock()
+	defer h.inboxMu.Unlock()
+	delete(h.inboxes, userID)
+	h.setProcessing(userID, false)
+}
+
+// waitRateLimit waits until the user may get the next reply.
+func (h *Handler) waitRateLimit(ctx context.Context, userID int64) error {
+	if h.checkRateLimit(userID) {
+		return ctx.Err()
+	}
+
+	h.rateLimitMu.RLock()
+	wait := h.rateLimit - time.Since(h.lastMessageTime[userID])
+	h.rateLimitMu.RUnlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reply answers a batch of chat messages in one conversation turn. The
+// reply is streamed into the thinking message, which carries a Stop button
+// until it is complete.
+func (h *Handler) reply(ctx context.Context, userID int64, batch []*telegram.Message) error {
+	chatID := batch[0].Chat.ID
+	texts := make([]string, len(batch))
+	for i, msg := range batch {
+		texts[i] = msg.Text
+	}
+	if len(batch) > 1 {
+		h.log(ctx).Debug("Answering %d messages of user %d in one turn", len(batch), userID)
+	}
+
+	// Add the user's turn to the conversation, so the reply continues it
+	h.minimaxClient.AddMessage(userID, "user", strings.Join(texts, "\n\n"))
+
+	// Send thinking indicator
+	thinkingMsg, err := h.telegramClient.SendMessage(ctx, telegram.SendMessageParams{
+		ChatID:      chatID,
+		Text:        "🤔 Thinking...",
+		ReplyMarkup: stopKeyboard,
+	})
+	if err != nil {
+		h.log(ctx).Error("Failed to send thinking message: %v", err)
+	}
+
+	genCtx, done := h.startGeneration(ctx, userID)
+	defer done()
+
+	// Stream response from Minimax
+	var text strings.Builder
+	var lastEdit time.Time
+	err = h.minimaxClient.StreamChat(genCtx, minimax.ChatParams{
+		UserID: userID,
+	}, func(chunk string) error {
+		text.WriteString(chunk)
+		if thinkingMsg != nil && time.Since(lastEdit) >= streamEditInterval {
+			lastEdit = time.Now()
+			h.editMessage(ctx, chatID, thinkingMsg.MessageID, text.String(), stopKeyboard)
+		}
+		return nil
+	})
+
+	switch {
+	case err != nil && genCtx.Err() != nil && ctx.Err() == nil:
+		// Stopped by the user; the text so far is kept in the conversation
+		h.log(ctx).Debug("User %d stopped the reply after %d characters", userID, text.Len())
+		if text.Len() == 0 {
+			// Nothing was answered, so drop the question as well
+			h.minimaxClient.RemoveLastMessage(userID)
+			h.finishReply(ctx, chatID, thinkingMsg, "⏹ Stopped.")
+		} else {
+			h.finishReply(ctx, chatID, thinkingMsg, text.String()+"\n\n⏹ Stopped.")
+		}
+		return nil
+	case err != nil && ctx.Err() != nil:
+		// Aborted by shutdown, which tells the user itself
+		return err
+	case err != nil:
+		h.finishReply(ctx, chatID, thinkingMsg, fmt.Sprintf("Sorry, I encountered an error: %v", err))
+		return err
+	}
+
+	h.finishReply(ctx, chatID, thinkingMsg, text.String())
+	return nil
+}
+
+// finishReply replaces the thinking message with the final text, removing
+// the Stop button. Without a thinking message, the text is sent instead;
+// without text, the thinking message is deleted.
+func (h *Handler) finishReply(ctx context.Context, chatID int64, thinkingMsg *telegram.Message, text string) {
+	switch {
+	case thinkingMsg == nil:
+		if text != "" {
+			h.sendMessage(ctx, chatID, text)
+		}
+	case text == "":
+		h.telegramClient.DeleteMessage(ctx, chatID, thinkingMsg.MessageID)
+	default:
+		if err := h.editMessage(ctx, chatID, thinkingMsg.MessageID, text, nil); err != nil {
+			h.sendMessage(ctx, chatID, text)
+		}
+	}
+}
+
+// editMessage replaces the text of a message sent by the bot. A nil
+// keyboard removes the message's keyboard.
+func (h *Handler) editMessage(ctx context.Context, chatID, messageID int64, text string, keyboard *telegram.InlineKeyboardMarkup) error {
+	params := telegram.EditMessageTextParams{
+		ChatID:                chatID,
+		MessageID:             messageID,
+		Text:                  h.truncate(text),
+		DisableWebPagePreview: true,
+	}
+	if keyboard != nil {
+		params.ReplyMarkup = keyboard
+	}
+	if _, err := h.telegramClient.EditMessageText(ctx, params); err != nil {
+		h.log(ctx).Error("Failed to edit message: %v", err)
+		return err
+	}
+	return nil
+}
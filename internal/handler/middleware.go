@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/minimax-agent/telegram-bot/internal/telegram"
+	"github.com/minimax-agent/telegram-bot/pkg/logger"
+	"github.com/minimax-agent/telegram-bot/pkg/metrics"
+)
+
+var (
+	updatesReceived = metrics.NewCounterVec("bot_updates_total",
+		"Telegram updates received, by type.", "type")
+	updateDuration = metrics.NewHistogramVec("bot_update_duration_seconds",
+		"Time spent handling an update, by type and outcome.", nil, "type", "outcome")
+	updatesRejected = metrics.NewCounterVec("bot_updates_rejected_total",
+		"Updates dropped by middleware, by reason.", "reason")
+)
+
+// UpdateHandler handles an update, e.g. Handler.HandleUpdate.
+type UpdateHandler func(ctx context.Context, update telegram.Update) error
+
+// Middleware wraps an UpdateHandler with behaviour of its own, such as
+// logging or access control. It may handle the update before or after
+// calling next, or drop it by not calling next at all.
+type Middleware func(next UpdateHandler) UpdateHandler
+
+// chain wraps handle in middleware, the first one outermost.
+func chain(handle UpdateHandler, middleware ...Middleware) UpdateHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handle = middleware[i](handle)
+	}
+	return handle
+}
+
+// Logging logs every update handled, with its type, how long it took and
+// any error, at debug level.
+func Logging(l *logger.Logger) Middleware {
+	return func(next UpdateHandler) UpdateHandler {
+		return func(ctx context.Context, update telegram.Update) error {
+			start := time.Now()
+			err := next(ctx, update)
+			if err != nil {
+				l.WithContext(ctx).Debug("Handled %s update in %s: %v", updateType(update), time.Since(start), err)
+			} else {
+				l.WithContext(ctx).Debug("Handled %s update in %s", updateType(update), time.Since(start))
+			}
+			return err
+		}
+	}
+}
+
+// Recovery turns a panic while handling an update into an error, logging
+// the stack trace.
+func Recovery(l *logger.Logger) Middleware {
+	return func(next UpdateHandler) UpdateHandler {
+		return func(ctx context.Context, update telegram.Update) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					updatePanics.Inc()
+					l.WithContext(ctx).Error("Panic handling update: %v\n%s", r, debug.Stack())
+					err = fmt.Errorf("panic handling update: %v", r)
+				}
+			}()
+			return next(ctx, update)
+		}
+	}
+}
+
+// Metrics counts updates by type and measures how long they take to
+// handle.
+func Metrics() Middleware {
+	return func(next UpdateHandler) UpdateHandler {
+		return func(ctx context.Context, update telegram.Update) error {
+			typ := updateType(update)
+			updatesReceived.With(typ).Inc()
+
+			start := time.Now()
+			err := next(ctx, update)
+			outcome := "success"
+			if err != nil {
+				outcome = "error"
+			}
+			updateDuration.With(typ, outcome).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// Auth drops updates from users that allow rejects, and updates without a
+// user.
+func Auth(l *logger.Logger, allow func(userID int64) bool) Middleware {
+	return func(next UpdateHandler) UpdateHandler {
+		return func(ctx context.Context, update telegram.Update) error {
+			userID := updateUserID(update)
+			if userID == 0 || !allow(userID) {
+				updatesRejected.With("auth").Inc()
+				l.WithContext(ctx).Debug("Ignoring update from a user not in the allowed users")
+				return nil
+			}
+			return next(ctx, update)
+		}
+	}
+}
+
+// RateLimit drops a user's updates beyond limit within each period.
+// Updates without a user are not limited.
+func RateLimit(l *logger.Logger, limit int, period time.Duration) Middleware {
+	type window struct {
+		start time.Time
+		count int
+	}
+	var (
+		mu        sync.Mutex
+		windows   = make(map[int64]*window)
+		lastSweep = time.Now()
+	)
+	return func(next UpdateHandler) UpdateHandler {
+		return func(ctx context.Context, update telegram.Update) error {
+			userID := updateUserID(update)
+			if userID == 0 {
+				return next(ctx, update)
+			}
+
+			mu.Lock()
+			now := time.Now()
+			// Forget users whose window is over, once per period
+			if now.Sub(lastSweep) >= period {
+				for id, w := range windows {
+					if now.Sub(w.start) >= period {
+						delete(windows, id)
+					}
+				}
+				lastSweep = now
+			}
+			w, ok := windows[userID]
+			if !ok || now.Sub(w.start) >= period {
+				w = &window{start: now}
+				windows[userID] = w
+			}
+			w.count++
+			exceeded := w.count > limit
+			mu.Unlock()
+
+			if exceeded {
+				updatesRejected.With("rate_limit").Inc()
+				l.WithContext(ctx).Debug("Ignoring update from user %d, who sent more than %d in %s", userID, limit, period)
+				return nil
+			}
+			return next(ctx, update)
+		}
+	}
+}
+
+// ChatTypes drops updates from chats other than the given types, e.g.
+// "private", "group", "supergroup" or "channel". Updates without a chat
+// are kept.
+func ChatTypes(l *logger.Logger, types ...string) Middleware {
+	allowed := make(map[string]bool, len(types))
+	for _, t := range types {
+		allowed[t] = true
+	}
+	return func(next UpdateHandler) UpdateHandler {
+		return func(ctx context.Context, update telegram.Update) error {
+			if typ := updateChatType(update); typ != "" && !allowed[typ] {
+				updatesRejected.With("chat_type").Inc()
+				l.WithContext(ctx).Debug("Ignoring update from a %s chat", typ)
+				return nil
+			}
+			return next(ctx, update)
+		}
+	}
+}
+
+// updateType returns the kind of an update, as used in metrics labels.
+func updateType(update telegram.Update) string {
+	switch {
+	case update.Message != nil:
+		return "message"
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	case update.InlineQuery != nil:
+		return "inline_query"
+	}
+	return "other"
+}
+
+// updateUserID returns the user an update came from, or 0 if it has none.
+func updateUserID(update telegram.Update) int64 {
+	var from *telegram.User
+	switch {
+	case update.Message != nil:
+		from = update.Message.From
+	case update.CallbackQuery != nil:
+		from = update.CallbackQuery.From
+	case update.InlineQuery != nil:
+		from = update.InlineQuery.From
+	}
+	if from == nil {
+		return 0
+	}
+	return from.ID
+}
+
+// updateChatType returns the type of the chat an update came from, or ""
+// if it has none.
+func updateChatType(update telegram.Update) string {
+	switch {
+	case update.Message != nil && update.Message.Chat != nil:
+		return update.Message.Chat.Type
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil && update.CallbackQuery.Message.Chat != nil:
+		return update.CallbackQuery.Message.Chat.Type
+	case update.InlineQuery != nil && update.InlineQuery.ChatType == "sender":
+		// An inline query sent from the private chat with the bot
+		return "private"
+	case update.InlineQuery != nil:
+		return update.InlineQuery.ChatType
+	}
+	return ""
+}
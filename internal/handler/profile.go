@@ -0,0 +1,285 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/minimax-agent/telegram-bot/internal/profile"
+	"github.com/minimax-agent/telegram-bot/internal/telegram"
+	"github.com/minimax-agent/telegram-bot/internal/wizard"
+)
+
+const profileUsage = `Usage:
+/profile - List your brand profiles
+/profile show [name] - Show a profile (defaults to the active one)
+/profile save <name> - Save the brand answers of your current wizard
+/profile set <name> <key> <value> - Set one answer, e.g. /profile set acme tone friendly
+/profile unset <name> <key> - Remove one answer
+/profile use <name> - Pre-fill new wizards from this profile
+/profile off - Stop pre-filling wizards
+/profile delete <name> - Delete a profile`
+
+const templateUsage = `Usage:
+/template - List your prompt templates
+/template show <name> - Show a template
+/template save <name> <text> - Save a template, e.g. /template save promo Write a promo for {{.website_name}} aimed at {{.target_audience}}
+/template delete <name> - Delete a template
+
+Use a template with /create <type> --template <name>. Wizard answers are available by question key, e.g. {{.topic}}.`
+
+// handleProfileCommand handles /profile [show|save|set|unset|use|off|delete].
+func (h *Handler) handleProfileCommand(ctx context.Context, msg *telegram.Message, args string) error {
+	userID := msg.From.ID
+	sub, rest := cutWord(args)
+	name, rest := cutWord(rest)
+
+	switch strings.ToLower(sub) {
+	case "", "list":
+		profiles, active, err := h.profiles.Profiles(userID)
+		if err != nil {
+			h.log(ctx).Error("Failed to load profiles: %v", err)
+			h.sendMessage(ctx, msg.Chat.ID, "Sorry, your profiles could not be loaded. Please try again.")
+			return nil
+		}
+		if len(profiles) == 0 {
+			h.sendMessage(ctx, msg.Chat.ID, "You don't have any brand profiles yet.\n\n"+profileUsage)
+			return nil
+		}
+
+		var sb strings.Builder
+		sb.WriteString("Brand profiles:\n\n")
+		for _, p := range profiles {
+			fmt.Fprintf(&sb, "%s (%d answers)", p.Name, len(p.Answers))
+			if p.Name == active {
+				sb.WriteString(" (active)")
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n" + profileUsage)
+		h.sendMessage(ctx, msg.Chat.ID, sb.String())
+
+	case "show":
+		var (
+			p   *profile.Profile
+			err error
+		)
+		if name == "" {
+			p, err = h.profiles.ActiveProfile(userID)
+			if err == nil && p == nil {
+				err = fmt.Errorf("no profile is active")
+			}
+		} else {
+			p, err = h.profiles.Profile(userID, name)
+		}
+		if err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Cannot show profile: %v", err))
+			return nil
+		}
+		h.sendMessage(ctx, msg.Chat.ID, formatProfile(p))
+
+	case "save":
+		if name == "" {
+			h.sendMessage(ctx, msg.Chat.ID, "Usage: /profile save <name>")
+			return nil
+		}
+		wiz, ok := h.wizardManager.GetWizard(userID)
+		if !ok {
+			h.sendMessage(ctx, msg.Chat.ID, "There is no wizard to save answers from. Answer the questions of /create first, or use /profile set.")
+			return nil
+		}
+		answers := wiz.BrandAnswers()
+		if len(answers) == 0 {
+			h.sendMessage(ctx, msg.Chat.ID, "Your current wizard has no brand answers (business, audience, tone) to save yet.")
+			return nil
+		}
+		p, err := h.profiles.SaveProfile(userID, name, answers)
+		if err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Cannot save profile: %v", err))
+			return nil
+		}
+		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("💾 Saved profile %s. Use /profile use %s to pre-fill new wizards with it.\n\n%s", p.Name, p.Name, formatProfile(p)))
+
+	case "set", "unset":
+		key, value := cutWord(rest)
+		key = strings.ReplaceAll(strings.ToLower(key), "-", "_")
+		if name == "" || key == "" || (sub == "set" && value == "") {
+			h.sendMessage(ctx, msg.Chat.ID, "Usage: /profile set <name> <key> <value>\n/profile unset <name> <key>")
+			return nil
+		}
+		if !wizard.IsStepKey(key) {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Unknown question key %q. Keys are shown by /create <type> --help.", key))
+			return nil
+		}
+		if sub == "unset" {
+			value = ""
+		}
+		p, err := h.profiles.SetAnswer(userID, name, key, value)
+		if err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Cannot update profile: %v", err))
+			return nil
+		}
+		h.sendMessage(ctx, msg.Chat.ID, formatProfile(p))
+
+	case "use":
+		if name == "" {
+			h.sendMessage(ctx, msg.Chat.ID, "Usage: /profile use <name>")
+			return nil
+		}
+		if err := h.profiles.UseProfile(userID, name); err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Cannot use profile: %v", err))
+			return nil
+		}
+		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("✅ New wizards will be pre-filled from profile %s.", strings.ToLower(name)))
+
+	case "off":
+		if err := h.profiles.UseProfile(userID, ""); err != nil {
+			h.log(ctx).Error("Failed to deactivate profile: %v", err)
+			h.sendMessage(ctx, msg.Chat.ID, "Sorry, your profile could not be deactivated. Please try again.")
+			return nil
+		}
+		h.sendMessage(ctx, msg.Chat.ID, "New wizards will no longer be pre-filled.")
+
+	case "delete":
+		if name == "" {
+			h.sendMessage(ctx, msg.Chat.ID, "Usage: /profile delete <name>")
+			return nil
+		}
+		if err := h.profiles.DeleteProfile(userID, name); err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Cannot delete profile: %v", err))
+			return nil
+		}
+		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("🗑️ Deleted profile %s.", strings.ToLower(name)))
+
+	default:
+		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Unknown /profile subcommand: %s\n\n%s", sub, profileUsage))
+	}
+
+	return nil
+}
+
+// handleTemplateCommand handles /template [show|save|delete].
+func (h *Handler) handleTemplateCommand(ctx context.Context, msg *telegram.Message, args string) error {
+	userID := msg.From.ID
+	sub, rest := cutWord(args)
+	name, body := cutWord(rest)
+
+	switch strings.ToLower(sub) {
+	case "", "list":
+		templates, err := h.profiles.Templates(userID)
+		if err != nil {
+			h.log(ctx).Error("Failed to load templates: %v", err)
+			h.sendMessage(ctx, msg.Chat.ID, "Sorry, your templates could not be loaded. Please try again.")
+			return nil
+		}
+		if len(templates) == 0 {
+			h.sendMessage(ctx, msg.Chat.ID, "You don't have any prompt templates yet.\n\n"+templateUsage)
+			return nil
+		}
+
+		var sb strings.Builder
+		sb.WriteString("Prompt templates:\n\n")
+		for _, t := range templates {
+			sb.WriteString(t.Name + "\n")
+		}
+		sb.WriteString("\n" + templateUsage)
+		h.sendMessage(ctx, msg.Chat.ID, sb.String())
+
+	case "show":
+		t, err := h.profiles.Template(userID, name)
+		if err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Cannot show template: %v", err))
+			return nil
+		}
+		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Template %s:\n\n%s", t.Name, t.Body))
+
+	case "save":
+		if name == "" || body == "" {
+			h.sendMessage(ctx, msg.Chat.ID, "Usage: /template save <name> <text>")
+			return nil
+		}
+		t, err := h.profiles.SaveTemplate(userID, name, body)
+		if err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Cannot save template: %v", err))
+			return nil
+		}
+		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("💾 Saved template %s. Use it with /create <type> --template %s", t.Name, t.Name))
+
+	case "delete":
+		if err := h.profiles.DeleteTemplate(userID, name); err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Cannot delete template: %v", err))
+			return nil
+		}
+		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("🗑️ Deleted template %s.", strings.ToLower(name)))
+
+	default:
+		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Unknown /template subcommand: %s\n\n%s", sub, templateUsage))
+	}
+
+	return nil
+}
+
+// profileAnswers returns the answers to pre-fill a new wizard with: those of
+// the profile named by --profile, or else of the active profile.
+func (h *Handler) profileAnswers(ctx context.Context, userID int64, args *wizard.Args) (*profile.Profile, error) {
+	if args.Has(wizard.FlagProfile) {
+		return h.profiles.Profile(userID, args.String(wizard.FlagProfile))
+	}
+
+	p, err := h.profiles.ActiveProfile(userID)
+	if err != nil {
+		// Not fatal, the wizard simply asks every question
+		h.log(ctx).Error("Failed to load active profile: %v", err)
+		return nil, nil
+	}
+	return p, nil
+}
+
+// buildPrompt returns the generation prompt of a completed wizard, rendered
+// from the user's template if the wizard was started with --template.
+func (h *Handler) buildPrompt(ctx context.Context, chatID int64, wiz *wizard.Wizard) string {
+	name := wiz.GetFlag(wizard.FlagTemplate)
+	if name == "" {
+		return wiz.BuildPrompt()
+	}
+
+	t, err := h.profiles.Template(wiz.UserID, name)
+	if err == nil {
+		var prompt string
+		if prompt, err = t.Render(wiz.GetAnswers()); err == nil {
+			return prompt
+		}
+	}
+	h.sendMessage(ctx, chatID, fmt.Sprintf("⚠️ Cannot use template %s (%v), using the standard prompt instead.", name, err))
+	return wiz.BuildPrompt()
+}
+
+// formatProfile returns a profile's answers, one per line.
+func formatProfile(p *profile.Profile) string {
+	keys := make([]string, 0, len(p.Answers))
+	for key := range p.Answers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Profile %s:\n", p.Name)
+	for _, key := range keys {
+		fmt.Fprintf(&sb, "\n%s: %s", key, p.Answers[key])
+	}
+	if len(keys) == 0 {
+		sb.WriteString("\n(no answers)")
+	}
+	return sb.String()
+}
+
+// cutWord splits s into its first word and the trimmed remainder.
+func cutWord(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexFunc(s, unicode.IsSpace); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/minimax-agent/telegram-bot/internal/telegram"
+)
+
+// abortGrace is how long aborted requests get to return once their context
+// is cancelled.
+const abortGrace = 5 * time.Second
+
+// interruptedMessage tells a user their request was aborted by a shutdown.
+const interruptedMessage = "⚠️ The bot is restarting and your request was interrupted. Please send it again in a minute."
+
+// request is an update being handled.
+type request struct {
+	chatID int64
+	cancel context.CancelFunc
+}
+
+// begin registers an update as in progress, see track.
+func (h *Handler) begin(ctx context.Context, update telegram.Update) (context.Context, func(), bool) {
+	return h.track(ctx, updateChatID(update))
+}
+
+// track registers work for a chat as in progress and returns the context
+// to do it with and a function to call when done. It reports false once
+// Shutdown has been called.
+func (h *Handler) track(ctx context.Context, chatID int64) (context.Context, func(), bool) {
+	h.inflightMu.Lock()
+	defer h.inflightMu.Unlock()
+	if h.closing {
+		return ctx, nil, false
+	}
+	if h.inflight == nil {
+		h.inflight = make(map[*request]struct{})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r := &request{chatID: chatID, cancel: cancel}
+	h.inflight[r] = struct{}{}
+	h.inflightWG.Add(1)
+
+	return ctx, func() {
+		h.inflightMu.Lock()
+		delete(h.inflight, r)
+		h.inflightMu.Unlock()
+		cancel()
+		h.inflightWG.Done()
+	}, true
+}
+
+// updateChatID returns the chat an update came from, or 0 if it has none.
+func updateChatID(update telegram.Update) int64 {
+	switch {
+	case update.Message != nil && update.Message.Chat != nil:
+		return update.Message.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil && update.CallbackQuery.Message.Chat != nil:
+		return update.CallbackQuery.Message.Chat.ID
+	}
+	return 0
+}
+
+// Shutdown stops the handler from accepting updates and waits for those in
+// progress to finish. Requests still running when ctx is done are
+// cancelled, and their users are asked to send them again; Shutdown then
+// returns an error saying how many were aborted.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.inflightMu.Lock()
+	h.closing = true
+	h.inflightMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.inflightWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	h.inflightMu.Lock()
+	chatIDs := make([]int64, 0, len(h.inflight))
+	for r := range h.inflight {
+		r.cancel()
+		chatIDs = append(chatIDs, r.chatID)
+	}
+	h.inflightMu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(abortGrace):
+		h.logger.Warn("Aborted requests did not return within %s", abortGrace)
+	}
+
+	h.notifyInterrupted(chatIDs)
+	return fmt.Errorf("aborted %d requests in progress: %w", len(chatIDs), ctx.Err())
+}
+
+// NotifyDropped asks the users of updates that were received but never
+// handled, such as those Dispatcher.Shutdown dropped, to send them again.
+func (h *Handler) NotifyDropped(updates []telegram.Update) {
+	chatIDs := make([]int64, 0, len(updates))
+	for _, update := range updates {
+		chatIDs = append(chatIDs, updateChatID(update))
+	}
+	h.notifyInterrupted(chatIDs)
+}
+
+// notifyInterrupted sends each chat the notice that its request was
+// interrupted, once per shutdown. It uses its own context, as it runs
+// after the shutdown deadline.
+func (h *Handler) notifyInterrupted(chatIDs []int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, chatID := range chatIDs {
+		h.inflightMu.Lock()
+		if h.notified == nil {
+			h.notified = make(map[int64]bool)
+		}
+		skip := chatID == 0 || h.notified[chatID]
+		h.notified[chatID] = true
+		h.inflightMu.Unlock()
+
+		if !skip {
+			h.sendMessage(ctx, chatID, interruptedMessage)
+		}
+	}
+}
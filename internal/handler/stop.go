@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/minimax-agent/telegram-bot/internal/telegram"
+)
+
+// callbackStop is the callback data of the Stop button on a reply being
+// generated.
+const callbackStop = "chat:stop"
+
+// stopKeyboard is the keyboard with the Stop button.
+var stopKeyboard = &telegram.InlineKeyboardMarkup{
+	InlineKeyboard: [][]telegram.InlineKeyboardButton{{
+		{Text: "⏹ Stop", CallbackData: callbackStop},
+	}},
+}
+
+// startGeneration registers a reply being generated for a user and returns
+// the context to generate it with, cancelled by stopGeneration, and a
+// function to call when done.
+func (h *Handler) startGeneration(ctx context.Context, userID int64) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	h.generationsMu.Lock()
+	if h.generations == nil {
+		h.generations = make(map[int64]context.CancelFunc)
+	}
+	h.generations[userID] = cancel
+	h.generationsMu.Unlock()
+
+	return ctx, func() {
+		h.generationsMu.Lock()
+		delete(h.generations, userID)
+		h.generationsMu.Unlock()
+		cancel()
+	}
+}
+
+// stopGeneration cancels the reply being generated for a user. It reports
+// false if there is none.
+func (h *Handler) stopGeneration(userID int64) bool {
+	h.generationsMu.Lock()
+	cancel, ok := h.generations[userID]
+	h.generationsMu.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// handleStop handles /stop, which cancels the reply being generated.
+// Messages queued behind it are still answered.
+func (h *Handler) handleStop(ctx context.Context, msg *telegram.Message, args string) error {
+	if !h.stopGeneration(msg.From.ID) {
+		h.sendMessage(ctx, msg.Chat.ID, "Nothing to stop.")
+	}
+	return nil
+}
+
+// handleStopCallback handles the Stop button.
+func (h *Handler) handleStopCallback(ctx context.Context, query *telegram.CallbackQuery) error {
+	h.stopGeneration(query.From.ID)
+	return nil
+}
+
+// isStopUpdate reports whether an update is /stop or a press of the Stop
+// button. Dispatcher handles these outside the chat's queue, as the update
+// they stop holds it up.
+func isStopUpdate(update telegram.Update) bool {
+	switch {
+	case update.Message != nil:
+		fields := strings.Fields(update.Message.Text)
+		if len(fields) == 0 {
+			return false
+		}
+		command, _, _ := strings.Cut(fields[0], "@")
+		return strings.EqualFold(command, "/stop")
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.Data == callbackStop
+	}
+	return false
+}
@@ -0,0 +1,568 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minimax-agent/telegram-bot/internal/minimax"
+	"github.com/minimax-agent/telegram-bot/internal/telegram"
+	"github.com/minimax-agent/telegram-bot/internal/wizard"
+)
+
+// refinePrompt asks the model to revise the previous draft.
+const refinePrompt = `Revise the content above as follows: %s
+
+Reply with the complete revised content only.`
+
+// constraintPrompt asks the model to fix content that breaks platform limits.
+const constraintPrompt = `The content above breaks these requirements:
+
+%s
+
+Rewrite it so that it meets every requirement. Reply with the complete corrected content only.`
+
+// stoppedDraftText replaces the progress message of a first draft the user
+// stopped, which ends the wizard.
+const stoppedDraftText = "⏹ Stopped. Use /create to start a new wizard."
+
+// maxVariants caps how many alternatives a single -n request may ask for.
+const maxVariants = 5
+
+// handleWizardMessage handles a message in an active wizard session.
+func (h *Handler) handleWizardMessage(ctx context.Context, msg *telegram.Message, wiz *wizard.Wizard) error {
+	// While variants are on offer, a number picks one
+	if wiz.HasVariants() {
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(msg.Text), "#"))
+		if err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, "Please pick a variant using the buttons above, or reply with its number.")
+			return nil
+		}
+		return h.selectVariant(ctx, msg.Chat.ID, wiz, n)
+	}
+
+	// Once content has been generated, messages are edit instructions
+	if wiz.IsRefining() {
+		return h.refineDraft(ctx, msg, wiz)
+	}
+
+	// Get current question key
+	key := wiz.GetCurrentKey()
+
+	// Save the answer
+	wiz.SetAnswer(key, msg.Text)
+
+	// Check if wizard is complete
+	if wiz.IsComplete() {
+		return h.completeWizard(ctx, msg.Chat.ID, wiz)
+	}
+
+	// Get next question
+	nextQuestion := wiz.GetCurrentQuestion()
+	progress := wiz.GetProgress()
+	h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Got it! %s\n\n%s\n\n(Type /cancel to cancel the wizard)", progress, nextQuestion))
+	return nil
+}
+
+// completeWizard fills in any unanswered questions, such as the optional
+// ones skipped in quick mode, and generates the first draft.
+func (h *Handler) completeWizard(ctx context.Context, chatID int64, wiz *wizard.Wizard) error {
+	return h.stoppable(ctx, chatID, wiz.UserID, "Generating content based on your answers...", stoppedDraftText, func(ctx context.Context) error {
+		if missing := wiz.MissingSteps(); len(missing) > 0 {
+			wiz.Prefill(h.inferAnswers(ctx, wiz, missing))
+		}
+		return h.generateDraft(ctx, chatID, wiz, h.buildPrompt(ctx, chatID, wiz))
+	})
+}
+
+// stoppable sends a progress message with the Stop button and runs generate
+// with a context that /stop and the button cancel. Once generate returns,
+// the button is removed, and the message is replaced with stopped if the
+// user stopped the generation. generate must not send anything once its
+// context is done.
+func (h *Handler) stoppable(ctx context.Context, chatID, userID int64, progress, stopped string, generate func(ctx context.Context) error) error {
+	msg, err := h.telegramClient.SendMessage(ctx, telegram.SendMessageParams{
+		ChatID:      chatID,
+		Text:        progress,
+		ReplyMarkup: stopKeyboard,
+	})
+	if err != nil {
+		h.log(ctx).Error("Failed to send progress message: %v", err)
+	}
+
+	genCtx, done := h.startGeneration(ctx, userID)
+	err = generate(genCtx)
+	userStopped := err != nil && genCtx.Err() != nil && ctx.Err() == nil
+	done()
+
+	if userStopped {
+		h.log(ctx).Debug("User %d stopped the generation", userID)
+		h.finishReply(ctx, chatID, msg, stopped)
+		return nil
+	}
+	if msg != nil && ctx.Err() == nil {
+		h.editMessage(ctx, chatID, msg.MessageID, progress, nil)
+	}
+	return err
+}
+
+// inferAnswers asks the model to suggest answers for the missing steps
+// based on the answers given, falling back to the step defaults.
+func (h *Handler) inferAnswers(ctx context.Context, wiz *wizard.Wizard, missing []wizard.WizardStep) map[string]string {
+	response, err := h.minimaxClient.Chat(ctx, minimax.ChatParams{
+		UserID: wiz.UserID,
+		Messages: []minimax.Message{
+			{Role: "user", Content: wiz.InferPrompt(missing)},
+		},
+	})
+	if err != nil {
+		h.log(ctx).Warn("Failed to infer wizard answers, using defaults: %v", err)
+		return wizard.DefaultAnswers(missing)
+	}
+	if len(response.Choices) == 0 {
+		return wizard.DefaultAnswers(missing)
+	}
+	return wizard.ParseInferred(response.Choices[0].Message.Content, missing)
+}
+
+// generateDraft generates the first draft for a wizard and keeps the
+// session open so the user can refine it. If the wizard was started with
+// -n, several variants are generated for the user to choose from instead.
+func (h *Handler) generateDraft(ctx context.Context, chatID int64, wiz *wizard.Wizard, prompt string) error {
+	if n, _ := strconv.Atoi(wiz.GetFlag(wizard.FlagCount)); n > 1 {
+		return h.generateVariants(ctx, chatID, wiz, prompt, n)
+	}
+
+	response, err := h.minimaxClient.Chat(ctx, minimax.ChatParams{
+		UserID: wiz.UserID,
+		Messages: []minimax.Message{
+			{Role: "user", Content: prompt},
+		},
+	})
+	if err != nil {
+		h.wizardManager.EndWizard(wiz.UserID)
+		if ctx.Err() == nil {
+			h.sendMessage(ctx, chatID, fmt.Sprintf("Error generating content: %v", err))
+		}
+		return err
+	}
+
+	if len(response.Choices) == 0 {
+		h.wizardManager.EndWizard(wiz.UserID)
+		h.sendMessage(ctx, chatID, "No content was generated. Please try again.")
+		return nil
+	}
+
+	messages := []minimax.Message{{Role: "user", Content: prompt}}
+	content := h.enforceConstraints(ctx, wiz, messages, response.Choices[0].Message.Content)
+	if err := ctx.Err(); err != nil {
+		h.wizardManager.EndWizard(wiz.UserID)
+		return err
+	}
+
+	wiz.SetPrompt(prompt)
+	draft := wiz.AddDraft(content, "")
+	h.sendDraft(ctx, chatID, wiz, draft)
+	return nil
+}
+
+// generateVariants generates n alternatives and asks the user to pick one.
+func (h *Handler) generateVariants(ctx context.Context, chatID int64, wiz *wizard.Wizard, prompt string, n int) error {
+	messages := []minimax.Message{{Role: "user", Content: prompt}}
+	variants, err := h.chatVariants(ctx, wiz.UserID, messages, n)
+	if err != nil {
+		h.wizardManager.EndWizard(wiz.UserID)
+		if ctx.Err() == nil {
+			h.sendMessage(ctx, chatID, fmt.Sprintf("Error generating content: %v", err))
+		}
+		return err
+	}
+	for i, variant := range variants {
+		variants[i] = h.enforceConstraints(ctx, wiz, messages, variant)
+	}
+	if err := ctx.Err(); err != nil {
+		h.wizardManager.EndWizard(wiz.UserID)
+		return err
+	}
+
+	wiz.SetPrompt(prompt)
+	wiz.SetVariants(variants)
+
+	buttons := make([]telegram.InlineKeyboardButton, len(variants))
+	for i, variant := range variants {
+		h.sendMessage(ctx, chatID, fmt.Sprintf("Variant #%d:\n\n%s", i+1, variant))
+		buttons[i] = telegram.InlineKeyboardButton{
+			Text:         fmt.Sprintf("#%d", i+1),
+			CallbackData: callbackVariantPrefix + strconv.Itoa(i+1),
+		}
+	}
+
+	_, err = h.telegramClient.SendMessage(ctx, telegram.SendMessageParams{
+		ChatID:      chatID,
+		Text:        "Which variant would you like to keep? It becomes the draft you can refine further.",
+		ReplyMarkup: telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{buttons}},
+	})
+	if err != nil {
+		h.log(ctx).Error("Failed to send variant picker: %v", err)
+	}
+	return nil
+}
+
+// chatVariants returns n completions for the messages. Minimax is asked for
+// n choices in one request; any shortfall is made up with parallel requests.
+func (h *Handler) chatVariants(ctx context.Context, userID int64, messages []minimax.Message, n int) ([]string, error) {
+	response, err := h.minimaxClient.Chat(ctx, minimax.ChatParams{
+		UserID:   userID,
+		Messages: messages,
+		N:        n,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	variants := make([]string, 0, n)
+	for _, choice := range response.Choices {
+		if len(variants) < n && choice.Message.Content != "" {
+			variants = append(variants, choice.Message.Content)
+		}
+	}
+
+	missing := n - len(variants)
+	if missing <= 0 {
+		return variants, nil
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+	)
+	for i := 0; i < missing; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := h.minimaxClient.Chat(ctx, minimax.ChatParams{
+				UserID:   userID,
+				Messages: messages,
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			if len(response.Choices) > 0 && response.Choices[0].Message.Content != "" {
+				variants = append(variants, response.Choices[0].Message.Content)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(variants) == 0 {
+		if len(errs) > 0 {
+			return nil, errs[0]
+		}
+		return nil, fmt.Errorf("no content was generated")
+	}
+	if len(errs) > 0 {
+		h.log(ctx).Warn("Generated %d of %d variants: %v", len(variants), n, errs[0])
+	}
+	return variants, nil
+}
+
+// selectVariant makes the chosen variant the first draft.
+func (h *Handler) selectVariant(ctx context.Context, chatID int64, wiz *wizard.Wizard, n int) error {
+	draft, err := wiz.SelectVariant(n)
+	if err != nil {
+		h.sendMessage(ctx, chatID, fmt.Sprintf("Cannot select variant: %v", err))
+		return nil
+	}
+	h.sendDraft(ctx, chatID, wiz, draft)
+	return nil
+}
+
+// handleVariantCallback handles a press of one of the variant picker buttons.
+func (h *Handler) handleVariantCallback(ctx context.Context, query *telegram.CallbackQuery) error {
+	if query.Message == nil || query.Message.Chat == nil {
+		return nil
+	}
+	chatID := query.Message.Chat.ID
+
+	wiz, ok := h.wizardManager.GetWizard(query.From.ID)
+	if !ok || !wiz.HasVariants() {
+		h.sendMessage(ctx, chatID, "Those variants are no longer available.")
+		return nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(query.Data, callbackVariantPrefix))
+	if err != nil {
+		return nil
+	}
+	return h.selectVariant(ctx, chatID, wiz, n)
+}
+
+// refineDraft revises the current draft according to the user's instruction.
+func (h *Handler) refineDraft(ctx context.Context, msg *telegram.Message, wiz *wizard.Wizard) error {
+	return h.stoppable(ctx, msg.Chat.ID, wiz.UserID, "Revising your draft...", "⏹ Stopped. Your draft is unchanged.", func(ctx context.Context) error {
+		return h.reviseDraft(ctx, msg, wiz)
+	})
+}
+
+// reviseDraft asks the model for the revision refineDraft waits for.
+func (h *Handler) reviseDraft(ctx context.Context, msg *telegram.Message, wiz *wizard.Wizard) error {
+	current, _ := wiz.CurrentDraft()
+
+	messages := []minimax.Message{
+		{Role: "user", Content: wiz.GetPrompt()},
+		{Role: "assistant", Content: current.Content},
+		{Role: "user", Content: fmt.Sprintf(refinePrompt, msg.Text)},
+	}
+	response, err := h.minimaxClient.Chat(ctx, minimax.ChatParams{
+		UserID:   wiz.UserID,
+		Messages: messages,
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Error revising content: %v", err))
+		}
+		return err
+	}
+
+	if len(response.Choices) == 0 {
+		h.sendMessage(ctx, msg.Chat.ID, "No revision was generated. Please try again.")
+		return nil
+	}
+
+	content := h.enforceConstraints(ctx, wiz, messages, response.Choices[0].Message.Content)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	draft := wiz.AddDraft(content, msg.Text)
+	h.sendDraft(ctx, msg.Chat.ID, wiz, draft)
+	return nil
+}
+
+// enforceConstraints checks generated content against the wizard's
+// constraints and asks the model to fix any violations, up to the
+// configured number of regeneration attempts. messages is the conversation that produced
+// the content. The best effort is returned even if violations remain.
+func (h *Handler) enforceConstraints(ctx context.Context, wiz *wizard.Wizard, messages []minimax.Message, content string) string {
+	violations := wiz.Violations(content)
+	for attempt := 0; attempt < h.config().MaxRegenerationAttempts && len(violations) > 0; attempt++ {
+		h.log(ctx).Debug("Regenerating %s content for user %d: %s", wiz.ContentType, wiz.UserID, strings.Join(violations, " "))
+
+		retry := make([]minimax.Message, len(messages), len(messages)+2)
+		copy(retry, messages)
+		retry = append(retry,
+			minimax.Message{Role: "assistant", Content: content},
+			minimax.Message{Role: "user", Content: fmt.Sprintf(constraintPrompt, "- "+strings.Join(violations, "\n- "))},
+		)
+
+		response, err := h.minimaxClient.Chat(ctx, minimax.ChatParams{
+			UserID:   wiz.UserID,
+			Messages: retry,
+		})
+		if err != nil {
+			h.log(ctx).Warn("Failed to regenerate content within limits: %v", err)
+			break
+		}
+		if len(response.Choices) == 0 || response.Choices[0].Message.Content == "" {
+			break
+		}
+
+		content = response.Choices[0].Message.Content
+		violations = wiz.Violations(content)
+	}
+	return content
+}
+
+// sendDraft sends a draft followed by instructions for refining it, warning
+// about any limits of the content type it still breaks.
+func (h *Handler) sendDraft(ctx context.Context, chatID int64, wiz *wizard.Wizard, draft wizard.Draft) {
+	h.sendMessage(ctx, chatID, draft.Content)
+	if violations := wiz.Violations(draft.Content); len(violations) > 0 {
+		h.sendMessage(ctx, chatID, "⚠️ This draft still breaks some limits:\n\n- "+strings.Join(violations, "\n- "))
+	}
+	h.sendMessage(ctx, chatID, fmt.Sprintf("✏️ Draft v%d. Reply with changes to refine it (e.g. \"make the CTA punchier\"), use /draft to compare or roll back versions, or /done to finish.", draft.Version))
+}
+
+// handleDraftCommand handles /draft [list|show N|diff A [B]|rollback N|done].
+func (h *Handler) handleDraftCommand(ctx context.Context, msg *telegram.Message, args string) error {
+	wiz, ok := h.wizardManager.GetWizard(msg.From.ID)
+	if !ok || !wiz.IsRefining() {
+		h.sendMessage(ctx, msg.Chat.ID, "You don't have a draft to refine. Use /create to generate one.")
+		return nil
+	}
+
+	parts := strings.Fields(args)
+	sub := "list"
+	if len(parts) > 0 {
+		sub = strings.ToLower(parts[0])
+	}
+
+	switch sub {
+	case "list":
+		drafts := wiz.GetDrafts()
+		var sb strings.Builder
+		sb.WriteString("Draft versions:\n\n")
+		for _, d := range drafts {
+			sb.WriteString(d.Summary())
+			if d.Version == len(drafts) {
+				sb.WriteString(" (current)")
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\nUsage:\n/draft show <n>\n/draft diff <a> [b]\n/draft rollback <n>\n/done")
+		h.sendMessage(ctx, msg.Chat.ID, sb.String())
+
+	case "show":
+		draft, err := h.draftArg(wiz, parts, 1)
+		if err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Cannot show draft: %v", err))
+			return nil
+		}
+		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Draft v%d:\n\n%s", draft.Version, draft.Content))
+
+	case "diff":
+		from, err := h.draftArg(wiz, parts, 1)
+		if err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Cannot compare drafts: %v", err))
+			return nil
+		}
+		to, err := h.draftArg(wiz, parts, 2)
+		if err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Cannot compare drafts: %v", err))
+			return nil
+		}
+		h.sendMessage(ctx, msg.Chat.ID, wizard.DiffDrafts(from, to))
+
+	case "rollback":
+		if len(parts) < 2 {
+			h.sendMessage(ctx, msg.Chat.ID, "Usage: /draft rollback <n>")
+			return nil
+		}
+		version, err := strconv.Atoi(parts[1])
+		if err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Invalid version: %s", parts[1]))
+			return nil
+		}
+		draft, err := wiz.Rollback(version)
+		if err != nil {
+			h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Cannot roll back: %v", err))
+			return nil
+		}
+		h.sendDraft(ctx, msg.Chat.ID, wiz, draft)
+
+	case "done":
+		h.wizardManager.CompleteWizard(msg.From.ID)
+		h.sendMessage(ctx, msg.Chat.ID, "✅ Done! Your final draft is above.")
+
+	default:
+		h.sendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Unknown /draft subcommand: %s", sub))
+	}
+
+	return nil
+}
+
+// draftArg returns the draft whose version is parts[i], or the current
+// draft when the argument is omitted.
+func (h *Handler) draftArg(wiz *wizard.Wizard, parts []string, i int) (wizard.Draft, error) {
+	if i >= len(parts) {
+		draft, _ := wiz.CurrentDraft()
+		return draft, nil
+	}
+
+	version, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(parts[i]), "v"))
+	if err != nil {
+		return wizard.Draft{}, fmt.Errorf("invalid version %q", parts[i])
+	}
+
+	draft, ok := wiz.GetDraft(version)
+	if !ok {
+		return wizard.Draft{}, fmt.Errorf("no draft v%d, use /draft to list versions", version)
+	}
+	return draft, nil
+}
+
+// resumeWizard reactivates a timed-out wizard from its saved answers.
+func (h *Handler) resumeWizard(ctx context.Context, query *telegram.CallbackQuery) error {
+	if query.Message == nil || query.Message.Chat == nil {
+		return nil
+	}
+	chatID := query.Message.Chat.ID
+
+	wiz, ok := h.wizardManager.Resume(query.From.ID)
+	if !ok {
+		h.sendMessage(ctx, chatID, "That wizard session is no longer available. Use /create to start a new one.")
+		return nil
+	}
+
+	if wiz.HasVariants() {
+		h.sendMessage(ctx, chatID, fmt.Sprintf("Resuming your %s wizard! Reply with the number of the variant you'd like to keep (1-%d).",
+			wiz.ContentType, len(wiz.GetVariants())))
+		return nil
+	}
+
+	if wiz.IsRefining() {
+		draft, _ := wiz.CurrentDraft()
+		h.sendMessage(ctx, chatID, fmt.Sprintf("Resuming your %s draft (v%d). Reply with changes to refine it, or /done to finish.",
+			wiz.ContentType, draft.Version))
+		return nil
+	}
+
+	h.sendMessage(ctx, chatID, fmt.Sprintf("Resuming your %s wizard! %s\n\n%s\n\n(Type /cancel to cancel the wizard)",
+		wiz.ContentType, wiz.GetProgress(), wiz.GetCurrentQuestion()))
+	return nil
+}
+
+// wizardReminder warns the user that their wizard is about to time out.
+func (h *Handler) wizardReminder(ctx context.Context, wiz *wizard.Wizard, remaining time.Duration) {
+	if wiz.IsRefining() {
+		h.sendMessage(ctx, wiz.ChatID, fmt.Sprintf("⏳ Your %s draft will be closed in %s. Reply with changes to keep refining it.",
+			wiz.ContentType, formatDuration(remaining)))
+		return
+	}
+
+	h.sendMessage(ctx, wiz.ChatID, fmt.Sprintf("⏳ Your %s wizard will time out in %s. Answer the last question to keep going:\n\n%s",
+		wiz.ContentType, formatDuration(remaining), wiz.GetCurrentQuestion()))
+}
+
+// wizardExpired tells the user their wizard timed out and offers to resume it.
+func (h *Handler) wizardExpired(ctx context.Context, wiz *wizard.Wizard) {
+	text := fmt.Sprintf("⌛ Your %s wizard timed out after %s of inactivity. Your answers so far have been saved.",
+		wiz.ContentType, formatDuration(h.wizardManager.Timeout()))
+	if wiz.IsRefining() {
+		text = fmt.Sprintf("⌛ Your %s draft was closed after %s of inactivity. All draft versions have been saved.",
+			wiz.ContentType, formatDuration(h.wizardManager.Timeout()))
+	}
+
+	_, err := h.telegramClient.SendMessage(ctx, telegram.SendMessageParams{
+		ChatID: wiz.ChatID,
+		Text:   text,
+		ReplyMarkup: telegram.InlineKeyboardMarkup{
+			InlineKeyboard: [][]telegram.InlineKeyboardButton{
+				{{Text: "Resume wizard", CallbackData: callbackWizardResume}},
+			},
+		},
+	})
+	if err != nil {
+		h.log(ctx).Error("Failed to send wizard timeout notice: %v", err)
+	}
+}
+
+// formatDuration formats a duration rounded to whole minutes, or seconds
+// when under a minute.
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
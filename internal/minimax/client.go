@@ -8,12 +8,33 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/minimax-agent/telegram-bot/pkg/logger"
+	"github.com/minimax-agent/telegram-bot/pkg/metrics"
 )
 
+var (
+	// requestDuration measures chat completion requests, streamed ones
+	// until the last chunk.
+	requestDuration = metrics.NewHistogramVec("minimax_request_duration_seconds",
+		"Duration of Minimax chat completion requests, by method and outcome.",
+		[]float64{.25, .5, 1, 2.5, 5, 10, 20, 30, 60, 120}, "method", "outcome")
+	tokensUsed = metrics.NewCounterVec("minimax_tokens_total",
+		"Tokens used by Minimax chat completions, by type.", "type")
+)
+
+// observeRequest records the duration of a request started at start.
+func observeRequest(method string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	requestDuration.With(method, outcome).Observe(time.Since(start).Seconds())
+}
+
 // Client represents a Minimax AI API client.
 type Client struct {
 	mu         sync.RWMutex
@@ -48,6 +69,9 @@ func NewClient(apiKey string, opts ...ClientOption) (*Client, error) {
 	for _, opt := range opts {
 		opt(client)
 	}
+	// Debug output includes request URLs and bodies, so keep the
+	// credentials out of it whichever logger is used.
+	client.logger = client.logger.WithSecrets(apiKey)
 
 	return client, nil
 }
@@ -98,6 +122,39 @@ func WithLogger(l *logger.Logger) ClientOption {
 	}
 }
 
+// SetModel changes the model used by subsequent requests.
+func (c *Client) SetModel(model string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.model = model
+}
+
+// SetTimeout changes the timeout of subsequent requests.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeout = timeout
+	// Copy the client rather than racing with requests in flight
+	httpClient := *c.httpClient
+	httpClient.Timeout = timeout
+	c.httpClient = &httpClient
+}
+
+// Model returns the model used for requests.
+func (c *Client) Model() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.model
+}
+
+// transport returns the request timeout and HTTP client, which may change
+// while the client is in use.
+func (c *Client) transport() (time.Duration, *http.Client) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.timeout, c.httpClient
+}
+
 // Message represents a message in the conversation.
 type Message struct {
 	Role    string `json:"role"`
@@ -152,8 +209,17 @@ type ChatRequest struct {
 	Temperature float64   `json:"temperature,omitempty"`
 	MaxTokens   int       `json:"max_tokens,omitempty"`
 	TopP        float64   `json:"top_p,omitempty"`
+	N           int       `json:"n,omitempty"`
 	Stream      bool      `json:"stream,omitempty"`
 	Stop        []string  `json:"stop,omitempty"`
+	// StreamOptions configures a streamed response.
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
+
+// StreamOptions configures a streamed chat completion.
+type StreamOptions struct {
+	// IncludeUsage asks for the token usage in the last chunk.
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // ChatResponse represents a chat completion response.
@@ -204,6 +270,8 @@ type ChatParams struct {
 	MaxTokens int
 	// TopP controls nucleus sampling
 	TopP float64
+	// N requests this many alternative completions (choices)
+	N int
 	// ClearConversation clears the conversation history before this request
 	ClearConversation bool
 	// SystemPrompt sets a custom system prompt
@@ -239,7 +307,7 @@ func (c *Client) Chat(ctx context.Context, params ChatParams) (*ChatResponse, er
 
 	// Build request
 	req := ChatRequest{
-		Model:    c.model,
+		Model:    c.Model(),
 		Messages: messages,
 	}
 
@@ -260,8 +328,14 @@ func (c *Client) Chat(ctx context.Context, params ChatParams) (*ChatResponse, er
 		req.TopP = params.TopP
 	}
 
+	if params.N > 1 {
+		req.N = params.N
+	}
+
 	// Send request
+	start := time.Now()
 	data, err := c.doRequest(ctx, "/text/chatcompletion_v2", req)
+	observeRequest("chat", start, err)
 	if err != nil {
 		return nil, err
 	}
@@ -271,6 +345,8 @@ func (c *Client) Chat(ctx context.Context, params ChatParams) (*ChatResponse, er
 	if err := json.Unmarshal(data, &response); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
+	tokensUsed.With("prompt").Add(float64(response.Usage.PromptTokens))
+	tokensUsed.With("completion").Add(float64(response.Usage.CompletionTokens))
 
 	// Add assistant response to conversation history
 	if params.Messages == nil {
@@ -283,8 +359,12 @@ func (c *Client) Chat(ctx context.Context, params ChatParams) (*ChatResponse, er
 	return &response, nil
 }
 
-// StreamChat sends a chat completion request with streaming response.
-func (c *Client) StreamChat(ctx context.Context, params ChatParams, onChunk func(string) error) error {
+// StreamChat sends a chat completion request with streaming response,
+// calling onChunk with each piece of the reply. Without Messages, the reply
+// is added to the user's conversation as one message once it is complete,
+// or with the text received so far if ctx is cancelled mid-stream, in
+// which case the context's error is returned.
+func (c *Client) StreamChat(ctx context.Context, params ChatParams, onChunk func(string) error) (err error) {
 	// Build messages
 	messages := params.Messages
 
@@ -297,10 +377,14 @@ func (c *Client) StreamChat(ctx context.Context, params ChatParams, onChunk func
 		return fmt.Errorf("no messages provided")
 	}
 
+	start := time.Now()
+	defer func() { observeRequest("stream", start, err) }()
+
 	req := ChatRequest{
-		Model:    c.model,
-		Messages: messages,
-		Stream:   true,
+		Model:         c.Model(),
+		Messages:      messages,
+		Stream:        true,
+		StreamOptions: &StreamOptions{IncludeUsage: true},
 	}
 
 	if params.Temperature > 0 {
@@ -331,7 +415,14 @@ func (c *Client) StreamChat(ctx context.Context, params ChatParams, onChunk func
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
 
-	resp, err := c.httpClient.Do(httpReq)
+	log := c.logger.WithContext(ctx)
+	if c.debug {
+		log.Debug("Minimax Request: %s %s", httpReq.Method, httpReq.URL.String())
+		log.Debug("Minimax Body: %s", string(jsonData))
+	}
+
+	_, httpClient := c.transport()
+	resp, err := httpClient.Do(httpReq)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -339,6 +430,9 @@ func (c *Client) StreamChat(ctx context.Context, params ChatParams, onChunk func
 
 	if resp.StatusCode != http.StatusOK {
 		data, _ := io.ReadAll(resp.Body)
+		if c.debug {
+			log.Debug("Minimax Response: %s", string(data))
+		}
 		var errResp ErrorResponse
 		if json.Unmarshal(data, &errResp) == nil {
 			return fmt.Errorf("minimax API error: %s", errResp.Error.Message)
@@ -346,7 +440,18 @@ func (c *Client) StreamChat(ctx context.Context, params ChatParams, onChunk func
 		return fmt.Errorf("minimax API error: %s", string(data))
 	}
 
-	// Read streaming response
+	// Read streaming response, keeping the reply for the conversation
+	var reply strings.Builder
+	if params.Messages == nil {
+		defer func() {
+			if reply.Len() > 0 && (err == nil || ctx.Err() != nil) {
+				c.getOrCreateConversation(params.UserID).AddMessage("assistant", reply.String())
+			}
+		}()
+	}
+
+	// The usage comes with the last chunk or in a chunk of its own after it
+	var finished, counted bool
 	decoder := json.NewDecoder(resp.Body)
 	for {
 		var chunk struct {
@@ -356,38 +461,75 @@ func (c *Client) StreamChat(ctx context.Context, params ChatParams, onChunk func
 				} `json:"delta"`
 				FinishReason string `json:"finish_reason"`
 			} `json:"choices"`
+			Usage *Usage `json:"usage"`
 		}
 
 		if err := decoder.Decode(&chunk); err != nil {
 			if err == io.EOF {
 				break
 			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			return fmt.Errorf("failed to decode chunk: %w", err)
 		}
 
 		if len(chunk.Choices) > 0 {
 			content := chunk.Choices[0].Delta.Content
 			if content != "" {
+				reply.WriteString(content)
 				if err := onChunk(content); err != nil {
 					return err
 				}
-
-				// Add to conversation history
-				if params.Messages == nil {
-					conv := c.getOrCreateConversation(params.UserID)
-					conv.AddMessage("assistant", content)
-				}
 			}
 
 			if chunk.Choices[0].FinishReason != "" {
-				break
+				finished = true
 			}
 		}
+		if chunk.Usage != nil && !counted {
+			tokensUsed.With("prompt").Add(float64(chunk.Usage.PromptTokens))
+			tokensUsed.With("completion").Add(float64(chunk.Usage.CompletionTokens))
+			counted = true
+		}
+		if finished && counted {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Ping checks that the API can be reached within ctx's deadline. The API
+// has no health endpoint, so any response other than a server error
+// counts as reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
 	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 
+	_, httpClient := c.transport()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the Minimax API: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("minimax API returned %s", resp.Status)
+	}
 	return nil
 }
 
+// ConversationCount returns the number of users with a conversation
+// history.
+func (c *Client) ConversationCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.conversations)
+}
+
 // ClearConversation clears the conversation history for a user.
 func (c *Client) ClearConversation(userID int64) {
 	c.mu.Lock()
@@ -395,6 +537,29 @@ func (c *Client) ClearConversation(userID int64) {
 	delete(c.conversations, userID)
 }
 
+// AddMessage appends a message to a user's conversation history, e.g. the
+// user's message before Chat is called without Messages to reply to it.
+func (c *Client) AddMessage(userID int64, role, content string) {
+	c.getOrCreateConversation(userID).AddMessage(role, content)
+}
+
+// RemoveLastMessage removes the latest message from a user's conversation
+// history, e.g. a question whose reply was cancelled before any text.
+func (c *Client) RemoveLastMessage(userID int64) {
+	c.mu.RLock()
+	conv, ok := c.conversations[userID]
+	c.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	conv.mu.Lock()
+	defer conv.mu.Unlock()
+	if n := len(conv.Messages); n > 0 {
+		conv.Messages = conv.Messages[:n-1]
+	}
+}
+
 // GetConversation returns the conversation history for a user.
 func (c *Client) GetConversation(userID int64) []Message {
 	c.mu.RLock()
@@ -432,16 +597,18 @@ func (c *Client) doRequest(ctx context.Context, path string, body interface{}) (
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
 
+	log := c.logger.WithContext(ctx)
 	if c.debug {
-		c.logger.Debug("Minimax Request: %s %s", httpReq.Method, httpReq.URL.String())
-		c.logger.Debug("Minimax Body: %s", string(jsonData))
+		log.Debug("Minimax Request: %s %s", httpReq.Method, httpReq.URL.String())
+		log.Debug("Minimax Body: %s", string(jsonData))
 	}
 
 	// Create a context with timeout
-	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	timeout, httpClient := c.transport()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	resp, err := c.httpClient.Do(httpReq.WithContext(ctx))
+	resp, err := httpClient.Do(httpReq.WithContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -453,7 +620,7 @@ func (c *Client) doRequest(ctx context.Context, path string, body interface{}) (
 	}
 
 	if c.debug {
-		c.logger.Debug("Minimax Response: %s", string(data))
+		log.Debug("Minimax Response: %s", string(data))
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -1,6 +1,12 @@
 package minimax
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -305,3 +311,84 @@ func TestGetConversation(t *testing.T) {
 		t.Errorf("Expected 1 message, got %d", len(messages))
 	}
 }
+
+func TestStreamChatRecordsReply(t *testing.T) {
+	slow := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, chunk := range []string{"Hello", " world", "!"} {
+			fmt.Fprintf(w, `{"choices":[{"delta":{"content":%q}}]}`+"\n", chunk)
+			w.(http.Flusher).Flush()
+			if chunk == "!" {
+				return
+			}
+			// Wait for the client to go away after the first chunk when cancelled
+			if slow {
+				<-r.Context().Done()
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewClient("key", WithBaseURL(server.URL))
+	client.AddMessage(1, "user", "Hi")
+	err := client.StreamChat(context.Background(), ChatParams{UserID: 1}, func(string) error { return nil })
+	if err != nil {
+		t.Fatalf("StreamChat() error = %v", err)
+	}
+	history := client.GetConversation(1)
+	if len(history) != 2 || history[1].Content != "Hello world!" {
+		t.Errorf("The reply should be recorded as one message, got %v", history)
+	}
+
+	// A cancelled stream keeps the text received so far
+	slow = true
+	client.ClearConversation(1)
+	client.AddMessage(1, "user", "Hi")
+	ctx, cancel := context.WithCancel(context.Background())
+	err = client.StreamChat(ctx, ChatParams{UserID: 1}, func(string) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("StreamChat() error = %v, want context.Canceled", err)
+	}
+	history = client.GetConversation(1)
+	if len(history) != 2 || history[1].Content != "Hello" {
+		t.Errorf("The partial reply should be recorded, got %v", history)
+	}
+
+	client.RemoveLastMessage(1)
+	if history = client.GetConversation(1); len(history) != 1 {
+		t.Errorf("RemoveLastMessage() should remove the reply, got %v", history)
+	}
+}
+
+func TestStreamChatCountsTokens(t *testing.T) {
+	var req ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		fmt.Fprintln(w, `{"choices":[{"delta":{"content":"Hello"}}]}`)
+		fmt.Fprintln(w, `{"choices":[{"delta":{},"finish_reason":"stop"}]}`)
+		fmt.Fprintln(w, `{"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":3,"total_tokens":10}}`)
+	}))
+	defer server.Close()
+
+	prompt, completion := tokensUsed.With("prompt").Value(), tokensUsed.With("completion").Value()
+
+	client, _ := NewClient("key", WithBaseURL(server.URL))
+	client.AddMessage(1, "user", "Hi")
+	err := client.StreamChat(context.Background(), ChatParams{UserID: 1}, func(string) error { return nil })
+	if err != nil {
+		t.Fatalf("StreamChat() error = %v", err)
+	}
+	if req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+		t.Errorf("StreamChat() should ask for the usage, got stream_options %v", req.StreamOptions)
+	}
+	if got := tokensUsed.With("prompt").Value() - prompt; got != 7 {
+		t.Errorf("Prompt tokens counted = %v, want 7", got)
+	}
+	if got := tokensUsed.With("completion").Value() - completion; got != 3 {
+		t.Errorf("Completion tokens counted = %v, want 3", got)
+	}
+}
@@ -0,0 +1,349 @@
+// Package profile stores per-user brand profiles and prompt templates.
+//
+// A brand profile is a named set of reusable wizard answers, such as the
+// business name and tone, used to pre-fill the content creation wizard. A
+// template is a custom prompt written with text/template that is rendered
+// from the wizard answers instead of the built-in prompt.
+package profile
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Limits on what a single user may store.
+const (
+	MaxProfiles     = 20
+	MaxTemplates    = 20
+	MaxTemplateSize = 4000
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// Profile is a named set of reusable wizard answers.
+type Profile struct {
+	Name      string            `json:"name"`
+	Answers   map[string]string `json:"answers"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// Template is a custom generation prompt. Its body is a text/template
+// executed with the wizard answers, e.g. "Write about {{.topic}}".
+type Template struct {
+	Name      string    `json:"name"`
+	Body      string    `json:"body"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Render executes the template with the given answers. Answers the
+// template refers to but the wizard did not collect render as "".
+func (t *Template) Render(answers map[string]string) (string, error) {
+	tmpl, err := parseTemplate(t.Name, t.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, answers); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", t.Name, err)
+	}
+	return sb.String(), nil
+}
+
+func parseTemplate(name, body string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Library holds everything a user has saved.
+type Library struct {
+	UserID int64 `json:"user_id"`
+	// Active is the name of the profile used to pre-fill new wizards.
+	Active    string               `json:"active,omitempty"`
+	Profiles  map[string]*Profile  `json:"profiles"`
+	Templates map[string]*Template `json:"templates"`
+}
+
+func newLibrary(userID int64) *Library {
+	return &Library{
+		UserID:    userID,
+		Profiles:  make(map[string]*Profile),
+		Templates: make(map[string]*Template),
+	}
+}
+
+func (l *Library) clone() *Library {
+	c := newLibrary(l.UserID)
+	c.Active = l.Active
+	for name, p := range l.Profiles {
+		c.Profiles[name] = p.clone()
+	}
+	for name, t := range l.Templates {
+		tc := *t
+		c.Templates[name] = &tc
+	}
+	return c
+}
+
+func (p *Profile) clone() *Profile {
+	c := *p
+	c.Answers = make(map[string]string, len(p.Answers))
+	for k, v := range p.Answers {
+		c.Answers[k] = v
+	}
+	return &c
+}
+
+// Manager manages the profiles and templates of all users.
+type Manager struct {
+	mu    sync.Mutex
+	store Store
+}
+
+// NewManager creates a manager backed by store. A nil store keeps
+// everything in memory.
+func NewManager(store Store) *Manager {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Manager{store: store}
+}
+
+// NormalizeName returns the canonical form of a profile or template name,
+// or an error if it is not a valid name.
+func NormalizeName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !namePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid name %q, use up to 32 letters, digits, - or _", name)
+	}
+	return name, nil
+}
+
+// update loads the library of a user, applies fn and saves the result if
+// fn succeeds.
+func (m *Manager) update(userID int64, fn func(*Library) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	library, err := m.store.Load(userID)
+	if err != nil {
+		return err
+	}
+	if err := fn(library); err != nil {
+		return err
+	}
+	return m.store.Save(library)
+}
+
+func (m *Manager) load(userID int64) (*Library, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.store.Load(userID)
+}
+
+// SaveProfile creates or replaces a profile with the given answers.
+func (m *Manager) SaveProfile(userID int64, name string, answers map[string]string) (*Profile, error) {
+	name, err := NormalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &Profile{Name: name, Answers: make(map[string]string, len(answers)), UpdatedAt: time.Now()}
+	for k, v := range answers {
+		profile.Answers[k] = v
+	}
+
+	err = m.update(userID, func(l *Library) error {
+		if _, ok := l.Profiles[name]; !ok && len(l.Profiles) >= MaxProfiles {
+			return fmt.Errorf("you can save at most %d profiles", MaxProfiles)
+		}
+		l.Profiles[name] = profile
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return profile.clone(), nil
+}
+
+// SetAnswer sets one answer of a profile, creating the profile if needed.
+// An empty value removes the answer.
+func (m *Manager) SetAnswer(userID int64, name, key, value string) (*Profile, error) {
+	name, err := NormalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile *Profile
+	err = m.update(userID, func(l *Library) error {
+		p, ok := l.Profiles[name]
+		if !ok {
+			if value == "" {
+				return fmt.Errorf("no profile named %q", name)
+			}
+			if len(l.Profiles) >= MaxProfiles {
+				return fmt.Errorf("you can save at most %d profiles", MaxProfiles)
+			}
+			p = &Profile{Name: name, Answers: make(map[string]string)}
+			l.Profiles[name] = p
+		}
+
+		if value == "" {
+			delete(p.Answers, key)
+		} else {
+			p.Answers[key] = value
+		}
+		p.UpdatedAt = time.Now()
+		profile = p.clone()
+		return nil
+	})
+	return profile, err
+}
+
+// DeleteProfile removes a profile. Deleting the active profile deactivates it.
+func (m *Manager) DeleteProfile(userID int64, name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return m.update(userID, func(l *Library) error {
+		if _, ok := l.Profiles[name]; !ok {
+			return fmt.Errorf("no profile named %q", name)
+		}
+		delete(l.Profiles, name)
+		if l.Active == name {
+			l.Active = ""
+		}
+		return nil
+	})
+}
+
+// UseProfile makes a profile the active one. An empty name deactivates
+// the current profile.
+func (m *Manager) UseProfile(userID int64, name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return m.update(userID, func(l *Library) error {
+		if name != "" {
+			if _, ok := l.Profiles[name]; !ok {
+				return fmt.Errorf("no profile named %q", name)
+			}
+		}
+		l.Active = name
+		return nil
+	})
+}
+
+// Profile returns a profile by name.
+func (m *Manager) Profile(userID int64, name string) (*Profile, error) {
+	library, err := m.load(userID)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := library.Profiles[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return nil, fmt.Errorf("no profile named %q", name)
+	}
+	return p, nil
+}
+
+// ActiveProfile returns the active profile of a user, or nil if none is active.
+func (m *Manager) ActiveProfile(userID int64) (*Profile, error) {
+	library, err := m.load(userID)
+	if err != nil {
+		return nil, err
+	}
+	return library.Profiles[library.Active], nil
+}
+
+// Profiles returns the profiles of a user sorted by name, and the name of
+// the active one.
+func (m *Manager) Profiles(userID int64) ([]*Profile, string, error) {
+	library, err := m.load(userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	profiles := make([]*Profile, 0, len(library.Profiles))
+	for _, p := range library.Profiles {
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, library.Active, nil
+}
+
+// SaveTemplate creates or replaces a template after checking that it parses.
+func (m *Manager) SaveTemplate(userID int64, name, body string) (*Template, error) {
+	name, err := NormalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, fmt.Errorf("template body is required")
+	}
+	if len(body) > MaxTemplateSize {
+		return nil, fmt.Errorf("template is too long, the limit is %d characters", MaxTemplateSize)
+	}
+	if _, err := parseTemplate(name, body); err != nil {
+		return nil, err
+	}
+
+	tmpl := &Template{Name: name, Body: body, UpdatedAt: time.Now()}
+	err = m.update(userID, func(l *Library) error {
+		if _, ok := l.Templates[name]; !ok && len(l.Templates) >= MaxTemplates {
+			return fmt.Errorf("you can save at most %d templates", MaxTemplates)
+		}
+		l.Templates[name] = tmpl
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	tc := *tmpl
+	return &tc, nil
+}
+
+// DeleteTemplate removes a template.
+func (m *Manager) DeleteTemplate(userID int64, name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return m.update(userID, func(l *Library) error {
+		if _, ok := l.Templates[name]; !ok {
+			return fmt.Errorf("no template named %q", name)
+		}
+		delete(l.Templates, name)
+		return nil
+	})
+}
+
+// Template returns a template by name.
+func (m *Manager) Template(userID int64, name string) (*Template, error) {
+	library, err := m.load(userID)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := library.Templates[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return nil, fmt.Errorf("no template named %q", name)
+	}
+	return t, nil
+}
+
+// Templates returns the templates of a user sorted by name.
+func (m *Manager) Templates(userID int64) ([]*Template, error) {
+	library, err := m.load(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]*Template, 0, len(library.Templates))
+	for _, t := range library.Templates {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
@@ -0,0 +1,99 @@
+package profile
+
+import (
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	m := NewManager(store)
+
+	if _, err := m.SaveProfile(1, "Acme", map[string]string{"website_name": "Acme", "tone": "bold"}); err != nil {
+		t.Fatalf("SaveProfile() error = %v", err)
+	}
+	if err := m.UseProfile(1, "acme"); err != nil {
+		t.Fatalf("UseProfile() error = %v", err)
+	}
+	if _, err := m.SetAnswer(1, "acme", "tone", "friendly"); err != nil {
+		t.Fatalf("SetAnswer() error = %v", err)
+	}
+
+	// A fresh manager sharing the store sees the saved profile
+	active, err := NewManager(store).ActiveProfile(1)
+	if err != nil {
+		t.Fatalf("ActiveProfile() error = %v", err)
+	}
+	if active == nil || active.Answers["tone"] != "friendly" || active.Answers["website_name"] != "Acme" {
+		t.Errorf("ActiveProfile() = %+v, expect acme with tone 'friendly'", active)
+	}
+
+	// Profiles are per user
+	if p, _ := m.ActiveProfile(2); p != nil {
+		t.Errorf("ActiveProfile() for another user = %+v, expect nil", p)
+	}
+
+	if err := m.DeleteProfile(1, "acme"); err != nil {
+		t.Fatalf("DeleteProfile() error = %v", err)
+	}
+	if p, _ := m.ActiveProfile(1); p != nil {
+		t.Error("Deleting the active profile should deactivate it")
+	}
+	if err := m.UseProfile(1, "acme"); err == nil {
+		t.Error("UseProfile() of a missing profile should fail")
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"Acme", "acme", false},
+		{"summer-sale_2", "summer-sale_2", false},
+		{"", "", true},
+		{"two words", "", true},
+		{"-dash", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeName(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeName(%q) = %q, %v, expect %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	m := NewManager(nil)
+
+	if _, err := m.SaveTemplate(1, "promo", "Promote {{.website_name"); err == nil {
+		t.Error("SaveTemplate() with invalid syntax should fail")
+	}
+
+	if _, err := m.SaveTemplate(1, "promo", "Write a promo for {{.website_name}} in a {{.tone}} tone.{{.missing}}"); err != nil {
+		t.Fatalf("SaveTemplate() error = %v", err)
+	}
+
+	tmpl, err := m.Template(1, "PROMO")
+	if err != nil {
+		t.Fatalf("Template() error = %v", err)
+	}
+	got, err := tmpl.Render(map[string]string{"website_name": "Acme", "tone": "bold"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if want := "Write a promo for Acme in a bold tone."; got != want {
+		t.Errorf("Render() = %q, expect %q", got, want)
+	}
+
+	if err := m.DeleteTemplate(1, "promo"); err != nil {
+		t.Fatalf("DeleteTemplate() error = %v", err)
+	}
+	if templates, _ := m.Templates(1); len(templates) != 0 {
+		t.Errorf("Expected 0 templates after delete, got %d", len(templates))
+	}
+}
@@ -0,0 +1,126 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// Store persists user libraries.
+type Store interface {
+	// Load returns the library of a user, or an empty library if none is stored.
+	Load(userID int64) (*Library, error)
+	// Save creates or replaces the library for library.UserID.
+	Save(library *Library) error
+}
+
+// MemoryStore is a Store that keeps libraries in memory only.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	libraries map[int64]*Library
+}
+
+// NewMemoryStore creates a new in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		libraries: make(map[int64]*Library),
+	}
+}
+
+// Load returns a copy of the stored library.
+func (s *MemoryStore) Load(userID int64) (*Library, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if library, ok := s.libraries[userID]; ok {
+		return library.clone(), nil
+	}
+	return newLibrary(userID), nil
+}
+
+// Save stores a copy of the library.
+func (s *MemoryStore) Save(library *Library) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.libraries[library.UserID] = library.clone()
+	return nil
+}
+
+// FileStore is a Store that keeps one JSON file per user in a directory.
+type FileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileStore creates a file store rooted at dir, creating the directory if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("store directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Load reads the library file of a user.
+func (s *FileStore) Load(userID int64) (*Library, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(userID))
+	if os.IsNotExist(err) {
+		return newLibrary(userID), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read library: %w", err)
+	}
+
+	library := newLibrary(userID)
+	if err := json.Unmarshal(data, library); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal library: %w", err)
+	}
+	if library.Profiles == nil {
+		library.Profiles = make(map[string]*Profile)
+	}
+	if library.Templates == nil {
+		library.Templates = make(map[string]*Template)
+	}
+	return library, nil
+}
+
+// Save writes the library to disk atomically.
+func (s *FileStore) Save(library *Library) error {
+	data, err := json.MarshalIndent(library, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal library: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, ".library-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write library: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write library: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path(library.UserID)); err != nil {
+		return fmt.Errorf("failed to save library: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) path(userID int64) string {
+	return filepath.Join(s.dir, strconv.FormatInt(userID, 10)+".json")
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minimax-agent/telegram-bot/internal/wizard"
+	"github.com/minimax-agent/telegram-bot/pkg/logger"
+)
+
+// SessionLister lists wizard sessions in progress, see wizard.Manager.
+type SessionLister interface {
+	ActiveSessions() []*wizard.Session
+}
+
+// ConversationClearer forgets a user's conversation history, see
+// minimax.Client.
+type ConversationClearer interface {
+	ClearConversation(userID int64)
+}
+
+// Admin serves the admin API under /admin/. Every request must carry the
+// admin token as "Authorization: Bearer <token>".
+//
+//	GET    /admin/wizards                  list active wizard sessions
+//	DELETE /admin/conversations/<user_id>  clear a user's conversation
+//	GET    /admin/debug                    report whether debug logging is on
+//	PUT    /admin/debug?enabled=true|false toggle debug logging
+//
+// Debug logging changes the base level only; component levels still win
+// for their components, and are listed in the response.
+type Admin struct {
+	token         string
+	sessions      SessionLister
+	conversations ConversationClearer
+	levels        *logger.Logger
+	logger        *logger.Logger
+
+	mu        sync.Mutex
+	prevLevel logger.Level
+	debugOn   bool
+}
+
+// AdminOption configures an Admin.
+type AdminOption func(*Admin)
+
+// WithSessions sets where /admin/wizards lists sessions from.
+func WithSessions(s SessionLister) AdminOption {
+	return func(a *Admin) {
+		a.sessions = s
+	}
+}
+
+// WithConversations sets what /admin/conversations clears.
+func WithConversations(c ConversationClearer) AdminOption {
+	return func(a *Admin) {
+		a.conversations = c
+	}
+}
+
+// WithLogLevels sets the logger whose level /admin/debug toggles.
+func WithLogLevels(l *logger.Logger) AdminOption {
+	return func(a *Admin) {
+		a.levels = l
+	}
+}
+
+// WithAdminLogger sets the logger admin actions are recorded to.
+func WithAdminLogger(l *logger.Logger) AdminOption {
+	return func(a *Admin) {
+		a.logger = l
+	}
+}
+
+// NewAdmin creates the admin API handler. An empty token rejects every
+// request.
+func NewAdmin(token string, opts ...AdminOption) *Admin {
+	a := &Admin{
+		token:  token,
+		logger: logger.Default(),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// sessionSummary is what /admin/wizards reports about a session. Answers
+// and drafts are left out, as they are the user's content.
+type sessionSummary struct {
+	UserID       int64     `json:"user_id"`
+	ChatID       int64     `json:"chat_id"`
+	ContentType  string    `json:"content_type"`
+	Step         int       `json:"step"`
+	StartedAt    time.Time `json:"started_at"`
+	LastActivity time.Time `json:"last_activity"`
+}
+
+// ServeHTTP implements http.Handler.
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "/admin/wizards":
+		a.handleWizards(w, r)
+	case strings.HasPrefix(path, "/admin/conversations/"):
+		a.handleConversation(w, r, strings.TrimPrefix(path, "/admin/conversations/"))
+	case path == "/admin/debug":
+		a.handleDebug(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (a *Admin) authorized(r *http.Request) bool {
+	if a.token == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+func (a *Admin) handleWizards(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	if a.sessions == nil {
+		writeError(w, http.StatusNotImplemented, "wizards are not available")
+		return
+	}
+
+	summaries := []sessionSummary{}
+	for _, s := range a.sessions.ActiveSessions() {
+		summaries = append(summaries, sessionSummary{
+			UserID:       s.UserID,
+			ChatID:       s.ChatID,
+			ContentType:  string(s.ContentType),
+			Step:         s.Step,
+			StartedAt:    s.StartedAt,
+			LastActivity: s.LastActivity,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"wizards": summaries})
+}
+
+func (a *Admin) handleConversation(w http.ResponseWriter, r *http.Request, id string) {
+	if !allowMethod(w, r, http.MethodDelete) {
+		return
+	}
+	if a.conversations == nil {
+		writeError(w, http.StatusNotImplemented, "conversations are not available")
+		return
+	}
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id "+strconv.Quote(id))
+		return
+	}
+
+	a.conversations.ClearConversation(userID)
+	a.logger.Info("Admin API cleared the conversation of user %d", userID)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"user_id": userID, "cleared": true})
+}
+
+func (a *Admin) handleDebug(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodPut) {
+		return
+	}
+	if a.levels == nil {
+		writeError(w, http.StatusNotImplemented, "log levels are not available")
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "enabled must be true or false")
+			return
+		}
+		a.setDebug(enabled)
+	}
+	components := make(map[string]string)
+	for name, level := range a.levels.ComponentLevels() {
+		components[name] = level.String()
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":          a.levels.Level() == logger.DebugLevel,
+		"level":            a.levels.Level().String(),
+		"component_levels": components,
+	})
+}
+
+// SetLogLevel sets the base log level, e.g. after a config reload. While
+// debug logging is switched on through the API, the level is kept and
+// restored once it is switched off.
+func (a *Admin) SetLogLevel(level logger.Level) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.debugOn {
+		a.prevLevel = level
+		return
+	}
+	a.levels.SetLevel(level)
+}
+
+// setDebug switches the log level to debug, or back to the level it had
+// before debug logging was switched on.
+func (a *Admin) setDebug(enabled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case enabled && !a.debugOn:
+		a.prevLevel = a.levels.Level()
+		a.debugOn = true
+		a.levels.SetLevel(logger.DebugLevel)
+		a.logger.Info("Admin API enabled debug logging")
+	case !enabled && a.debugOn:
+		a.debugOn = false
+		a.levels.SetLevel(a.prevLevel)
+		a.logger.Info("Admin API restored log level %s", a.prevLevel)
+	}
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// CheckFunc reports why a dependency is not ready, or nil if it is. It
+// must return when ctx is done.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// AddReadinessCheck adds a check /readyz runs. The bot is ready when every
+// check passes within the readiness timeout.
+func (s *Server) AddReadinessCheck(name string, fn CheckFunc) {
+	s.checksMu.Lock()
+	defer s.checksMu.Unlock()
+	s.checks = append(s.checks, check{name: name, fn: fn})
+}
+
+// handleHealthz reports that the process is alive and serving requests.
+func (s *Server) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz runs the readiness checks concurrently and responds 200 if
+// all pass, or 503 with the failures.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	s.checksMu.Lock()
+	checks := append([]check{}, s.checks...)
+	s.checksMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.readinessTimeout)
+	defer cancel()
+
+	results := make(map[string]string, len(checks))
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		ready = true
+	)
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c check) {
+			defer wg.Done()
+			result := "ok"
+			if err := c.fn(ctx); err != nil {
+				result = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[c.name] = result
+			if result != "ok" {
+				ready = false
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]interface{}{"status": status, "checks": results})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
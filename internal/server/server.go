@@ -0,0 +1,132 @@
+// Package server provides the bot's HTTP listener for operational
+// endpoints: metrics, health checks and the admin API.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/minimax-agent/telegram-bot/pkg/logger"
+)
+
+// Server serves HTTP endpoints registered with Handle, along with
+// /healthz, which responds as long as the process serves requests, and
+// /readyz, which runs the readiness checks.
+type Server struct {
+	addr             string
+	mux              *http.ServeMux
+	logger           *logger.Logger
+	shutdownTimeout  time.Duration
+	readinessTimeout time.Duration
+
+	checksMu sync.Mutex
+	checks   []check
+
+	listener net.Listener
+	server   *http.Server
+	done     chan struct{}
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithLogger sets a custom logger.
+func WithLogger(l *logger.Logger) Option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+// WithShutdownTimeout sets how long requests in progress may take to
+// finish when the server stops.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.shutdownTimeout = timeout
+	}
+}
+
+// WithReadinessTimeout sets how long the readiness checks may take
+// together before the bot is reported as not ready.
+func WithReadinessTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.readinessTimeout = timeout
+	}
+}
+
+// New creates a server that will listen on addr, e.g. ":9090" or
+// "127.0.0.1:9090".
+func New(addr string, opts ...Option) *Server {
+	s := &Server{
+		addr:             addr,
+		mux:              http.NewServeMux(),
+		logger:           logger.Default(),
+		shutdownTimeout:  5 * time.Second,
+		readinessTimeout: 5 * time.Second,
+		done:             make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	s.mux.HandleFunc("/readyz", s.handleReadyz)
+	return s
+}
+
+// Handle registers h for pattern, see http.ServeMux. Handlers must be
+// registered before Start.
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+// Start listens on the server's address and serves requests in the
+// background until ctx is done. It returns an error if the address cannot
+// be listened on.
+func (s *Server) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+	s.listener = listener
+	s.server = &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		defer close(s.done)
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("HTTP server on %s failed: %v", s.Addr(), err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+		defer cancel()
+		if err := s.server.Shutdown(shutdownCtx); err != nil {
+			s.logger.Error("Failed to shut down HTTP server: %v", err)
+		}
+	}()
+
+	s.logger.Info("Serving HTTP on %s", s.Addr())
+	return nil
+}
+
+// Addr returns the address the server listens on, which tells the port
+// chosen for ":0", or the configured address before Start.
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Done is closed once the server has stopped serving.
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
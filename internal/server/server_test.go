@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minimax-agent/telegram-bot/internal/wizard"
+	"github.com/minimax-agent/telegram-bot/pkg/logger"
+)
+
+func TestServer(t *testing.T) {
+	s := New("127.0.0.1:0", WithLogger(logger.New(logger.WithOutput(&bytes.Buffer{}))))
+	s.Handle("/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "pong")
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	resp, err := http.Get("http://" + s.Addr() + "/ping")
+	if err != nil {
+		t.Fatalf("GET /ping error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "pong" {
+		t.Errorf("GET /ping = %q, want pong", body)
+	}
+
+	cancel()
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server should stop when the context is done")
+	}
+}
+
+func TestServerListenError(t *testing.T) {
+	s := New("127.0.0.1:-1")
+	if err := s.Start(context.Background()); err == nil {
+		t.Error("Start() should fail for an invalid address")
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	s := New(":0")
+	s.AddReadinessCheck("failing", func(ctx context.Context) error { return errors.New("down") })
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /healthz = %d, want 200 regardless of readiness", rec.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	s := New(":0", WithReadinessTimeout(50*time.Millisecond))
+	s.AddReadinessCheck("ok", func(ctx context.Context) error { return nil })
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /readyz = %d, want 200", rec.Code)
+	}
+
+	s.AddReadinessCheck("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	rec = httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("GET /readyz = %d, want 503", rec.Code)
+	}
+
+	var body struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Checks["ok"] != "ok" || body.Checks["slow"] != context.DeadlineExceeded.Error() {
+		t.Errorf("Unexpected checks %v", body.Checks)
+	}
+}
+
+type fakeSessions []*wizard.Session
+
+func (f fakeSessions) ActiveSessions() []*wizard.Session { return f }
+
+type fakeConversations struct{ cleared []int64 }
+
+func (f *fakeConversations) ClearConversation(userID int64) { f.cleared = append(f.cleared, userID) }
+
+func TestAdmin(t *testing.T) {
+	conversations := &fakeConversations{}
+	levels := logger.New(logger.WithOutput(&bytes.Buffer{}), logger.WithLevel(logger.WarnLevel))
+	admin := NewAdmin("secret-token",
+		WithSessions(fakeSessions{{
+			UserID:      1,
+			ChatID:      2,
+			ContentType: "post",
+			Answers:     map[string]string{"topic": "private"},
+		}}),
+		WithConversations(conversations),
+		WithLogLevels(levels),
+		WithAdminLogger(logger.New(logger.WithOutput(&bytes.Buffer{}))),
+	)
+
+	do := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("GET", "/admin/wizards", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Request without token = %d, want 401", rec.Code)
+	}
+	if rec := do("GET", "/admin/wizards", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Request with wrong token = %d, want 401", rec.Code)
+	}
+
+	rec := do("GET", "/admin/wizards", "secret-token")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"user_id":1`) {
+		t.Errorf("GET /admin/wizards = %d %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "private") {
+		t.Error("Session listing should not include answers")
+	}
+
+	if rec := do("DELETE", "/admin/conversations/42", "secret-token"); rec.Code != http.StatusOK {
+		t.Errorf("DELETE /admin/conversations/42 = %d", rec.Code)
+	}
+	if len(conversations.cleared) != 1 || conversations.cleared[0] != 42 {
+		t.Errorf("Cleared conversations = %v, want [42]", conversations.cleared)
+	}
+	if rec := do("DELETE", "/admin/conversations/abc", "secret-token"); rec.Code != http.StatusBadRequest {
+		t.Errorf("DELETE with invalid user id = %d, want 400", rec.Code)
+	}
+	if rec := do("GET", "/admin/conversations/42", "secret-token"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /admin/conversations/42 = %d, want 405", rec.Code)
+	}
+
+	do("PUT", "/admin/debug?enabled=true", "secret-token")
+	if levels.Level() != logger.DebugLevel {
+		t.Errorf("Level after enabling debug = %v, want DEBUG", levels.Level())
+	}
+	do("PUT", "/admin/debug?enabled=false", "secret-token")
+	if levels.Level() != logger.WarnLevel {
+		t.Errorf("Level after disabling debug = %v, want the previous WARN", levels.Level())
+	}
+
+	// A reload while debug logging is on changes the level restored later
+	do("PUT", "/admin/debug?enabled=true", "secret-token")
+	admin.SetLogLevel(logger.ErrorLevel)
+	if levels.Level() != logger.DebugLevel {
+		t.Errorf("Level after a reload = %v, want DEBUG to stay on", levels.Level())
+	}
+	do("PUT", "/admin/debug?enabled=false", "secret-token")
+	if levels.Level() != logger.ErrorLevel {
+		t.Errorf("Level after disabling debug = %v, want the reloaded ERROR", levels.Level())
+	}
+
+	levels.SetComponentLevel("minimax", logger.InfoLevel)
+	if rec := do("GET", "/admin/debug", "secret-token"); !strings.Contains(rec.Body.String(), `"component_levels":{"minimax":"INFO"}`) {
+		t.Errorf("GET /admin/debug should list component levels, got %s", rec.Body.String())
+	}
+}
+
+func TestAdminWithoutToken(t *testing.T) {
+	admin := NewAdmin("")
+	req := httptest.NewRequest("GET", "/admin/wizards", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Admin without a token should reject requests, got %d", rec.Code)
+	}
+}
@@ -15,11 +15,17 @@ import (
 	"time"
 
 	"github.com/minimax-agent/telegram-bot/pkg/logger"
+	"github.com/minimax-agent/telegram-bot/pkg/metrics"
 )
 
 // APIURL is the base URL for the Telegram Bot API.
 const APIURL = "https://api.telegram.org"
 
+// apiErrors counts failed API calls by method and error code, or "network"
+// if the API could not be reached.
+var apiErrors = metrics.NewCounterVec("telegram_api_errors_total",
+	"Telegram Bot API calls that failed, by method and error code.", "method", "code")
+
 // Client represents a Telegram Bot API client.
 type Client struct {
 	mu         sync.RWMutex
@@ -36,8 +42,14 @@ type Client struct {
 	updateCh  chan Update
 	offset    int64
 	connected bool
-	stopChan  chan struct{}
-	wg        sync.WaitGroup
+	// polling is set while the long polling loop runs; lastPoll is when it
+	// started or last received a response
+	polling  bool
+	lastPoll time.Time
+	// stopPolling cancels the long polling loop, including a getUpdates
+	// request in progress
+	stopPolling context.CancelFunc
+	wg          sync.WaitGroup
 }
 
 // NewClient creates a new Telegram API client.
@@ -52,12 +64,14 @@ func NewClient(token string, opts ...ClientOption) (*Client, error) {
 		httpClient: &http.Client{Timeout: 60 * time.Second},
 		logger:     logger.Default(),
 		updateCh:   make(chan Update, 100),
-		stopChan:   make(chan struct{}),
 	}
 
 	for _, opt := range opts {
 		opt(client)
 	}
+	// Debug output includes request URLs and bodies, so keep the
+	// credentials out of it whichever logger is used.
+	client.logger = client.logger.WithSecrets(token)
 
 	return client, nil
 }
@@ -356,9 +370,21 @@ type SendMessageParams struct {
 	ReplyMarkup              interface{}     `json:"reply_markup,omitempty"`
 }
 
+// InlineKeyboardMarkup represents an inline keyboard attached to a message.
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+}
+
+// InlineKeyboardButton represents one button of an inline keyboard.
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	URL          string `json:"url,omitempty"`
+	CallbackData string `json:"callback_data,omitempty"`
+}
+
 // SendMessage sends a message to a chat.
 func (c *Client) SendMessage(ctx context.Context, params SendMessageParams) (*Message, error) {
-	data, err := c.doRequest("sendMessage", params)
+	data, err := c.doRequest(ctx, "sendMessage", params)
 	if err != nil {
 		return nil, err
 	}
@@ -382,7 +408,7 @@ type AnswerCallbackQueryParams struct {
 
 // AnswerCallbackQuery answers a callback query.
 func (c *Client) AnswerCallbackQuery(ctx context.Context, params AnswerCallbackQueryParams) (bool, error) {
-	data, err := c.doRequest("answerCallbackQuery", params)
+	data, err := c.doRequest(ctx, "answerCallbackQuery", params)
 	if err != nil {
 		return false, err
 	}
@@ -408,7 +434,7 @@ func (c *Client) DeleteMessage(ctx context.Context, chatID interface{}, messageI
 		MessageID: messageID,
 	}
 
-	data, err := c.doRequest("deleteMessage", params)
+	data, err := c.doRequest(ctx, "deleteMessage", params)
 	if err != nil {
 		return false, err
 	}
@@ -421,6 +447,32 @@ func (c *Client) DeleteMessage(ctx context.Context, chatID interface{}, messageI
 	return result, nil
 }
 
+// EditMessageTextParams contains parameters for editing the text of a message.
+type EditMessageTextParams struct {
+	ChatID                interface{} `json:"chat_id"`
+	MessageID             int64       `json:"message_id"`
+	Text                  string      `json:"text"`
+	ParseMode             string      `json:"parse_mode,omitempty"`
+	DisableWebPagePreview bool        `json:"disable_web_page_preview,omitempty"`
+	ReplyMarkup           interface{} `json:"reply_markup,omitempty"`
+}
+
+// EditMessageText replaces the text of a message sent by the bot. Leaving
+// ReplyMarkup empty removes an inline keyboard.
+func (c *Client) EditMessageText(ctx context.Context, params EditMessageTextParams) (*Message, error) {
+	data, err := c.doRequest(ctx, "editMessageText", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var result Message
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return &result, nil
+}
+
 // GetChatMemberParams contains parameters for getting a chat member.
 type GetChatMemberParams struct {
 	ChatID interface{} `json:"chat_id"`
@@ -429,7 +481,7 @@ type GetChatMemberParams struct {
 
 // GetChatMember gets information about a member of a chat.
 func (c *Client) GetChatMember(ctx context.Context, params GetChatMemberParams) (*ChatMember, error) {
-	data, err := c.doRequest("getChatMember", params)
+	data, err := c.doRequest(ctx, "getChatMember", params)
 	if err != nil {
 		return nil, err
 	}
@@ -452,7 +504,7 @@ func (c *Client) GetMe(ctx context.Context) (*User, error) {
 	}
 	c.mu.RUnlock()
 
-	data, err := c.doRequest("getMe", nil)
+	data, err := c.doRequest(ctx, "getMe", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -479,7 +531,7 @@ type GetUpdatesParams struct {
 
 // GetUpdates gets updates from Telegram.
 func (c *Client) GetUpdates(ctx context.Context, params GetUpdatesParams) ([]Update, error) {
-	data, err := c.doRequest("getUpdates", params)
+	data, err := c.doRequest(ctx, "getUpdates", params)
 	if err != nil {
 		return nil, err
 	}
@@ -505,7 +557,7 @@ type SetWebhookParams struct {
 
 // SetWebhook sets a webhook for the bot.
 func (c *Client) SetWebhook(ctx context.Context, params SetWebhookParams) (bool, error) {
-	data, err := c.doRequest("setWebhook", params)
+	data, err := c.doRequest(ctx, "setWebhook", params)
 	if err != nil {
 		return false, err
 	}
@@ -523,7 +575,7 @@ func (c *Client) DeleteWebhook(ctx context.Context, dropPendingUpdates bool) (bo
 	params := map[string]interface{}{
 		"drop_pending_updates": dropPendingUpdates,
 	}
-	data, err := c.doRequest("deleteWebhook", params)
+	data, err := c.doRequest(ctx, "deleteWebhook", params)
 	if err != nil {
 		return false, err
 	}
@@ -536,39 +588,69 @@ func (c *Client) DeleteWebhook(ctx context.Context, dropPendingUpdates bool) (bo
 	return result, nil
 }
 
-// StartLongPolling starts long polling for updates.
+// StartLongPolling starts long polling for updates until ctx is done or
+// StopLongPolling is called.
 func (c *Client) StartLongPolling(ctx context.Context, opts ...GetUpdatesOption) error {
 	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.connected {
-		c.mu.Unlock()
 		return errors.New("long polling already started")
 	}
 	c.connected = true
-	c.mu.Unlock()
 
+	ctx, c.stopPolling = context.WithCancel(ctx)
 	c.wg.Add(1)
 	go c.longPollingLoop(ctx, opts...)
 
 	return nil
 }
 
-// StopLongPolling stops long polling.
+// StopLongPolling stops long polling, aborting a getUpdates request in
+// progress, and waits for the polling loop to exit. Updates already
+// received stay in the update channel. It is safe to call more than once.
 func (c *Client) StopLongPolling() error {
 	c.mu.Lock()
 	if !c.connected {
 		c.mu.Unlock()
 		return errors.New("long polling not started")
 	}
+	c.connected = false
+	stop := c.stopPolling
 	c.mu.Unlock()
 
-	close(c.stopChan)
+	stop()
 	c.wg.Wait()
 
+	return nil
+}
+
+// PollingStatus reports whether the long polling loop is running and when
+// it started or last received a response from getUpdates.
+func (c *Client) PollingStatus() (running bool, lastPoll time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.polling, c.lastPoll
+}
+
+func (c *Client) setPolling(running bool) {
 	c.mu.Lock()
-	c.connected = false
-	c.mu.Unlock()
+	defer c.mu.Unlock()
+	c.polling = running
+	c.lastPoll = time.Now()
+}
 
-	return nil
+func (c *Client) markPolled() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastPoll = time.Now()
+}
+
+// BotInfo returns the bot's user cached by GetMe, or nil if GetMe has not
+// succeeded yet.
+func (c *Client) BotInfo() *User {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.botInfo
 }
 
 // GetUpdateChannel returns a channel for receiving updates.
@@ -610,6 +692,9 @@ func WithAllowedUpdates(updates []string) GetUpdatesOption {
 func (c *Client) longPollingLoop(ctx context.Context, opts ...GetUpdatesOption) {
 	defer c.wg.Done()
 
+	c.setPolling(true)
+	defer c.setPolling(false)
+
 	params := &GetUpdatesParams{
 		Timeout: 30,
 		Limit:   100,
@@ -620,12 +705,8 @@ func (c *Client) longPollingLoop(ctx context.Context, opts ...GetUpdatesOption)
 	}
 
 	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-c.stopChan:
+		if ctx.Err() != nil {
 			return
-		default:
 		}
 
 		// Set offset to the next update after the last processed
@@ -633,18 +714,19 @@ func (c *Client) longPollingLoop(ctx context.Context, opts ...GetUpdatesOption)
 
 		updates, err := c.GetUpdates(ctx, *params)
 		if err != nil {
-			select {
-			case <-ctx.Done():
-				return
-			case <-c.stopChan:
+			if ctx.Err() != nil {
 				return
-			default:
 			}
 
 			c.logger.Error("Error getting updates: %v", err)
-			time.Sleep(time.Second)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
 			continue
 		}
+		c.markPolled()
 
 		for _, update := range updates {
 			c.offset = update.UpdateID + 1
@@ -653,15 +735,14 @@ func (c *Client) longPollingLoop(ctx context.Context, opts ...GetUpdatesOption)
 			case c.updateCh <- update:
 			case <-ctx.Done():
 				return
-			case <-c.stopChan:
-				return
 			}
 		}
 	}
 }
 
-// doRequest performs a request to the Telegram API.
-func (c *Client) doRequest(method string, params interface{}) (json.RawMessage, error) {
+// doRequest performs a request to the Telegram API. The request is
+// canceled when ctx is done.
+func (c *Client) doRequest(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
 	var body io.Reader
 
 	if params != nil {
@@ -672,19 +753,21 @@ func (c *Client) doRequest(method string, params interface{}) (json.RawMessage,
 		body = bytes.NewReader(data)
 	}
 
-	req, err := http.NewRequest("POST", c.baseURL+"/"+method, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/"+method, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
+	log := c.logger.WithContext(ctx)
 	if c.debug {
-		c.logger.Debug("Request: %s %s", req.Method, req.URL.String())
+		log.Debug("Request: %s %s", req.Method, req.URL.String())
 	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		apiErrors.With(method, "network").Inc()
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
@@ -695,15 +778,17 @@ func (c *Client) doRequest(method string, params interface{}) (json.RawMessage,
 	}
 
 	if c.debug {
-		c.logger.Debug("Response: %s", string(data))
+		log.Debug("Response: %s", string(data))
 	}
 
 	var result Response
 	if err := json.Unmarshal(data, &result); err != nil {
+		apiErrors.With(method, strconv.Itoa(resp.StatusCode)).Inc()
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
 	if !result.OK {
+		apiErrors.With(method, strconv.Itoa(result.ErrorCode)).Inc()
 		return nil, &APIError{
 			Code:        result.ErrorCode,
 			Description: result.Description,
@@ -1,8 +1,16 @@
 package telegram
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/minimax-agent/telegram-bot/pkg/logger"
 )
 
 func TestNewClient(t *testing.T) {
@@ -242,3 +250,114 @@ func TestWithAllowedUpdates(t *testing.T) {
 		t.Errorf("AllowedUpdates[0] = %s, expect 'message'", params.AllowedUpdates[0])
 	}
 }
+
+func TestDebugOutputRedactsToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"Bot","username":"test_bot"}}`))
+	}))
+	defer server.Close()
+
+	token := "123456789:AAE-secret-part-of-the-token-abcdefgh"
+	buf := &bytes.Buffer{}
+	client, err := NewClient(
+		token,
+		WithBaseURL(server.URL),
+		WithDebug(true),
+		WithLogger(logger.New(logger.WithOutput(buf), logger.WithLevel(logger.DebugLevel), logger.WithRedactor(nil))),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, err := client.GetMe(context.Background()); err != nil {
+		t.Fatalf("GetMe() error = %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "/bot"+logger.Redacted+"/getMe") {
+		t.Errorf("Expected the request to be logged, got %q", output)
+	}
+	if strings.Contains(output, "secret-part") {
+		t.Errorf("Debug output leaks the token: %q", output)
+	}
+}
+
+func TestDoRequestUsesContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	buf := &bytes.Buffer{}
+	client, err := NewClient(
+		"test_token_123",
+		WithBaseURL(server.URL),
+		WithDebug(true),
+		WithLogger(logger.New(logger.WithOutput(buf), logger.WithLevel(logger.DebugLevel))),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	ctx := logger.ContextWithCorrelationID(context.Background(), "update-42")
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := client.GetMe(ctx); err == nil {
+		t.Fatal("GetMe() should fail when the context is done")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("GetMe() took %s, the context was ignored", elapsed)
+	}
+	if !strings.Contains(buf.String(), "correlation_id=update-42") {
+		t.Errorf("Debug output should carry the correlation ID, got %q", buf.String())
+	}
+}
+
+func TestStopLongPolling(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices the client going away once the body is read
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(
+		"test_token_123",
+		WithBaseURL(server.URL),
+		WithLogger(logger.New(logger.WithOutput(&bytes.Buffer{}))),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if err := client.StartLongPolling(context.Background()); err != nil {
+		t.Fatalf("StartLongPolling() error = %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			client.StopLongPolling()
+			done <- struct{}{}
+		}()
+	}
+	<-done
+	<-done
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("StopLongPolling() took %s, the getUpdates request in progress was not aborted", elapsed)
+	}
+	if running, _ := client.PollingStatus(); running {
+		t.Error("Polling should not be running after StopLongPolling()")
+	}
+	if err := client.StopLongPolling(); err == nil {
+		t.Error("StopLongPolling() should fail when polling is not started")
+	}
+}
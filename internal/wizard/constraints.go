@@ -0,0 +1,445 @@
+package wizard
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Rule checks generated content against one constraint. It returns a
+// description of each violation, phrased so it can be sent back to the
+// model when asking for a corrected version.
+type Rule func(content string) []string
+
+// ThreadSeparator separates the posts of a thread in generated content.
+const ThreadSeparator = "---"
+
+// WordsPerMinute is the speaking rate used to estimate script reading time.
+const WordsPerMinute = 150
+
+// hashtagLimits are the most hashtags a platform allows in one post.
+var hashtagLimits = map[ContentType]int{
+	ContentTypeLinkedIn:  5,
+	ContentTypeInstagram: 30,
+}
+
+// contentRules are the platform limits enforced on generated content.
+var contentRules = map[ContentType][]Rule{
+	ContentTypeTwitter: {
+		MaxPartChars(ThreadSeparator, "Tweet", 280),
+	},
+	ContentTypeLinkedIn: {
+		MaxChars(3000),
+		MaxHashtags(hashtagLimits[ContentTypeLinkedIn]),
+	},
+	ContentTypeInstagram: {
+		MaxChars(2200),
+		MaxHashtags(hashtagLimits[ContentTypeInstagram]),
+	},
+	ContentTypeGoogleAds: {
+		FieldMaxChars("Headline", 30),
+		FieldMaxChars("Description", 90),
+		MinFields("Headline", 3),
+		MinFields("Description", 2),
+	},
+}
+
+// poemForms are poem styles with a fixed number of lines, which takes
+// precedence over the length answer.
+var poemForms = map[string]int{
+	"haiku":    3,
+	"limerick": 5,
+	"sonnet":   14,
+}
+
+// lengthWords maps the length answers offered by a content type's wizard
+// to a word range. A zero maximum means no upper limit.
+var lengthWords = map[ContentType]map[string][2]int{
+	ContentTypeMarketing:  {"short": {50, 150}, "medium": {150, 400}, "long": {400, 1000}},
+	ContentTypeReport:     {"brief": {200, 800}, "medium": {600, 1500}, "comprehensive": {1200, 0}},
+	ContentTypeWhitepaper: {"short": {400, 1200}, "medium": {1000, 2500}, "long": {2000, 0}},
+	ContentTypeStory:      {"short story": {300, 2500}, "novella": {1500, 0}, "novel excerpt": {1000, 0}},
+	ContentTypeProduct:    {"short": {30, 100}, "medium": {80, 200}, "long": {180, 400}},
+}
+
+// Violations returns the constraints the content breaks, or nil if it
+// meets them all. These are the limits of the wizard's content type plus
+// those derived from its answers, such as the requested length.
+func (w *Wizard) Violations(content string) []string {
+	rules := append([]Rule{}, contentRules[w.ContentType]...)
+	rules = append(rules, answerRules(w.ContentType, w.GetAnswers())...)
+
+	var violations []string
+	for _, rule := range rules {
+		violations = append(violations, rule(content)...)
+	}
+	return violations
+}
+
+// answerRules returns the rules implied by the wizard answers.
+func answerRules(contentType ContentType, answers map[string]string) []Rule {
+	var rules []Rule
+
+	switch contentType {
+	case ContentTypePoem:
+		n, ok := parseCount(answers["length"])
+		if lines, fixed := poemForm(answers["style"]); fixed {
+			n, ok = lines, true
+		}
+		if ok && n > 0 {
+			rules = append(rules, LineCount(n))
+		}
+	case ContentTypeScript:
+		if d, ok := parseSpokenDuration(answers["duration"]); ok {
+			rules = append(rules, ReadingTime(d))
+		}
+	case ContentTypeTwitter:
+		if n, ok := parseCount(answers["tweets"]); ok && n > 0 {
+			rules = append(rules, PartCount(ThreadSeparator, "tweets", n))
+		}
+	case ContentTypeLinkedIn, ContentTypeInstagram:
+		if n, ok := parseCount(answers["hashtags"]); ok && n < hashtagLimits[contentType] {
+			rules = append(rules, MaxHashtags(n))
+		}
+	default:
+		if min, max, ok := wordRange(contentType, answers["length"]); ok {
+			rules = append(rules, WordCount(min, max))
+		}
+	}
+
+	if cta := strings.TrimSpace(answers["cta"]); requiresCTA(cta) {
+		rules = append(rules, ContainsCTA(cta))
+	}
+	return rules
+}
+
+// MaxChars limits the length of the whole content. Characters are counted
+// as Unicode code points.
+func MaxChars(limit int) Rule {
+	return func(content string) []string {
+		if n := utf8.RuneCountInString(strings.TrimSpace(content)); n > limit {
+			return []string{fmt.Sprintf("The text is %d characters long, the limit is %d.", n, limit)}
+		}
+		return nil
+	}
+}
+
+// MaxPartChars limits the length of each part of content split by sep,
+// such as the tweets of a thread.
+func MaxPartChars(sep, name string, limit int) Rule {
+	return func(content string) []string {
+		var violations []string
+		for i, part := range splitParts(content, sep) {
+			if n := utf8.RuneCountInString(part); n > limit {
+				violations = append(violations, fmt.Sprintf("%s %d is %d characters long, the limit is %d.", name, i+1, n, limit))
+			}
+		}
+		return violations
+	}
+}
+
+var hashtagPattern = regexp.MustCompile(`(?:^|\s)#[\p{L}\p{N}_]+`)
+
+// MaxHashtags limits the number of hashtags.
+func MaxHashtags(limit int) Rule {
+	return func(content string) []string {
+		if n := CountHashtags(content); n > limit {
+			return []string{fmt.Sprintf("The text has %d hashtags, the limit is %d.", n, limit)}
+		}
+		return nil
+	}
+}
+
+// CountHashtags returns the number of hashtags in content.
+func CountHashtags(content string) int {
+	return len(hashtagPattern.FindAllString(content, -1))
+}
+
+// FieldMaxChars limits the length of each "<name> N: value" line, such as
+// the headlines of an ad.
+func FieldMaxChars(name string, limit int) Rule {
+	return func(content string) []string {
+		var violations []string
+		for i, value := range fieldValues(content, name) {
+			if n := utf8.RuneCountInString(value); n > limit {
+				violations = append(violations, fmt.Sprintf("%s %d (%q) is %d characters long, the limit is %d.", name, i+1, value, n, limit))
+			}
+		}
+		return violations
+	}
+}
+
+// MinFields requires at least min "<name> N: value" lines.
+func MinFields(name string, min int) Rule {
+	return func(content string) []string {
+		if n := len(fieldValues(content, name)); n < min {
+			return []string{fmt.Sprintf("There are %d %ss, at least %d are needed, each on its own line as \"%s 1: ...\".", n, strings.ToLower(name), min, name)}
+		}
+		return nil
+	}
+}
+
+// splitParts splits content on lines consisting of sep.
+func splitParts(content, sep string) []string {
+	var (
+		parts   []string
+		current []string
+	)
+	flush := func() {
+		if part := strings.TrimSpace(strings.Join(current, "\n")); part != "" {
+			parts = append(parts, part)
+		}
+		current = nil
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == sep {
+			flush()
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+	return parts
+}
+
+// fieldValues returns the values of "<name> N: value" lines, ignoring case
+// and list or Markdown decoration around the label.
+func fieldValues(content, name string) []string {
+	pattern := regexp.MustCompile(`(?i)^[\s*_>-]*` + regexp.QuoteMeta(name) + `\s*\d*[\s*_]*:[\s*_]*(.+)$`)
+
+	var values []string
+	for _, line := range strings.Split(content, "\n") {
+		m := pattern.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		value := strings.Trim(strings.TrimSpace(m[1]), `"“”*_`)
+		values = append(values, value)
+	}
+	return values
+}
+
+// WordCount requires between min and max words. A zero max means no
+// upper limit.
+func WordCount(min, max int) Rule {
+	return func(content string) []string {
+		n := len(strings.Fields(content))
+		switch {
+		case max > 0 && (n < min || n > max):
+			return []string{fmt.Sprintf("The text has %d words, it should have between %d and %d.", n, min, max)}
+		case n < min:
+			return []string{fmt.Sprintf("The text has %d words, it should have at least %d.", n, min)}
+		}
+		return nil
+	}
+}
+
+// LineCount requires exactly n non-empty lines, not counting a title
+// separated from the rest by a blank line.
+func LineCount(n int) Rule {
+	return func(content string) []string {
+		paragraphs := strings.Split(strings.TrimSpace(content), "\n\n")
+		lines := nonEmptyLines(content)
+		if len(lines) == n+1 && len(nonEmptyLines(paragraphs[0])) == 1 {
+			return nil
+		}
+		if len(lines) != n {
+			return []string{fmt.Sprintf("The poem has %d lines, it should have exactly %d.", len(lines), n)}
+		}
+		return nil
+	}
+}
+
+// PartCount requires exactly n parts of content split by sep.
+func PartCount(sep, name string, n int) Rule {
+	return func(content string) []string {
+		if count := len(splitParts(content, sep)); count != n {
+			return []string{fmt.Sprintf("There are %d %s, there should be exactly %d, separated by lines containing only %s.", count, name, n, sep)}
+		}
+		return nil
+	}
+}
+
+// ReadingTime requires a script to take about d to read aloud at
+// WordsPerMinute, give or take 25%. Stage directions in brackets or
+// parentheses, headings and speaker labels are not counted.
+func ReadingTime(d time.Duration) Rule {
+	target := int(d.Minutes() * WordsPerMinute)
+	tolerance := target / 4
+	if tolerance < 10 {
+		tolerance = 10
+	}
+	min, max := target-tolerance, target+tolerance
+	if min < 1 {
+		min = 1
+	}
+
+	return func(content string) []string {
+		n := SpokenWords(content)
+		if n >= min && n <= max {
+			return nil
+		}
+		spoken := time.Duration(float64(n) / WordsPerMinute * float64(time.Minute)).Round(time.Second)
+		return []string{fmt.Sprintf("The script has %d spoken words, which takes about %s to read at %d words per minute. The target is %s, so it should have %d-%d spoken words.",
+			n, spoken, WordsPerMinute, d, min, max)}
+	}
+}
+
+// ContainsCTA requires the call-to-action to appear in the content. It
+// matches if the phrase appears as is, or if all of its words of three or
+// more letters do.
+func ContainsCTA(cta string) Rule {
+	return func(content string) []string {
+		text := normalizeWords(content)
+		phrase := normalizeWords(cta)
+		if strings.Contains(" "+text+" ", " "+phrase+" ") {
+			return nil
+		}
+
+		have := make(map[string]bool)
+		for _, word := range strings.Fields(text) {
+			have[word] = true
+		}
+		for _, word := range strings.Fields(phrase) {
+			if utf8.RuneCountInString(word) >= 3 && !have[word] {
+				return []string{fmt.Sprintf("The call-to-action %q is missing.", cta)}
+			}
+		}
+		return nil
+	}
+}
+
+// SpokenWords counts the words of a script that are read aloud.
+func SpokenWords(content string) int {
+	content = directionPattern.ReplaceAllString(content, " ")
+
+	n := 0
+	for _, line := range nonEmptyLines(content) {
+		line = strings.Trim(line, "*_ ")
+		if strings.HasPrefix(line, "#") || isHeading(line) {
+			continue
+		}
+		line = speakerPattern.ReplaceAllString(line, "")
+		n += len(strings.Fields(line))
+	}
+	return n
+}
+
+var (
+	directionPattern = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)`)
+	speakerPattern   = regexp.MustCompile(`^[\p{Lu}][\p{Lu}\p{N} .'-]{0,30}:\s*`)
+	countPattern     = regexp.MustCompile(`^\s*(\d+)`)
+	wordsPattern     = regexp.MustCompile(`(?i)(\d+)\s*(?:(?:-|–|to)\s*(\d+)\s*)?words?`)
+	durationPattern  = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*(hours?|hrs?|h|minutes?|mins?|m|seconds?|secs?|s)\b`)
+	clockPattern     = regexp.MustCompile(`^\s*(\d+):([0-5]\d)\s*$`)
+	nonWordPattern   = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+)
+
+// isHeading reports whether a script line is a heading such as
+// "SCENE 1" or "INT. OFFICE - DAY" rather than dialogue.
+func isHeading(line string) bool {
+	return len(strings.Fields(line)) <= 6 && strings.ToUpper(line) == line && strings.ToLower(line) != line && !strings.Contains(line, ":")
+}
+
+// poemForm returns the number of lines of a fixed-form poem style.
+func poemForm(style string) (int, bool) {
+	for _, word := range strings.Fields(normalizeWords(style)) {
+		if lines, ok := poemForms[strings.TrimSuffix(word, "s")]; ok {
+			return lines, true
+		}
+	}
+	return 0, false
+}
+
+// parseCount returns the number an answer starts with, e.g. 8 for "8 lines".
+func parseCount(answer string) (int, bool) {
+	m := countPattern.FindStringSubmatch(answer)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	return n, err == nil
+}
+
+// parseSpokenDuration parses durations as people write them, e.g.
+// "30 seconds", "5 min", "1 minute 30 seconds", "1:30" or "90s".
+func parseSpokenDuration(answer string) (time.Duration, bool) {
+	if m := clockPattern.FindStringSubmatch(answer); m != nil {
+		minutes, _ := strconv.Atoi(m[1])
+		seconds, _ := strconv.Atoi(m[2])
+		return time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second, true
+	}
+
+	var total time.Duration
+	for _, m := range durationPattern.FindAllStringSubmatch(answer, -1) {
+		value, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			continue
+		}
+		unit := time.Second
+		switch strings.ToLower(m[2])[0] {
+		case 'h':
+			unit = time.Hour
+		case 'm':
+			unit = time.Minute
+		}
+		total += time.Duration(value * float64(unit))
+	}
+	return total, total > 0
+}
+
+// wordRange returns the word range for a length answer: either an explicit
+// count such as "300 words" (give or take 20%) or "200-400 words", or a
+// named length offered by the content type's wizard.
+func wordRange(contentType ContentType, answer string) (int, int, bool) {
+	if m := wordsPattern.FindStringSubmatch(answer); m != nil {
+		min, _ := strconv.Atoi(m[1])
+		if m[2] != "" {
+			max, _ := strconv.Atoi(m[2])
+			return min, max, max >= min
+		}
+		return min * 4 / 5, min * 6 / 5, min > 0
+	}
+
+	answer = " " + normalizeWords(answer) + " "
+	best := ""
+	for name := range lengthWords[contentType] {
+		if strings.Contains(answer, " "+name+" ") && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return 0, 0, false
+	}
+	r := lengthWords[contentType][best]
+	return r[0], r[1], true
+}
+
+// requiresCTA reports whether a call-to-action answer asks for one.
+func requiresCTA(cta string) bool {
+	switch normalizeWords(cta) {
+	case "", "none", "no", "n a", "na", "nothing", "optional", "skip":
+		return false
+	}
+	return true
+}
+
+// normalizeWords lowercases s and reduces it to words separated by spaces.
+func normalizeWords(s string) string {
+	return strings.TrimSpace(nonWordPattern.ReplaceAllString(strings.ToLower(s), " "))
+}
+
+// nonEmptyLines returns the trimmed non-empty lines of s.
+func nonEmptyLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,204 @@
+package wizard
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Draft is one version of generated content.
+type Draft struct {
+	Version     int       `json:"version"`
+	Content     string    `json:"content"`
+	Instruction string    `json:"instruction,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Summary returns a one-line description of the draft.
+func (d Draft) Summary() string {
+	instruction := d.Instruction
+	if instruction == "" {
+		instruction = "initial draft"
+	}
+	return fmt.Sprintf("v%d - %s (%d words)", d.Version, instruction, len(strings.Fields(d.Content)))
+}
+
+// SetPrompt records the prompt the first draft was generated from.
+func (w *Wizard) SetPrompt(prompt string) {
+	w.mu.Lock()
+	w.Prompt = prompt
+	w.mu.Unlock()
+
+	if w.onChange != nil {
+		w.onChange(w)
+	}
+}
+
+// GetPrompt returns the prompt the first draft was generated from.
+func (w *Wizard) GetPrompt() string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.Prompt
+}
+
+// AddDraft appends a new version of the content and returns it. Once a
+// wizard has a draft it is in refinement mode.
+func (w *Wizard) AddDraft(content, instruction string) Draft {
+	w.mu.Lock()
+	draft := Draft{
+		Version:     len(w.Drafts) + 1,
+		Content:     content,
+		Instruction: instruction,
+		CreatedAt:   time.Now(),
+	}
+	w.Drafts = append(w.Drafts, draft)
+	w.LastActivity = draft.CreatedAt
+	w.reminded = false
+	w.mu.Unlock()
+
+	if w.onChange != nil {
+		w.onChange(w)
+	}
+	return draft
+}
+
+// SetVariants records generated alternatives for the user to choose from.
+func (w *Wizard) SetVariants(variants []string) {
+	w.mu.Lock()
+	w.Variants = make([]string, len(variants))
+	copy(w.Variants, variants)
+	w.LastActivity = time.Now()
+	w.reminded = false
+	w.mu.Unlock()
+
+	if w.onChange != nil {
+		w.onChange(w)
+	}
+}
+
+// GetVariants returns the alternatives awaiting a choice.
+func (w *Wizard) GetVariants() []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	variants := make([]string, len(w.Variants))
+	copy(variants, w.Variants)
+	return variants
+}
+
+// HasVariants returns true while the user still has to pick a variant.
+func (w *Wizard) HasVariants() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.Variants) > 0
+}
+
+// SelectVariant makes the chosen alternative (numbered from 1) the next
+// draft and discards the others.
+func (w *Wizard) SelectVariant(n int) (Draft, error) {
+	w.mu.Lock()
+	if n < 1 || n > len(w.Variants) {
+		count := len(w.Variants)
+		w.mu.Unlock()
+		return Draft{}, fmt.Errorf("no variant #%d, choose 1-%d", n, count)
+	}
+	content := w.Variants[n-1]
+	w.Variants = nil
+	w.mu.Unlock()
+
+	return w.AddDraft(content, fmt.Sprintf("variant #%d", n)), nil
+}
+
+// IsRefining returns true once content has been generated for the wizard.
+func (w *Wizard) IsRefining() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.Drafts) > 0
+}
+
+// GetDrafts returns all draft versions, oldest first.
+func (w *Wizard) GetDrafts() []Draft {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	drafts := make([]Draft, len(w.Drafts))
+	copy(drafts, w.Drafts)
+	return drafts
+}
+
+// CurrentDraft returns the latest draft.
+func (w *Wizard) CurrentDraft() (Draft, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if len(w.Drafts) == 0 {
+		return Draft{}, false
+	}
+	return w.Drafts[len(w.Drafts)-1], true
+}
+
+// GetDraft returns the draft with the given version number.
+func (w *Wizard) GetDraft(version int) (Draft, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if version < 1 || version > len(w.Drafts) {
+		return Draft{}, false
+	}
+	return w.Drafts[version-1], true
+}
+
+// Rollback makes an earlier version current again by adding it as a new
+// version, so the history of revisions is never lost.
+func (w *Wizard) Rollback(version int) (Draft, error) {
+	draft, ok := w.GetDraft(version)
+	if !ok {
+		return Draft{}, fmt.Errorf("no draft v%d", version)
+	}
+	return w.AddDraft(draft.Content, fmt.Sprintf("rollback to v%d", version)), nil
+}
+
+// DiffDrafts returns a line-based diff between two drafts, with removed
+// lines prefixed by "- " and added lines by "+ ".
+func DiffDrafts(from, to Draft) string {
+	a := strings.Split(from.Content, "\n")
+	b := strings.Split(to.Content, "\n")
+
+	// Longest common subsequence table
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- v%d\n+++ v%d\n", from.Version, to.Version)
+	changed := false
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			fmt.Fprintf(&sb, "+ %s\n", b[j])
+			changed = true
+			j++
+		default:
+			fmt.Fprintf(&sb, "- %s\n", a[i])
+			changed = true
+			i++
+		}
+	}
+
+	if !changed {
+		sb.WriteString("(no changes)\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,497 @@
+package wizard
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FlagKind is the type of value a flag takes.
+type FlagKind int
+
+const (
+	// StringFlag takes free text. Unquoted values run until the next flag.
+	StringFlag FlagKind = iota
+	// IntFlag takes a whole number.
+	IntFlag
+	// BoolFlag takes no value, or an explicit true/false with --name=value.
+	BoolFlag
+)
+
+// FlagSpec describes a flag accepted by /create.
+type FlagSpec struct {
+	// Name is the long name, used as --name.
+	Name string
+	// Short is an optional single-letter alias, used as -x.
+	Short string
+	Kind  FlagKind
+	// Repeatable flags may be given more than once; all values are kept.
+	Repeatable bool
+	Usage      string
+	// AnswerKey, when set, is the WizardStep.Key the flag pre-answers.
+	AnswerKey string
+}
+
+// Flags accepted by every content type.
+const (
+	FlagPrompt   = "prompt"
+	FlagMessage  = "message"
+	FlagStyle    = "style"
+	FlagQuick    = "quick"
+	FlagCount    = "count"
+	FlagHelp     = "help"
+	FlagProfile  = "profile"
+	FlagTemplate = "template"
+)
+
+var commonFlags = []FlagSpec{
+	{Name: FlagPrompt, Short: "t", Kind: StringFlag, Usage: "Quick prompt (bypasses the wizard)"},
+	{Name: FlagMessage, Short: "m", Kind: StringFlag, Repeatable: true, Usage: "Additional instructions (repeatable)"},
+	{Name: FlagStyle, Short: "s", Kind: StringFlag, Usage: "Writing style"},
+	{Name: FlagQuick, Short: "q", Kind: BoolFlag, Usage: "Quick mode (essential questions only)"},
+	{Name: FlagCount, Short: "n", Kind: IntFlag, Usage: "Generate several variants to choose from"},
+	{Name: FlagHelp, Short: "h", Kind: BoolFlag, Usage: "Show the flags for this content type"},
+	{Name: FlagProfile, Short: "p", Kind: StringFlag, Usage: "Pre-fill answers from this brand profile instead of the active one"},
+	{Name: FlagTemplate, Kind: StringFlag, Usage: "Generate with a saved prompt template"},
+}
+
+// FlagSpecs returns the flags accepted for a content type: the common flags
+// plus one --<key> flag per wizard question to answer it up front. A common
+// flag that shares its name with a question answers that question.
+func FlagSpecs(contentType ContentType) []FlagSpec {
+	specs := make([]FlagSpec, len(commonFlags))
+	copy(specs, commonFlags)
+
+steps:
+	for _, step := range GetSteps(contentType) {
+		name := strings.ReplaceAll(step.Key, "_", "-")
+		for i := range specs {
+			if specs[i].Name == name {
+				specs[i].AnswerKey = step.Key
+				continue steps
+			}
+		}
+		specs = append(specs, FlagSpec{
+			Name:      name,
+			Kind:      StringFlag,
+			Usage:     step.Question,
+			AnswerKey: step.Key,
+		})
+	}
+	return specs
+}
+
+// FlagUsage returns a help listing of the flags for a content type.
+func FlagUsage(contentType ContentType) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Flags for /create %s:\n", contentType)
+	for _, spec := range FlagSpecs(contentType) {
+		sb.WriteString("\n")
+		if spec.Short != "" {
+			fmt.Fprintf(&sb, "-%s, ", spec.Short)
+		}
+		fmt.Fprintf(&sb, "--%s", spec.Name)
+		switch spec.Kind {
+		case StringFlag:
+			sb.WriteString(" <text>")
+		case IntFlag:
+			sb.WriteString(" <n>")
+		}
+		fmt.Fprintf(&sb, " - %s", spec.Usage)
+	}
+	return sb.String()
+}
+
+// Args holds the parsed arguments of a /create command.
+type Args struct {
+	ContentType ContentType
+	// Flags maps long flag names to their values in the order given.
+	Flags map[string][]string
+	specs []FlagSpec
+}
+
+// Has reports whether a flag was given.
+func (a *Args) Has(name string) bool {
+	_, ok := a.Flags[name]
+	return ok
+}
+
+// String returns the value of a flag, or "" if it was not given.
+// Repeatable flags return their values joined by newlines.
+func (a *Args) String(name string) string {
+	return strings.Join(a.Flags[name], "\n")
+}
+
+// Strings returns all values of a flag.
+func (a *Args) Strings(name string) []string {
+	return a.Flags[name]
+}
+
+// Int returns the value of an integer flag, or 0 if it was not given.
+func (a *Args) Int(name string) int {
+	values := a.Flags[name]
+	if len(values) == 0 {
+		return 0
+	}
+	n, _ := strconv.Atoi(values[len(values)-1])
+	return n
+}
+
+// Bool returns the value of a boolean flag.
+func (a *Args) Bool(name string) bool {
+	values := a.Flags[name]
+	if len(values) == 0 {
+		return false
+	}
+	b, _ := strconv.ParseBool(values[len(values)-1])
+	return b
+}
+
+// Answers returns the wizard answers given as --<key> flags.
+func (a *Args) Answers() map[string]string {
+	answers := make(map[string]string)
+	for _, spec := range a.specs {
+		if spec.AnswerKey != "" && a.Has(spec.Name) {
+			answers[spec.AnswerKey] = a.String(spec.Name)
+		}
+	}
+	return answers
+}
+
+// Values returns the flags as a flat map, as recorded on a wizard.
+func (a *Args) Values() map[string]string {
+	values := make(map[string]string, len(a.Flags))
+	for name := range a.Flags {
+		values[name] = a.String(name)
+	}
+	return values
+}
+
+// ParseArgs parses the arguments of /create: a content type followed by
+// flags. It supports -x value, -xvalue, --name value, --name=value,
+// double, single and typographic quotes, repeated flags and -- to end flag
+// parsing (the rest is taken literally as the quick prompt). Unquoted text
+// values run until the next flag, so `-t newsletter signup` is one value.
+func ParseArgs(input string) (*Args, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	args := &Args{Flags: make(map[string][]string)}
+	if len(tokens) == 0 {
+		return args, nil
+	}
+
+	first := tokens[0]
+	if !first.quoted && isFlagToken(first.text) {
+		return nil, fmt.Errorf("expected a content type before %s (e.g. /create marketing %s)", first.text, first.text)
+	}
+	contentType, ok := ParseContentType(first.text)
+	if !ok {
+		return nil, fmt.Errorf("unknown content type %q, choose one of: %s", first.text, contentTypeList())
+	}
+	args.ContentType = contentType
+	args.specs = FlagSpecs(contentType)
+
+	p := &argParser{args: args, tokens: tokens[1:]}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// argParser walks the tokens after the content type.
+type argParser struct {
+	args   *Args
+	tokens []token
+	pos    int
+}
+
+func (p *argParser) parse() error {
+	for p.pos < len(p.tokens) {
+		tok := p.next()
+
+		switch {
+		case !tok.quoted && tok.text == "--":
+			// Everything after -- is literal quick-prompt text
+			if p.pos == len(p.tokens) {
+				return nil
+			}
+			words := make([]string, 0, len(p.tokens)-p.pos)
+			for p.pos < len(p.tokens) {
+				words = append(words, p.next().text)
+			}
+			spec, _ := p.lookup(FlagPrompt, false)
+			return p.set(spec, strings.Join(words, " "))
+		case !tok.quoted && strings.HasPrefix(tok.text, "--"):
+			if err := p.parseLong(tok); err != nil {
+				return err
+			}
+		case !tok.quoted && isFlagToken(tok.text):
+			if err := p.parseShort(tok); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected argument %q, use -t \"<text>\" for a quick prompt", tok.text)
+		}
+	}
+	return nil
+}
+
+func (p *argParser) parseLong(tok token) error {
+	name, value, hasValue := strings.Cut(strings.TrimPrefix(tok.text, "--"), "=")
+	spec, ok := p.lookup(name, false)
+	if !ok {
+		return p.unknown("--" + name)
+	}
+
+	if hasValue {
+		return p.set(spec, value)
+	}
+	return p.setFromTokens(spec, "--"+name)
+}
+
+func (p *argParser) parseShort(tok token) error {
+	body := []rune(strings.TrimPrefix(tok.text, "-"))
+	name, rest := string(body[:1]), string(body[1:])
+
+	spec, ok := p.lookup(name, true)
+	if !ok {
+		return p.unknown("-" + name)
+	}
+
+	if rest == "" {
+		return p.setFromTokens(spec, "-"+name)
+	}
+
+	// -x=value or -xvalue
+	value := strings.TrimPrefix(rest, "=")
+	if spec.Kind != BoolFlag || strings.HasPrefix(rest, "=") {
+		return p.set(spec, value)
+	}
+
+	// Clustered boolean flags, e.g. -qh
+	if err := p.set(spec, "true"); err != nil {
+		return err
+	}
+	for _, r := range rest {
+		other, ok := p.lookup(string(r), true)
+		if !ok {
+			return p.unknown("-" + string(r))
+		}
+		if other.Kind != BoolFlag {
+			return fmt.Errorf("-%c needs a value and cannot be combined with -%s", r, name)
+		}
+		if err := p.set(other, "true"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFromTokens takes the flag value from the following tokens.
+func (p *argParser) setFromTokens(spec FlagSpec, given string) error {
+	switch spec.Kind {
+	case BoolFlag:
+		return p.set(spec, "true")
+
+	case IntFlag:
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("%s needs a number", given)
+		}
+		return p.set(spec, p.next().text)
+
+	default:
+		if p.pos >= len(p.tokens) || p.atFlag() {
+			return fmt.Errorf("%s needs a value", given)
+		}
+		tok := p.next()
+		if tok.quoted {
+			return p.set(spec, tok.text)
+		}
+
+		// Unquoted text runs until the next flag, taking in quoted words
+		words := []string{tok.text}
+		for p.pos < len(p.tokens) && !p.atFlag() {
+			words = append(words, p.next().text)
+		}
+		return p.set(spec, strings.Join(words, " "))
+	}
+}
+
+// set validates and records a flag value.
+func (p *argParser) set(spec FlagSpec, value string) error {
+	switch spec.Kind {
+	case IntFlag:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("--%s expects a whole number, got %q", spec.Name, value)
+		}
+	case BoolFlag:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("--%s expects true or false, got %q", spec.Name, value)
+		}
+	}
+
+	if p.args.Has(spec.Name) && !spec.Repeatable {
+		return fmt.Errorf("--%s was given more than once", spec.Name)
+	}
+	p.args.Flags[spec.Name] = append(p.args.Flags[spec.Name], value)
+	return nil
+}
+
+func (p *argParser) lookup(name string, short bool) (FlagSpec, bool) {
+	for _, spec := range p.args.specs {
+		if (short && spec.Short == name) || (!short && spec.Name == name) {
+			return spec, true
+		}
+	}
+	return FlagSpec{}, false
+}
+
+func (p *argParser) unknown(flag string) error {
+	return fmt.Errorf("unknown flag %s for /create %s, see /create %s --help", flag, p.args.ContentType, p.args.ContentType)
+}
+
+func (p *argParser) next() token {
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok
+}
+
+func (p *argParser) atFlag() bool {
+	tok := p.tokens[p.pos]
+	return !tok.quoted && isFlagToken(tok.text)
+}
+
+// isFlagToken reports whether an unquoted token looks like a flag rather
+// than a value such as "-" or a negative number.
+func isFlagToken(s string) bool {
+	if len(s) < 2 || s[0] != '-' {
+		return false
+	}
+	if strings.HasPrefix(s, "--") {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(s[1:])
+	return unicode.IsLetter(r)
+}
+
+// isShortFlag reports whether s is a single short flag name, e.g. -t.
+func isShortFlag(s string) bool {
+	return isFlagToken(s) && utf8.RuneCountInString(s) == 2
+}
+
+// token is one shell-like word of the input.
+type token struct {
+	text string
+	// quoted is true if the token started with a quote, so it is never
+	// treated as a flag.
+	quoted bool
+}
+
+// quotePairs maps opening quote characters to the characters that close them.
+var quotePairs = map[rune]string{
+	'"':  `"`,
+	'\'': `'`,
+	'“':  `”“`,
+	'”':  `”`,
+	'„':  `“”`,
+	'‘':  `’‘`,
+	'«':  `»`,
+	'»':  `«`,
+}
+
+// apostrophes are the quotes that double as apostrophes. They only close a
+// quote at the end of a word, and are kept literally if nothing closes them,
+// as in 'tis.
+const apostrophes = "'‘"
+
+// tokenize splits input into words, honouring quotes. A quote only opens at
+// the start of a word, right after "=" or right after a short flag such as
+// -t, so apostrophes inside words such as don't are kept literally.
+func tokenize(input string) ([]token, error) {
+	var (
+		tokens  []token
+		current strings.Builder
+		tok     token
+		inWord  bool
+	)
+
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if unicode.IsSpace(r) {
+			if inWord {
+				tok.text = current.String()
+				tokens = append(tokens, tok)
+				current.Reset()
+				tok = token{}
+				inWord = false
+			}
+			continue
+		}
+
+		closers, isQuote := quotePairs[r]
+		atStart := !inWord
+		afterEquals := inWord && i > 0 && runes[i-1] == '='
+		afterShortFlag := inWord && !tok.quoted && isShortFlag(current.String())
+		if isQuote && (atStart || afterEquals || afterShortFlag) {
+			end := -1
+			for j := i + 1; j < len(runes); j++ {
+				if runes[j] == '\\' && r == '"' && j+1 < len(runes) {
+					j++
+					continue
+				}
+				if !strings.ContainsRune(closers, runes[j]) {
+					continue
+				}
+				if strings.ContainsRune(apostrophes, r) && j+1 < len(runes) && !unicode.IsSpace(runes[j+1]) {
+					continue
+				}
+				end = j
+				break
+			}
+			if end < 0 && strings.ContainsRune(apostrophes, r) {
+				current.WriteRune(r)
+				inWord = true
+				continue
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("missing closing quote for %c", r)
+			}
+
+			value := string(runes[i+1 : end])
+			if r == '"' {
+				value = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(value)
+			}
+			current.WriteString(value)
+
+			tok.quoted = atStart
+			inWord = true
+			i = end
+			continue
+		}
+
+		current.WriteRune(r)
+		inWord = true
+	}
+
+	if inWord {
+		tok.text = current.String()
+		tokens = append(tokens, tok)
+	}
+	return tokens, nil
+}
+
+// contentTypeList returns the valid content types as a comma-separated list.
+func contentTypeList() string {
+	names := make([]string, 0, len(contentTypes))
+	for _, ct := range contentTypes {
+		names = append(names, string(ct))
+	}
+	return strings.Join(names, ", ")
+}
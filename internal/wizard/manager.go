@@ -0,0 +1,466 @@
+package wizard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/minimax-agent/telegram-bot/pkg/logger"
+	"github.com/minimax-agent/telegram-bot/pkg/metrics"
+)
+
+// Wizard lifecycle metrics. A timed-out wizard that is resumed counts as
+// abandoned, resumed and, once finished, completed.
+var (
+	wizardsStarted = metrics.NewCounterVec("wizard_started_total",
+		"Wizards started, by content type.", "content_type")
+	wizardsCompleted = metrics.NewCounterVec("wizard_completed_total",
+		"Wizards finished with a final draft, by content type.", "content_type")
+	wizardsAbandoned = metrics.NewCounterVec("wizard_abandoned_total",
+		"Wizards ended without a final draft, by content type and reason: cancelled, timeout, replaced or error.",
+		"content_type", "reason")
+	wizardsResumed = metrics.NewCounterVec("wizard_resumed_total",
+		"Timed-out wizards resumed, by content type.", "content_type")
+)
+
+// Hooks are called by the manager when a session is about to time out or
+// has timed out. Hooks are never called with the manager lock held.
+type Hooks struct {
+	// OnReminder is called once per period of inactivity when the session
+	// has less than the reminder window left.
+	OnReminder func(ctx context.Context, w *Wizard, remaining time.Duration)
+	// OnExpire is called when a session times out. The session can be
+	// brought back with Manager.Resume until the retention period passes.
+	OnExpire func(ctx context.Context, w *Wizard)
+}
+
+// Manager manages wizard sessions for users.
+type Manager struct {
+	mu        sync.RWMutex
+	sessions  map[int64]*Wizard
+	expired   map[int64]*Wizard
+	timeout   time.Duration
+	reminder  time.Duration
+	retention time.Duration
+	store     Store
+	prompts   *Prompts
+	hooks     Hooks
+	logger    *logger.Logger
+}
+
+// ManagerOption configures the wizard manager.
+type ManagerOption func(*Manager)
+
+// WithStore sets the store used to persist sessions.
+func WithStore(store Store) ManagerOption {
+	return func(m *Manager) {
+		m.store = store
+	}
+}
+
+// WithLogger sets a custom logger.
+func WithLogger(l *logger.Logger) ManagerOption {
+	return func(m *Manager) {
+		m.logger = l
+	}
+}
+
+// WithPrompts sets the prompt templates wizards build their prompt from.
+func WithPrompts(prompts *Prompts) ManagerOption {
+	return func(m *Manager) {
+		m.prompts = prompts
+	}
+}
+
+// WithReminder sets how long before expiry the user is reminded.
+// A zero duration disables reminders.
+func WithReminder(before time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.reminder = before
+	}
+}
+
+// WithRetention sets how long timed-out sessions are kept for resuming.
+func WithRetention(retention time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.retention = retention
+	}
+}
+
+// NewManager creates a new wizard manager.
+func NewManager(timeout time.Duration, opts ...ManagerOption) *Manager {
+	m := &Manager{
+		sessions:  make(map[int64]*Wizard),
+		expired:   make(map[int64]*Wizard),
+		timeout:   timeout,
+		retention: 24 * time.Hour,
+		store:     NewMemoryStore(),
+		prompts:   defaultPrompts,
+		logger:    logger.Default(),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Timeout returns how long a session may be inactive before it expires.
+func (m *Manager) Timeout() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.timeout
+}
+
+// SetTimeouts changes the inactivity timeout and the reminder window of all
+// sessions, including those already running. A zero reminder disables
+// reminders.
+func (m *Manager) SetTimeouts(timeout, reminder time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timeout = timeout
+	m.reminder = reminder
+}
+
+// SetHooks sets the reminder and expiry hooks.
+func (m *Manager) SetHooks(hooks Hooks) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = hooks
+}
+
+// Restore loads persisted sessions from the store. Sessions that timed out
+// while the bot was down are expired (and the user notified) by the next
+// sweep. It returns the number of sessions restored.
+func (m *Manager) Restore() (int, error) {
+	sessions, err := m.store.LoadAll()
+	if err != nil && sessions == nil {
+		return 0, fmt.Errorf("failed to load wizard sessions: %w", err)
+	}
+	if err != nil {
+		m.logger.Warn("Some wizard sessions could not be loaded: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	restored := 0
+	for _, session := range sessions {
+		wizard := m.fromSession(session)
+		if GetSteps(wizard.ContentType) == nil || time.Since(wizard.LastActivity) > m.timeout+m.retention {
+			m.deleteStored(session.UserID)
+			continue
+		}
+
+		if session.Expired {
+			m.expired[session.UserID] = wizard
+			continue
+		}
+
+		m.sessions[session.UserID] = wizard
+		restored++
+	}
+
+	return restored, nil
+}
+
+// StartWizard starts a new wizard session for a user.
+func (m *Manager) StartWizard(userID, chatID int64, contentType ContentType) *Wizard {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	wizard := &Wizard{
+		UserID:       userID,
+		ChatID:       chatID,
+		ContentType:  contentType,
+		Answers:      make(map[string]string),
+		Step:         0,
+		StartedAt:    now,
+		LastActivity: now,
+		prompts:      m.prompts,
+		onChange:     m.persist,
+	}
+
+	if previous, ok := m.sessions[userID]; ok {
+		wizardsAbandoned.With(string(previous.ContentType), "replaced").Inc()
+	}
+	wizardsStarted.With(string(contentType)).Inc()
+
+	m.sessions[userID] = wizard
+	delete(m.expired, userID)
+	m.save(wizard)
+	return wizard
+}
+
+// GetWizard returns the wizard session for a user, if exists. A session that
+// has timed out but not yet been swept is expired on the spot.
+func (m *Manager) GetWizard(userID int64) (*Wizard, bool) {
+	m.mu.RLock()
+	wizard, exists := m.sessions[userID]
+	m.mu.RUnlock()
+	if !exists {
+		return nil, false
+	}
+
+	if time.Since(wizard.lastActivity()) <= m.Timeout() {
+		return wizard, true
+	}
+
+	if m.expire(wizard) {
+		m.notifyExpired(context.Background(), wizard)
+	}
+	return nil, false
+}
+
+// Resume reactivates a timed-out session with its saved answers.
+func (m *Manager) Resume(userID int64) (*Wizard, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wizard, ok := m.expired[userID]
+	if !ok {
+		return nil, false
+	}
+	delete(m.expired, userID)
+	wizardsResumed.With(string(wizard.ContentType)).Inc()
+
+	wizard.touch()
+	m.sessions[userID] = wizard
+	m.save(wizard)
+	return wizard, true
+}
+
+// EndWizard ends a wizard session for a user that could not be finished,
+// e.g. because generating the draft failed.
+func (m *Manager) EndWizard(userID int64) {
+	m.end(userID, func(ct string) { wizardsAbandoned.With(ct, "error").Inc() })
+}
+
+// CompleteWizard ends a wizard session for a user who accepted a draft.
+func (m *Manager) CompleteWizard(userID int64) {
+	m.end(userID, func(ct string) { wizardsCompleted.With(ct).Inc() })
+}
+
+// CancelWizard ends a wizard session for a user who cancelled it.
+func (m *Manager) CancelWizard(userID int64) {
+	m.end(userID, func(ct string) { wizardsAbandoned.With(ct, "cancelled").Inc() })
+}
+
+// end removes the active or expired session of a user, calling count with
+// the content type of an active one.
+func (m *Manager) end(userID int64, count func(contentType string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if wizard, ok := m.sessions[userID]; ok {
+		count(string(wizard.ContentType))
+	}
+	delete(m.sessions, userID)
+	delete(m.expired, userID)
+	m.deleteStored(userID)
+}
+
+// ActiveSessions returns a snapshot of the active wizard sessions, ordered
+// by user ID.
+func (m *Manager) ActiveSessions() []*Session {
+	m.mu.RLock()
+	wizards := make([]*Wizard, 0, len(m.sessions))
+	for _, wizard := range m.sessions {
+		wizards = append(wizards, wizard)
+	}
+	m.mu.RUnlock()
+
+	sessions := make([]*Session, len(wizards))
+	for i, wizard := range wizards {
+		sessions[i] = wizard.snapshot()
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UserID < sessions[j].UserID
+	})
+	return sessions
+}
+
+// Flush saves every session, including expired ones that can still be
+// resumed, to the store, so that a session whose last save failed is not
+// lost on shutdown.
+func (m *Manager) Flush() error {
+	m.mu.RLock()
+	sessions := make([]*Session, 0, len(m.sessions)+len(m.expired))
+	for _, wizard := range m.sessions {
+		sessions = append(sessions, wizard.snapshot())
+	}
+	for _, wizard := range m.expired {
+		session := wizard.snapshot()
+		session.Expired = true
+		sessions = append(sessions, session)
+	}
+	m.mu.RUnlock()
+
+	var errs []error
+	for _, session := range sessions {
+		if err := m.store.Save(session); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save wizard session for user %d: %w", session.UserID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ActiveCount returns the number of active wizard sessions.
+func (m *Manager) ActiveCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.sessions)
+}
+
+// Run sweeps sessions every interval until ctx is cancelled.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Sweep(ctx)
+		}
+	}
+}
+
+// Sweep sends due reminders, expires timed-out sessions and drops expired
+// sessions past the retention period.
+func (m *Manager) Sweep(ctx context.Context) {
+	now := time.Now()
+
+	var remind, expire []*Wizard
+	m.mu.RLock()
+	timeout := m.timeout
+	for _, wizard := range m.sessions {
+		idle := now.Sub(wizard.lastActivity())
+		switch {
+		case idle > m.timeout:
+			expire = append(expire, wizard)
+		case m.reminder > 0 && idle > m.timeout-m.reminder && wizard.markReminded():
+			remind = append(remind, wizard)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, wizard := range remind {
+		m.persist(wizard)
+		m.notifyReminder(ctx, wizard, timeout-now.Sub(wizard.lastActivity()))
+	}
+
+	for _, wizard := range expire {
+		if m.expire(wizard) {
+			m.notifyExpired(ctx, wizard)
+		}
+	}
+
+	m.mu.Lock()
+	for userID, wizard := range m.expired {
+		if now.Sub(wizard.lastActivity()) > m.timeout+m.retention {
+			delete(m.expired, userID)
+			m.deleteStored(userID)
+		}
+	}
+	m.mu.Unlock()
+}
+
+// expire moves an active session to the expired set. It reports false if
+// the session was ended, replaced or refreshed concurrently.
+func (m *Manager) expire(wizard *Wizard) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sessions[wizard.UserID] != wizard || time.Since(wizard.lastActivity()) <= m.timeout {
+		return false
+	}
+
+	delete(m.sessions, wizard.UserID)
+	m.expired[wizard.UserID] = wizard
+	wizardsAbandoned.With(string(wizard.ContentType), "timeout").Inc()
+
+	session := wizard.snapshot()
+	session.Expired = true
+	if err := m.store.Save(session); err != nil {
+		m.logger.Error("Failed to persist expired wizard session for user %d: %v", wizard.UserID, err)
+	}
+	return true
+}
+
+func (m *Manager) notifyReminder(ctx context.Context, w *Wizard, remaining time.Duration) {
+	m.mu.RLock()
+	hook := m.hooks.OnReminder
+	m.mu.RUnlock()
+	if hook != nil {
+		hook(ctx, w, remaining)
+	}
+}
+
+func (m *Manager) notifyExpired(ctx context.Context, w *Wizard) {
+	m.mu.RLock()
+	hook := m.hooks.OnExpire
+	m.mu.RUnlock()
+	if hook != nil {
+		hook(ctx, w)
+	}
+}
+
+// fromSession rebuilds a wizard from its stored state.
+func (m *Manager) fromSession(session *Session) *Wizard {
+	wizard := &Wizard{
+		UserID:       session.UserID,
+		ChatID:       session.ChatID,
+		ContentType:  session.ContentType,
+		Answers:      session.Answers,
+		Flags:        session.Flags,
+		Step:         session.Step,
+		StartedAt:    session.StartedAt,
+		LastActivity: session.LastActivity,
+		Locale:       session.Locale,
+		reminded:     session.Reminded,
+		Prompt:       session.Prompt,
+		Drafts:       session.Drafts,
+		Variants:     session.Variants,
+		prompts:      m.prompts,
+		onChange:     m.persist,
+	}
+	if wizard.Answers == nil {
+		wizard.Answers = make(map[string]string)
+	}
+	// Sessions saved before activity tracking only have a start time
+	if wizard.LastActivity.IsZero() {
+		wizard.LastActivity = wizard.StartedAt
+	}
+	return wizard
+}
+
+// persist saves the wizard to the store if it is still the user's active
+// session, so that a wizard changed after it ended is not written back.
+func (m *Manager) persist(w *Wizard) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions[w.UserID] == w {
+		m.save(w)
+	}
+}
+
+// save saves the wizard to the store, logging failures. The caller must
+// hold m.mu.
+func (m *Manager) save(w *Wizard) {
+	if err := m.store.Save(w.snapshot()); err != nil {
+		m.logger.Error("Failed to persist wizard session for user %d: %v", w.UserID, err)
+	}
+}
+
+// deleteStored removes a wizard from the store, logging failures.
+func (m *Manager) deleteStored(userID int64) {
+	if err := m.store.Delete(userID); err != nil {
+		m.logger.Error("Failed to delete wizard session for user %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,311 @@
+package wizard
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/minimax-agent/telegram-bot/pkg/logger"
+)
+
+//go:embed prompts/*.tmpl
+var embeddedPrompts embed.FS
+
+// defaultPrompts is the built-in prompt set, used when a wizard has none.
+var defaultPrompts = mustDefaultPrompts()
+
+// PromptData is what prompt templates are executed with, e.g.
+// {{.Answers.topic}}, {{.Locale}} or {{.Flags.style}}. Every question key
+// of the content type is present in Answers and every /create flag name in
+// Flags, empty if not given, so referring to anything else is an error.
+type PromptData struct {
+	ContentType ContentType
+	Answers     map[string]string
+	Locale      string
+	Flags       map[string]string
+}
+
+// Prompts is a set of prompt templates, one <type>.tmpl per content type
+// plus shared _*.tmpl definitions. Files in the prompts directory replace
+// the built-in files of the same name.
+type Prompts struct {
+	dir    string
+	logger *logger.Logger
+
+	mu        sync.RWMutex
+	templates map[ContentType]*template.Template
+	modTimes  map[string]time.Time
+}
+
+// PromptsOption configures a prompt set.
+type PromptsOption func(*Prompts)
+
+// WithPromptsLogger sets the logger used to report reloads.
+func WithPromptsLogger(l *logger.Logger) PromptsOption {
+	return func(p *Prompts) {
+		p.logger = l
+	}
+}
+
+// NewPrompts loads the built-in prompt templates with the overrides in dir,
+// which may be empty for none. Every template is validated, so a template
+// referring to an unknown answer key or flag is reported here rather than
+// when a user finishes a wizard.
+func NewPrompts(dir string, opts ...PromptsOption) (*Prompts, error) {
+	p := &Prompts{
+		dir:    dir,
+		logger: logger.Default(),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func mustDefaultPrompts() *Prompts {
+	p := &Prompts{logger: logger.Default()}
+	if err := p.Reload(); err != nil {
+		panic(fmt.Sprintf("invalid built-in prompt templates: %v", err))
+	}
+	return p
+}
+
+// Reload reads and validates the templates again. On error the templates
+// in use are kept.
+func (p *Prompts) Reload() error {
+	modTimes, err := p.scan()
+	if err != nil {
+		return err
+	}
+	templates, err := p.load()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.templates = templates
+	p.modTimes = modTimes
+	return nil
+}
+
+// Watch reloads the templates whenever a file in the prompts directory
+// changes, until ctx is done. Invalid changes are logged and ignored.
+func (p *Prompts) Watch(ctx context.Context, interval time.Duration) {
+	if p.dir == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !p.changed() {
+				continue
+			}
+			if err := p.Reload(); err != nil {
+				p.logger.Error("Failed to reload prompt templates, keeping the previous ones: %v", err)
+				// Remember the broken state so the error is not logged every tick
+				if modTimes, err := p.scan(); err == nil {
+					p.mu.Lock()
+					p.modTimes = modTimes
+					p.mu.Unlock()
+				}
+				continue
+			}
+			p.logger.Info("Reloaded prompt templates from %s", p.dir)
+		}
+	}
+}
+
+// Render executes the template for data.ContentType.
+func (p *Prompts) Render(data PromptData) (string, error) {
+	p.mu.RLock()
+	tmpl, ok := p.templates[data.ContentType]
+	p.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("no prompt template for content type %q", data.ContentType)
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, completeData(data)); err != nil {
+		return "", fmt.Errorf("failed to render %s prompt: %w", data.ContentType, err)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// completeData returns a copy of data with every question key and flag
+// name of the content type present.
+func completeData(data PromptData) PromptData {
+	complete := data
+	complete.Answers = make(map[string]string)
+	for _, step := range GetSteps(data.ContentType) {
+		complete.Answers[step.Key] = ""
+	}
+	for k, v := range data.Answers {
+		complete.Answers[k] = v
+	}
+
+	complete.Flags = make(map[string]string)
+	for _, spec := range FlagSpecs(data.ContentType) {
+		complete.Flags[spec.Name] = ""
+	}
+	for k, v := range data.Flags {
+		complete.Flags[k] = v
+	}
+	return complete
+}
+
+// load parses and validates the built-in templates and overrides.
+func (p *Prompts) load() (map[ContentType]*template.Template, error) {
+	files, err := p.readFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	// Shared definitions are parsed into every content type's template
+	var shared []string
+	for name := range files {
+		if strings.HasPrefix(name, "_") {
+			shared = append(shared, name)
+		}
+	}
+	sort.Strings(shared)
+
+	templates := make(map[ContentType]*template.Template, len(contentTypes))
+	var errs []error
+	for _, ct := range contentTypes {
+		name := string(ct) + ".tmpl"
+		body, ok := files[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("missing prompt template %s", name))
+			continue
+		}
+
+		tmpl := template.New(string(ct)).Option("missingkey=error")
+		for _, s := range shared {
+			if _, err := tmpl.New(s).Parse(files[s]); err != nil {
+				errs = append(errs, fmt.Errorf("invalid prompt template %s: %w", s, err))
+			}
+		}
+		if _, err := tmpl.Parse(body); err != nil {
+			errs = append(errs, fmt.Errorf("invalid prompt template %s: %w", name, err))
+			continue
+		}
+
+		// Render with every key present to catch references to unknown ones
+		sample := PromptData{ContentType: ct, Locale: "en"}
+		if err := tmpl.Execute(io.Discard, completeData(sample)); err != nil {
+			errs = append(errs, fmt.Errorf("invalid prompt template %s: %w", name, err))
+			continue
+		}
+		templates[ct] = tmpl
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// readFiles returns the built-in template files with the overrides from
+// the prompts directory applied.
+func (p *Prompts) readFiles() (map[string]string, error) {
+	files := make(map[string]string)
+
+	entries, err := fs.ReadDir(embeddedPrompts, "prompts")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read built-in prompt templates: %w", err)
+	}
+	for _, entry := range entries {
+		data, err := fs.ReadFile(embeddedPrompts, path.Join("prompts", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read built-in prompt template %s: %w", entry.Name(), err)
+		}
+		files[entry.Name()] = string(data)
+	}
+
+	if p.dir == "" {
+		return files, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(p.dir, "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompt templates: %w", err)
+	}
+	for _, file := range paths {
+		name := filepath.Base(file)
+		if _, ok := files[name]; !ok && !strings.HasPrefix(name, "_") {
+			return nil, fmt.Errorf("unknown prompt template %s, expected <type>.tmpl with type one of: %s", name, contentTypeList())
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template: %w", err)
+		}
+		files[name] = string(data)
+	}
+	return files, nil
+}
+
+// scan returns the modification times of the files in the prompts directory.
+func (p *Prompts) scan() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	if p.dir == "" {
+		return modTimes, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(p.dir, "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompt templates: %w", err)
+	}
+	for _, file := range paths {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template: %w", err)
+		}
+		modTimes[file] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// changed reports whether files were added, removed or modified since the
+// last load.
+func (p *Prompts) changed() bool {
+	modTimes, err := p.scan()
+	if err != nil {
+		p.logger.Error("Failed to check prompt templates for changes: %v", err)
+		return false
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if len(modTimes) != len(p.modTimes) {
+		return true
+	}
+	for file, modTime := range modTimes {
+		if prev, ok := p.modTimes[file]; !ok || !prev.Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package wizard
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// InferPrompt builds a prompt asking the model to fill in the missing
+// answers of a wizard from the answers the user gave. The model is asked
+// to reply with a JSON object keyed by step key.
+func (w *Wizard) InferPrompt(missing []WizardStep) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "A user is creating %s content and answered these questions:\n\n", w.ContentType)
+	answers := w.GetAnswers()
+	for _, step := range GetSteps(w.ContentType) {
+		if answer, ok := answers[step.Key]; ok {
+			fmt.Fprintf(&sb, "%s\n%s\n\n", step.Question, answer)
+		}
+	}
+
+	sb.WriteString("Suggest sensible answers for the remaining questions, consistent with the answers above:\n\n")
+	for _, step := range missing {
+		fmt.Fprintf(&sb, "%s: %s\n", step.Key, step.Question)
+	}
+	sb.WriteString("\nReply with a single JSON object mapping each key above to a short answer, and nothing else.")
+	return sb.String()
+}
+
+// ParseInferred extracts the answers for the missing steps from the model
+// reply to InferPrompt. Steps the reply does not answer get their default,
+// so every missing step is filled even if the reply is unusable.
+func ParseInferred(reply string, missing []WizardStep) map[string]string {
+	var inferred map[string]interface{}
+	if start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}"); start >= 0 && end > start {
+		// Ignore errors, the defaults cover a malformed reply
+		_ = json.Unmarshal([]byte(reply[start:end+1]), &inferred)
+	}
+
+	answers := make(map[string]string, len(missing))
+	for _, step := range missing {
+		answers[step.Key] = step.Default
+		if value, ok := inferred[step.Key]; ok && value != nil {
+			if text := strings.TrimSpace(fmt.Sprint(value)); text != "" {
+				answers[step.Key] = text
+			}
+		}
+	}
+	return answers
+}
+
+// DefaultAnswers returns the default answers for the missing steps.
+func DefaultAnswers(missing []WizardStep) map[string]string {
+	return ParseInferred("", missing)
+}
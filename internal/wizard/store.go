@@ -0,0 +1,196 @@
+package wizard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session is the serializable state of a wizard.
+type Session struct {
+	UserID       int64             `json:"user_id"`
+	ChatID       int64             `json:"chat_id"`
+	ContentType  ContentType       `json:"content_type"`
+	Answers      map[string]string `json:"answers"`
+	Flags        map[string]string `json:"flags,omitempty"`
+	Step         int               `json:"step"`
+	StartedAt    time.Time         `json:"started_at"`
+	LastActivity time.Time         `json:"last_activity"`
+	Locale       string            `json:"locale,omitempty"`
+	Reminded     bool              `json:"reminded,omitempty"`
+	Prompt       string            `json:"prompt,omitempty"`
+	Drafts       []Draft           `json:"drafts,omitempty"`
+	Variants     []string          `json:"variants,omitempty"`
+	// Expired marks a timed-out session kept so the user can resume it.
+	Expired bool `json:"expired,omitempty"`
+}
+
+// Store persists wizard sessions so they survive restarts.
+type Store interface {
+	// Save creates or replaces the session for session.UserID.
+	Save(session *Session) error
+	// Delete removes the session for a user. Deleting a missing session is not an error.
+	Delete(userID int64) error
+	// LoadAll returns every stored session.
+	LoadAll() ([]*Session, error)
+}
+
+// MemoryStore is a Store that keeps sessions in memory only.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[int64]*Session
+}
+
+// NewMemoryStore creates a new in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[int64]*Session),
+	}
+}
+
+// Save stores a copy of the session.
+func (s *MemoryStore) Save(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.UserID] = session.clone()
+	return nil
+}
+
+// Delete removes the session for a user.
+func (s *MemoryStore) Delete(userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, userID)
+	return nil
+}
+
+// LoadAll returns copies of all stored sessions.
+func (s *MemoryStore) LoadAll() ([]*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session.clone())
+	}
+	return sessions, nil
+}
+
+// FileStore is a Store that keeps one JSON file per user in a directory.
+type FileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileStore creates a file store rooted at dir, creating the directory if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("store directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Save writes the session to disk atomically.
+func (s *FileStore) Save(session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, ".session-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path(session.UserID)); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the session file for a user.
+func (s *FileStore) Delete(userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(userID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// LoadAll reads every session file in the store directory. Unreadable files
+// are skipped and reported in the returned error alongside the sessions that
+// did load.
+func (s *FileStore) LoadAll() ([]*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store directory: %w", err)
+	}
+
+	sessions := make([]*Session, 0, len(entries))
+	var errs []error
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read session %s: %w", name, err))
+			continue
+		}
+
+		var session Session
+		if err := json.Unmarshal(data, &session); err != nil {
+			errs = append(errs, fmt.Errorf("failed to unmarshal session %s: %w", name, err))
+			continue
+		}
+		sessions = append(sessions, &session)
+	}
+	return sessions, errors.Join(errs...)
+}
+
+func (s *FileStore) path(userID int64) string {
+	return filepath.Join(s.dir, strconv.FormatInt(userID, 10)+".json")
+}
+
+func (s *Session) clone() *Session {
+	c := *s
+	c.Answers = make(map[string]string, len(s.Answers))
+	for k, v := range s.Answers {
+		c.Answers[k] = v
+	}
+	c.Flags = make(map[string]string, len(s.Flags))
+	for k, v := range s.Flags {
+		c.Flags[k] = v
+	}
+	c.Drafts = make([]Draft, len(s.Drafts))
+	copy(c.Drafts, s.Drafts)
+	c.Variants = make([]string, len(s.Variants))
+	copy(c.Variants, s.Variants)
+	return &c
+}
@@ -19,99 +19,265 @@ const (
 	ContentTypeWhitepaper ContentType = "whitepaper"
 	ContentTypeStory      ContentType = "story"
 	ContentTypePoem       ContentType = "poem"
+
+	ContentTypeTwitter      ContentType = "twitter"
+	ContentTypeLinkedIn     ContentType = "linkedin"
+	ContentTypeInstagram    ContentType = "instagram"
+	ContentTypeProduct      ContentType = "product"
+	ContentTypePressRelease ContentType = "pressrelease"
+	ContentTypeGoogleAds    ContentType = "googleads"
 )
 
+// contentTypes lists the supported content types in the order shown to users.
+var contentTypes = []ContentType{
+	ContentTypeMarketing,
+	ContentTypeEmail,
+	ContentTypeReport,
+	ContentTypeScript,
+	ContentTypeWhitepaper,
+	ContentTypeStory,
+	ContentTypePoem,
+	ContentTypeTwitter,
+	ContentTypeLinkedIn,
+	ContentTypeInstagram,
+	ContentTypeProduct,
+	ContentTypePressRelease,
+	ContentTypeGoogleAds,
+}
+
+// contentTypeAliases maps alternative names users type to content types.
+var contentTypeAliases = map[string]ContentType{
+	"x":      ContentTypeTwitter,
+	"thread": ContentTypeTwitter,
+	"ig":     ContentTypeInstagram,
+	"press":  ContentTypePressRelease,
+	"ads":    ContentTypeGoogleAds,
+	"ad":     ContentTypeGoogleAds,
+}
+
 // Wizard represents an interactive wizard session.
 type Wizard struct {
-	UserID      int64
-	ContentType ContentType
-	Answers     map[string]string
-	Step        int
-	StartedAt   time.Time
-	mu          sync.RWMutex
+	UserID       int64
+	ChatID       int64
+	ContentType  ContentType
+	Answers      map[string]string
+	Flags        map[string]string
+	Step         int
+	StartedAt    time.Time
+	LastActivity time.Time
+	// Locale is the user's language code, available to prompt templates.
+	Locale string
+	mu     sync.RWMutex
+
+	// Prompt and Drafts are set once content has been generated and the
+	// wizard moves on to refining it. Variants holds generated alternatives
+	// until the user picks one as the first draft.
+	Prompt   string
+	Drafts   []Draft
+	Variants []string
+
+	// reminded records whether the expiry reminder has been sent since the
+	// last activity.
+	reminded bool
+
+	// prompts renders the generation prompt.
+	prompts *Prompts
+
+	// onChange is called after the wizard state changes so the owning
+	// manager can persist it.
+	onChange func(*Wizard)
+}
+
+// lastActivity returns when the user last interacted with the wizard.
+func (w *Wizard) lastActivity() time.Time {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.LastActivity
 }
 
-// Manager manages wizard sessions for users.
-type Manager struct {
-	mu       sync.RWMutex
-	sessions map[int64]*Wizard
-	timeout  time.Duration
+// touch records user activity, restarting the inactivity timeout.
+func (w *Wizard) touch() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.LastActivity = time.Now()
+	w.reminded = false
 }
 
-// NewManager creates a new wizard manager.
-func NewManager(timeout time.Duration) *Manager {
-	return &Manager{
-		sessions: make(map[int64]*Wizard),
-		timeout:  timeout,
+// markReminded records that the expiry reminder was sent. It reports false
+// if the reminder had already been sent.
+func (w *Wizard) markReminded() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.reminded {
+		return false
 	}
+	w.reminded = true
+	return true
 }
 
-// StartWizard starts a new wizard session for a user.
-func (m *Manager) StartWizard(userID int64, contentType ContentType) *Wizard {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// snapshot returns the serializable state of the wizard.
+func (w *Wizard) snapshot() *Session {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	session := &Session{
+		UserID:       w.UserID,
+		ChatID:       w.ChatID,
+		ContentType:  w.ContentType,
+		Step:         w.Step,
+		StartedAt:    w.StartedAt,
+		LastActivity: w.LastActivity,
+		Locale:       w.Locale,
+		Reminded:     w.reminded,
+		Prompt:       w.Prompt,
+	}
+	session.Drafts = make([]Draft, len(w.Drafts))
+	copy(session.Drafts, w.Drafts)
+	session.Variants = make([]string, len(w.Variants))
+	copy(session.Variants, w.Variants)
+	session.Flags = make(map[string]string, len(w.Flags))
+	for k, v := range w.Flags {
+		session.Flags[k] = v
+	}
+	session.Answers = make(map[string]string, len(w.Answers))
+	for k, v := range w.Answers {
+		session.Answers[k] = v
+	}
+	return session
+}
 
-	wizard := &Wizard{
-		UserID:      userID,
-		ContentType: contentType,
-		Answers:     make(map[string]string),
-		Step:        0,
-		StartedAt:   time.Now(),
+// GetProgress returns the current progress as a string.
+func (w *Wizard) GetProgress() string {
+	steps := GetSteps(w.ContentType)
+	if steps == nil {
+		return ""
 	}
 
-	m.sessions[userID] = wizard
-	return wizard
+	// In quick mode only the essential steps are counted
+	quick := w.IsQuick()
+	current, total := 0, 0
+	for i, step := range steps {
+		if quick && !step.Essential {
+			continue
+		}
+		if i < w.GetStep() {
+			current++
+		}
+		total++
+	}
+	return fmt.Sprintf("(Step %d of %d)", current+1, total)
 }
 
-// GetWizard returns the wizard session for a user, if exists.
-func (m *Manager) GetWizard(userID int64) (*Wizard, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// IsQuick returns true if the wizard was started with -q and only asks
+// the essential questions.
+func (w *Wizard) IsQuick() bool {
+	return w.GetFlag(FlagQuick) == "true"
+}
 
-	wizard, exists := m.sessions[userID]
-	if !exists {
-		return nil, false
+// SetAnswer sets an answer for the current step.
+func (w *Wizard) SetAnswer(key, value string) {
+	w.mu.Lock()
+	w.Answers[key] = value
+	w.Step++
+	w.skipAnswered()
+	w.LastActivity = time.Now()
+	w.reminded = false
+	w.mu.Unlock()
+
+	if w.onChange != nil {
+		w.onChange(w)
 	}
+}
 
-	// Check timeout
-	if time.Since(wizard.StartedAt) > m.timeout {
-		m.mu.RUnlock()
-		m.mu.Lock()
-		delete(m.sessions, userID)
-		m.mu.Unlock()
-		return nil, false
+// Prefill records answers given up front, such as /create flags or a brand
+// profile. Questions that already have an answer are skipped, and answers
+// to questions this content type does not ask are ignored.
+func (w *Wizard) Prefill(answers map[string]string) {
+	w.mu.Lock()
+	for _, step := range GetSteps(w.ContentType) {
+		if answer, ok := answers[step.Key]; ok {
+			w.Answers[step.Key] = answer
+		}
 	}
+	w.skipAnswered()
+	w.mu.Unlock()
 
-	return wizard, true
+	if w.onChange != nil {
+		w.onChange(w)
+	}
 }
 
-// EndWizard ends a wizard session for a user.
-func (m *Manager) EndWizard(userID int64) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	delete(m.sessions, userID)
+// skipAnswered advances past steps that already have an answer, and in
+// quick mode past optional steps. The caller must hold w.mu.
+func (w *Wizard) skipAnswered() {
+	steps := GetSteps(w.ContentType)
+	quick := w.Flags[FlagQuick] == "true"
+	for w.Step < len(steps) {
+		step := steps[w.Step]
+		if _, ok := w.Answers[step.Key]; !ok && (step.Essential || !quick) {
+			return
+		}
+		w.Step++
+	}
 }
 
-// CancelWizard cancels a wizard session for a user (alias for EndWizard).
-func (m *Manager) CancelWizard(userID int64) {
-	m.EndWizard(userID)
+// BrandAnswers returns the answers to brand steps, which can be saved to a
+// brand profile.
+func (w *Wizard) BrandAnswers() map[string]string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	answers := make(map[string]string)
+	for _, step := range GetSteps(w.ContentType) {
+		if answer, ok := w.Answers[step.Key]; ok && step.Brand {
+			answers[step.Key] = answer
+		}
+	}
+	return answers
 }
 
-// GetProgress returns the current progress as a string.
-func (w *Wizard) GetProgress() string {
-	steps := GetSteps(w.ContentType)
-	if steps == nil {
-		return ""
+// MissingSteps returns the steps that have not been answered, such as the
+// optional steps skipped in quick mode.
+func (w *Wizard) MissingSteps() []WizardStep {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	var missing []WizardStep
+	for _, step := range GetSteps(w.ContentType) {
+		if _, ok := w.Answers[step.Key]; !ok {
+			missing = append(missing, step)
+		}
 	}
-	return fmt.Sprintf("(Step %d of %d)", w.GetStep()+1, len(steps))
+	return missing
 }
 
-// SetAnswer sets an answer for the current step.
-func (w *Wizard) SetAnswer(key, value string) {
+// SetFlags records the command flags the wizard was started with.
+func (w *Wizard) SetFlags(flags map[string]string) {
 	w.mu.Lock()
-	defer w.mu.Unlock()
-	w.Answers[key] = value
-	w.Step++
+	w.Flags = make(map[string]string, len(flags))
+	for k, v := range flags {
+		w.Flags[k] = v
+	}
+	w.mu.Unlock()
+
+	if w.onChange != nil {
+		w.onChange(w)
+	}
+}
+
+// SetLocale records the user's language code.
+func (w *Wizard) SetLocale(locale string) {
+	w.mu.Lock()
+	w.Locale = locale
+	w.mu.Unlock()
+
+	if w.onChange != nil {
+		w.onChange(w)
+	}
+}
+
+// GetFlag returns the value of a command flag the wizard was started with.
+func (w *Wizard) GetFlag(name string) string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.Flags[name]
 }
 
 // GetAnswer gets an answer by key.
@@ -144,42 +310,64 @@ type WizardStep struct {
 	Key      string
 	Question string
 	Validate func(answer string) error
+
+	// Essential steps are asked in quick mode; the others are inferred
+	// from the essential answers, falling back to Default.
+	Essential bool
+	Default   string
+
+	// Brand steps describe the business rather than a single piece of
+	// content, so their answers are saved to brand profiles.
+	Brand bool
 }
 
 // GetMarketingSteps returns the wizard steps for marketing content.
 func GetMarketingSteps() []WizardStep {
 	return []WizardStep{
 		{
-			Key:      "website_name",
-			Question: "What is the name of your website or business?",
+			Key:       "website_name",
+			Question:  "What is the name of your website or business?",
+			Essential: true,
+			Brand:     true,
 		},
 		{
 			Key:      "website_url",
 			Question: "What is the URL of your website?",
+			Default:  "not provided",
+			Brand:    true,
 		},
 		{
 			Key:      "target_audience",
 			Question: "Who is your target audience? (e.g., small business owners, tech enthusiasts)",
+			Default:  "general audience",
+			Brand:    true,
 		},
 		{
-			Key:      "key_benefits",
-			Question: "What are the key benefits or features of your product/service?",
+			Key:       "key_benefits",
+			Question:  "What are the key benefits or features of your product/service?",
+			Essential: true,
+			Brand:     true,
 		},
 		{
 			Key:      "tone",
 			Question: "What tone would you like? (e.g., professional, friendly, urgent, humorous)",
+			Default:  "professional",
+			Brand:    true,
 		},
 		{
 			Key:      "length",
 			Question: "What length would you like? (short/medium/long)",
+			Default:  "medium",
 		},
 		{
 			Key:      "topic",
 			Question: "What specific topic or angle should the marketing copy focus on?",
+			Default:  "general overview",
 		},
 		{
 			Key:      "cta",
 			Question: "What call-to-action should be included? (e.g., Sign up now, Learn more, Contact us)",
+			Default:  "Learn more",
 		},
 	}
 }
@@ -194,22 +382,29 @@ func GetEmailSteps() []WizardStep {
 		{
 			Key:      "recipient",
 			Question: "Who is the recipient? (e.g., potential customers, existing clients)",
+			Default:  "existing customers",
+			Brand:    true,
 		},
 		{
-			Key:      "purpose",
-			Question: "What is the purpose of this email? (e.g., newsletter, promotion, announcement)",
+			Key:       "purpose",
+			Question:  "What is the purpose of this email? (e.g., newsletter, promotion, announcement)",
+			Essential: true,
 		},
 		{
 			Key:      "tone",
 			Question: "What tone would you like? (e.g., formal, casual, friendly)",
+			Default:  "friendly",
+			Brand:    true,
 		},
 		{
-			Key:      "key_message",
-			Question: "What is the key message or offer you want to convey?",
+			Key:       "key_message",
+			Question:  "What is the key message or offer you want to convey?",
+			Essential: true,
 		},
 		{
 			Key:      "cta",
 			Question: "What action should the recipient take? (e.g., Click here, Reply, Visit)",
+			Default:  "Reply",
 		},
 	}
 }
@@ -224,26 +419,33 @@ func GetReportSteps() []WizardStep {
 		{
 			Key:      "audience",
 			Question: "Who is the target audience for this report?",
+			Default:  "business stakeholders",
+			Brand:    true,
 		},
 		{
-			Key:      "topic",
-			Question: "What is the main topic or subject of the report?",
+			Key:       "topic",
+			Question:  "What is the main topic or subject of the report?",
+			Essential: true,
 		},
 		{
 			Key:      "scope",
 			Question: "What is the scope of the report? (e.g., industry analysis, market research)",
+			Default:  "general analysis",
 		},
 		{
-			Key:      "key_points",
-			Question: "What are the key points or findings to include?",
+			Key:       "key_points",
+			Question:  "What are the key points or findings to include?",
+			Essential: true,
 		},
 		{
 			Key:      "length",
 			Question: "What length would you like? (brief/medium/comprehensive)",
+			Default:  "medium",
 		},
 		{
 			Key:      "format",
 			Question: "What format would you prefer? (e.g., executive summary, detailed analysis)",
+			Default:  "detailed analysis",
 		},
 	}
 }
@@ -252,24 +454,31 @@ func GetReportSteps() []WizardStep {
 func GetScriptSteps() []WizardStep {
 	return []WizardStep{
 		{
-			Key:      "type",
-			Question: "What type of script? (e.g., video, podcast, advertisement)",
+			Key:       "type",
+			Question:  "What type of script? (e.g., video, podcast, advertisement)",
+			Essential: true,
 		},
 		{
-			Key:      "topic",
-			Question: "What is the main topic or subject?",
+			Key:       "topic",
+			Question:  "What is the main topic or subject?",
+			Essential: true,
 		},
 		{
 			Key:      "duration",
 			Question: "What is the desired duration? (e.g., 30 seconds, 5 minutes)",
+			Default:  "2 minutes",
 		},
 		{
 			Key:      "audience",
 			Question: "Who is the target audience?",
+			Default:  "general audience",
+			Brand:    true,
 		},
 		{
 			Key:      "tone",
 			Question: "What tone would you like? (e.g., serious, humorous, inspirational)",
+			Default:  "engaging",
+			Brand:    true,
 		},
 		{
 			Key:      "key_message",
@@ -278,6 +487,7 @@ func GetScriptSteps() []WizardStep {
 		{
 			Key:      "cta",
 			Question: "What call-to-action should be included?",
+			Default:  "none",
 		},
 	}
 }
@@ -290,16 +500,20 @@ func GetWhitepaperSteps() []WizardStep {
 			Question: "What is the title of the whitepaper?",
 		},
 		{
-			Key:      "topic",
-			Question: "What is the main topic or research question?",
+			Key:       "topic",
+			Question:  "What is the main topic or research question?",
+			Essential: true,
 		},
 		{
 			Key:      "audience",
 			Question: "Who is the target audience?",
+			Default:  "industry professionals",
+			Brand:    true,
 		},
 		{
-			Key:      "problem",
-			Question: "What problem or challenge does it address?",
+			Key:       "problem",
+			Question:  "What problem or challenge does it address?",
+			Essential: true,
 		},
 		{
 			Key:      "solution",
@@ -308,10 +522,13 @@ func GetWhitepaperSteps() []WizardStep {
 		{
 			Key:      "length",
 			Question: "What length would you like? (short/medium/long)",
+			Default:  "medium",
 		},
 		{
 			Key:      "tone",
 			Question: "What tone would you like? (e.g., academic, professional, accessible)",
+			Default:  "professional",
+			Brand:    true,
 		},
 	}
 }
@@ -320,16 +537,19 @@ func GetWhitepaperSteps() []WizardStep {
 func GetStorySteps() []WizardStep {
 	return []WizardStep{
 		{
-			Key:      "genre",
-			Question: "What genre? (e.g., sci-fi, fantasy, romance, mystery, literary)",
+			Key:       "genre",
+			Question:  "What genre? (e.g., sci-fi, fantasy, romance, mystery, literary)",
+			Essential: true,
 		},
 		{
-			Key:      "premise",
-			Question: "What is the premise or plot idea?",
+			Key:       "premise",
+			Question:  "What is the premise or plot idea?",
+			Essential: true,
 		},
 		{
 			Key:      "characters",
 			Question: "Describe the main characters (optional):",
+			Default:  "none specified",
 		},
 		{
 			Key:      "setting",
@@ -342,6 +562,7 @@ func GetStorySteps() []WizardStep {
 		{
 			Key:      "length",
 			Question: "What length? (short story/novella/novel excerpt)",
+			Default:  "short story",
 		},
 	}
 }
@@ -352,10 +573,12 @@ func GetPoemSteps() []WizardStep {
 		{
 			Key:      "style",
 			Question: "What style of poem? (e.g., haiku, sonnet, free verse, limerick, ballad)",
+			Default:  "free verse",
 		},
 		{
-			Key:      "topic",
-			Question: "What is the topic or theme?",
+			Key:       "topic",
+			Question:  "What is the topic or theme?",
+			Essential: true,
 		},
 		{
 			Key:      "mood",
@@ -364,10 +587,254 @@ func GetPoemSteps() []WizardStep {
 		{
 			Key:      "length",
 			Question: "How many lines? (e.g., 4, 8, 16, 32)",
+			Default:  "16",
 		},
 		{
 			Key:      "structure",
 			Question: "Any specific structure or rhyming scheme? (optional)",
+			Default:  "none",
+		},
+	}
+}
+
+// GetTwitterSteps returns the wizard steps for a Twitter/X thread.
+func GetTwitterSteps() []WizardStep {
+	return []WizardStep{
+		{
+			Key:       "topic",
+			Question:  "What is the thread about?",
+			Essential: true,
+		},
+		{
+			Key:      "target_audience",
+			Question: "Who is your target audience?",
+			Default:  "general audience",
+			Brand:    true,
+		},
+		{
+			Key:      "key_points",
+			Question: "What key points should the thread make?",
+		},
+		{
+			Key:      "tweets",
+			Question: "How many tweets? (e.g., 3, 6, 10)",
+			Default:  "6",
+		},
+		{
+			Key:      "tone",
+			Question: "What tone would you like? (e.g., conversational, witty, authoritative)",
+			Default:  "conversational",
+			Brand:    true,
+		},
+		{
+			Key:      "cta",
+			Question: "How should the thread end? (e.g., Follow for more, Read the blog post)",
+			Default:  "Follow for more",
+		},
+	}
+}
+
+// GetLinkedInSteps returns the wizard steps for a LinkedIn post.
+func GetLinkedInSteps() []WizardStep {
+	return []WizardStep{
+		{
+			Key:       "topic",
+			Question:  "What is the post about?",
+			Essential: true,
+		},
+		{
+			Key:      "author",
+			Question: "Who is posting? (e.g., founder, company page, recruiter)",
+			Default:  "company page",
+			Brand:    true,
+		},
+		{
+			Key:      "target_audience",
+			Question: "Who is your target audience?",
+			Default:  "professionals in your industry",
+			Brand:    true,
+		},
+		{
+			Key:       "key_message",
+			Question:  "What is the key message or story?",
+			Essential: true,
+		},
+		{
+			Key:      "tone",
+			Question: "What tone would you like? (e.g., professional, inspiring, personal)",
+			Default:  "professional",
+			Brand:    true,
+		},
+		{
+			Key:      "cta",
+			Question: "What should readers do? (e.g., Comment, Visit our website, Apply now)",
+			Default:  "Share your thoughts in the comments",
+		},
+		{
+			Key:      "hashtags",
+			Question: "How many hashtags? (0-5)",
+			Default:  "3",
+		},
+	}
+}
+
+// GetInstagramSteps returns the wizard steps for an Instagram caption.
+func GetInstagramSteps() []WizardStep {
+	return []WizardStep{
+		{
+			Key:       "subject",
+			Question:  "What does the post show?",
+			Essential: true,
+		},
+		{
+			Key:      "website_name",
+			Question: "What is your brand or account name?",
+			Brand:    true,
+		},
+		{
+			Key:      "target_audience",
+			Question: "Who is your target audience?",
+			Default:  "followers of the account",
+			Brand:    true,
+		},
+		{
+			Key:      "tone",
+			Question: "What tone would you like? (e.g., fun, aspirational, cozy)",
+			Default:  "fun",
+			Brand:    true,
+		},
+		{
+			Key:      "cta",
+			Question: "What call-to-action should be included? (e.g., Link in bio, Tag a friend)",
+			Default:  "Link in bio",
+		},
+		{
+			Key:      "hashtags",
+			Question: "How many hashtags? (up to 30)",
+			Default:  "10",
+		},
+	}
+}
+
+// GetProductSteps returns the wizard steps for an e-commerce product description.
+func GetProductSteps() []WizardStep {
+	return []WizardStep{
+		{
+			Key:       "product_name",
+			Question:  "What is the product called?",
+			Essential: true,
+		},
+		{
+			Key:       "features",
+			Question:  "What are its key features and specifications?",
+			Essential: true,
+		},
+		{
+			Key:      "target_audience",
+			Question: "Who is the product for?",
+			Default:  "online shoppers",
+			Brand:    true,
+		},
+		{
+			Key:      "benefits",
+			Question: "What problem does it solve or what benefits does it bring?",
+		},
+		{
+			Key:      "tone",
+			Question: "What tone would you like? (e.g., persuasive, luxurious, playful)",
+			Default:  "persuasive",
+			Brand:    true,
+		},
+		{
+			Key:      "length",
+			Question: "What length would you like? (short/medium/long)",
+			Default:  "medium",
+		},
+		{
+			Key:      "keywords",
+			Question: "Any SEO keywords to include? (optional)",
+			Default:  "none",
+		},
+	}
+}
+
+// GetPressReleaseSteps returns the wizard steps for a press release.
+func GetPressReleaseSteps() []WizardStep {
+	return []WizardStep{
+		{
+			Key:       "website_name",
+			Question:  "Which organization is issuing the release?",
+			Essential: true,
+			Brand:     true,
+		},
+		{
+			Key:       "announcement",
+			Question:  "What is being announced?",
+			Essential: true,
+		},
+		{
+			Key:      "dateline",
+			Question: "Where and when? (e.g., Berlin, 3 March 2025)",
+			Default:  "[City], [Date]",
+		},
+		{
+			Key:      "details",
+			Question: "What are the key details? (who, what, when, where, why)",
+		},
+		{
+			Key:      "quote",
+			Question: "Who should be quoted, and what should they say? (optional)",
+			Default:  "none",
+		},
+		{
+			Key:      "boilerplate",
+			Question: "Describe the organization in a few sentences (the \"About\" section):",
+			Brand:    true,
+		},
+		{
+			Key:      "contact",
+			Question: "Media contact details:",
+			Default:  "[Contact details]",
+			Brand:    true,
+		},
+	}
+}
+
+// GetGoogleAdsSteps returns the wizard steps for Google Ads copy.
+func GetGoogleAdsSteps() []WizardStep {
+	return []WizardStep{
+		{
+			Key:       "website_name",
+			Question:  "What business or product is being advertised?",
+			Essential: true,
+			Brand:     true,
+		},
+		{
+			Key:      "website_url",
+			Question: "What is the landing page URL?",
+			Default:  "not provided",
+			Brand:    true,
+		},
+		{
+			Key:       "keywords",
+			Question:  "Which search keywords should the ad target?",
+			Essential: true,
+		},
+		{
+			Key:      "key_benefits",
+			Question: "What are the key benefits or offers?",
+			Brand:    true,
+		},
+		{
+			Key:      "target_audience",
+			Question: "Who is your target audience?",
+			Default:  "people searching for these keywords",
+			Brand:    true,
+		},
+		{
+			Key:      "cta",
+			Question: "What call-to-action should be included? (e.g., Shop now, Get a quote)",
+			Default:  "Learn more",
 		},
 	}
 }
@@ -389,6 +856,18 @@ func GetSteps(contentType ContentType) []WizardStep {
 		return GetStorySteps()
 	case ContentTypePoem:
 		return GetPoemSteps()
+	case ContentTypeTwitter:
+		return GetTwitterSteps()
+	case ContentTypeLinkedIn:
+		return GetLinkedInSteps()
+	case ContentTypeInstagram:
+		return GetInstagramSteps()
+	case ContentTypeProduct:
+		return GetProductSteps()
+	case ContentTypePressRelease:
+		return GetPressReleaseSteps()
+	case ContentTypeGoogleAds:
+		return GetGoogleAdsSteps()
 	default:
 		return nil
 	}
@@ -434,236 +913,38 @@ func (w *Wizard) IsComplete() bool {
 	return w.GetStep() >= len(steps)
 }
 
-// BuildPrompt builds the generation prompt from wizard answers.
+// BuildPrompt builds the generation prompt from wizard answers using the
+// prompt templates of the wizard's manager. If a template cannot be
+// rendered the built-in one is used instead.
 func (w *Wizard) BuildPrompt() string {
-	answers := w.GetAnswers()
-
-	switch w.ContentType {
-	case ContentTypeMarketing:
-		return buildMarketingPrompt(answers)
-	case ContentTypeEmail:
-		return buildEmailPrompt(answers)
-	case ContentTypeReport:
-		return buildReportPrompt(answers)
-	case ContentTypeScript:
-		return buildScriptPrompt(answers)
-	case ContentTypeWhitepaper:
-		return buildWhitepaperPrompt(answers)
-	case ContentTypeStory:
-		return buildStoryPrompt(answers)
-	case ContentTypePoem:
-		return buildPoemPrompt(answers)
-	default:
-		return ""
+	w.mu.RLock()
+	data := PromptData{
+		ContentType: w.ContentType,
+		Answers:     make(map[string]string, len(w.Answers)),
+		Locale:      w.Locale,
+		Flags:       make(map[string]string, len(w.Flags)),
 	}
-}
-
-func buildMarketingPrompt(answers map[string]string) string {
-	return fmt.Sprintf(`Create marketing copy with the following details:
-
-Website/Business: %s
-URL: %s
-Target Audience: %s
-Key Benefits: %s
-Tone: %s
-Length: %s
-Topic/Angle: %s
-Call-to-Action: %s
-
-Please create compelling marketing copy that incorporates all these elements.`,
-		answers["website_name"],
-		answers["website_url"],
-		answers["target_audience"],
-		answers["key_benefits"],
-		answers["tone"],
-		answers["length"],
-		answers["topic"],
-		answers["cta"])
-}
-
-func buildEmailPrompt(answers map[string]string) string {
-	return fmt.Sprintf(`Write an email with the following details:
-
-Subject: %s
-Recipient: %s
-Purpose: %s
-Tone: %s
-Key Message: %s
-Call-to-Action: %s
-
-Please create a complete email incorporating all these elements.`,
-		answers["subject"],
-		answers["recipient"],
-		answers["purpose"],
-		answers["tone"],
-		answers["key_message"],
-		answers["cta"])
-}
-
-func buildReportPrompt(answers map[string]string) string {
-	return fmt.Sprintf(`Create a report with the following details:
-
-Title: %s
-Target Audience: %s
-Topic: %s
-Scope: %s
-Key Points: %s
-Length: %s
-Format: %s
-
-Please create a comprehensive report incorporating all these elements.`,
-		answers["title"],
-		answers["audience"],
-		answers["topic"],
-		answers["scope"],
-		answers["key_points"],
-		answers["length"],
-		answers["format"])
-}
-
-func buildScriptPrompt(answers map[string]string) string {
-	return fmt.Sprintf(`Write a script with the following details:
-
-Type: %s
-Topic: %s
-Duration: %s
-Target Audience: %s
-Tone: %s
-Key Message: %s
-Call-to-Action: %s
-
-Please create a complete script incorporating all these elements.`,
-		answers["type"],
-		answers["topic"],
-		answers["duration"],
-		answers["audience"],
-		answers["tone"],
-		answers["key_message"],
-		answers["cta"])
-}
-
-func buildWhitepaperPrompt(answers map[string]string) string {
-	return fmt.Sprintf(`Create a whitepaper with the following details:
-
-Title: %s
-Topic: %s
-Target Audience: %s
-Problem/Challenge: %s
-Solution/Findings: %s
-Length: %s
-Tone: %s
-
-Please create a comprehensive whitepaper incorporating all these elements.`,
-		answers["title"],
-		answers["topic"],
-		answers["audience"],
-		answers["problem"],
-		answers["solution"],
-		answers["length"],
-		answers["tone"])
-}
-
-func buildStoryPrompt(answers map[string]string) string {
-	return fmt.Sprintf(`Write a story with the following details:
-
-Genre: %s
-Premise: %s
-Characters: %s
-Setting: %s
-Tone: %s
-Length: %s
-
-Please create an engaging story incorporating all these elements.`,
-		answers["genre"],
-		answers["premise"],
-		answers["characters"],
-		answers["setting"],
-		answers["tone"],
-		answers["length"])
-}
-
-func buildPoemPrompt(answers map[string]string) string {
-	return fmt.Sprintf(`Write a poem with the following details:
-
-Style: %s
-Topic: %s
-Mood: %s
-Length: %s lines
-Structure: %s
-
-Please create a poem incorporating all these elements.`,
-		answers["style"],
-		answers["topic"],
-		answers["mood"],
-		answers["length"],
-		answers["structure"])
-}
-
-// ParseFlags parses command flags from input string.
-func ParseFlags(input string) (map[string]string, string) {
-	flags := make(map[string]string)
-	var args string
-
-	// Remove leading slash if present
-	input = strings.TrimPrefix(input, "/")
-
-	parts := strings.Fields(input)
-	remaining := make([]string, 0)
-	collectArgs := false
-
-	for _, part := range parts {
-		if collectArgs {
-			remaining = append(remaining, part)
-			continue
-		}
-
-		if strings.HasPrefix(part, "-") && len(part) > 1 {
-			// It's a flag
-			flag := strings.TrimPrefix(part, "-")
-			flags[flag] = "true"
-		} else if strings.HasPrefix(part, "-") && len(part) == 1 {
-			// Next part is value
-			collectArgs = true
-		} else if len(flagValue(part)) > 0 {
-			// It's a flag with value like -temail@example.com
-			flagParts := strings.SplitN(part, "=", 2)
-			if len(flagParts) == 2 {
-				flags[flagParts[0]] = flagParts[1]
-			} else {
-				remaining = append(remaining, part)
-			}
-		} else {
-			remaining = append(remaining, part)
-		}
+	for k, v := range w.Answers {
+		data.Answers[k] = v
 	}
-
-	// Handle -flag value format
-	if len(remaining) >= 2 {
-		for i := 0; i < len(remaining)-1; i++ {
-			if strings.HasPrefix(remaining[i], "-") {
-				flag := strings.TrimPrefix(remaining[i], "-")
-				flags[flag] = remaining[i+1]
-				i++ // Skip next since it's used as value
-			}
-		}
+	for k, v := range w.Flags {
+		data.Flags[k] = v
 	}
+	prompts := w.prompts
+	w.mu.RUnlock()
 
-	// Get remaining as args
-	for _, part := range remaining {
-		if !strings.HasPrefix(part, "-") {
-			args = part
-			break
-		}
+	if prompts == nil {
+		prompts = defaultPrompts
 	}
-
-	return flags, args
-}
-
-func flagValue(s string) string {
-	if strings.HasPrefix(s, "-") && len(s) > 2 {
-		return s[2:]
+	prompt, err := prompts.Render(data)
+	if err != nil && prompts != defaultPrompts {
+		prompts.logger.Error("Falling back to the built-in prompt: %v", err)
+		prompt, err = defaultPrompts.Render(data)
+	}
+	if err != nil {
+		return ""
 	}
-	return ""
+	return prompt
 }
 
 // GetContentTypeFromArgs extracts content type from command arguments.
@@ -673,28 +954,46 @@ func GetContentTypeFromArgs(args string) (ContentType, string) {
 		return "", ""
 	}
 
-	first := strings.ToLower(parts[0])
 	remaining := ""
 	if len(parts) > 1 {
 		remaining = strings.Join(parts[1:], " ")
 	}
 
-	switch first {
-	case "marketing":
-		return ContentTypeMarketing, remaining
-	case "email":
-		return ContentTypeEmail, remaining
-	case "report":
-		return ContentTypeReport, remaining
-	case "script":
-		return ContentTypeScript, remaining
-	case "whitepaper":
-		return ContentTypeWhitepaper, remaining
-	case "story":
-		return ContentTypeStory, remaining
-	case "poem":
-		return ContentTypePoem, remaining
-	default:
+	contentType, ok := ParseContentType(parts[0])
+	if !ok {
 		return "", args
 	}
+	return contentType, remaining
+}
+
+// ParseContentType returns the content type named by s, ignoring case.
+// Common aliases such as "x" for twitter are accepted.
+func ParseContentType(s string) (ContentType, bool) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	for _, ct := range contentTypes {
+		if string(ct) == name {
+			return ct, true
+		}
+	}
+	ct, ok := contentTypeAliases[name]
+	return ct, ok
+}
+
+// IsStepKey reports whether key is the key of a step of any content type.
+func IsStepKey(key string) bool {
+	for _, ct := range contentTypes {
+		for _, step := range GetSteps(ct) {
+			if step.Key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ContentTypes returns all supported content types.
+func ContentTypes() []ContentType {
+	types := make([]ContentType, len(contentTypes))
+	copy(types, contentTypes)
+	return types
 }
@@ -0,0 +1,596 @@
+package wizard
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+
+	session := &Session{
+		UserID:      123,
+		ContentType: ContentTypeEmail,
+		Answers:     map[string]string{"subject": "Hello"},
+		Step:        1,
+		StartedAt:   time.Now(),
+	}
+	if err := store.Save(session); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	sessions, err := store.LoadAll()
+	if err != nil {
+		t.Fatalf("LoadAll() error = %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("Expected 1 session, got %d", len(sessions))
+	}
+	if sessions[0].Answers["subject"] != "Hello" {
+		t.Errorf("Answer = %s, expect 'Hello'", sessions[0].Answers["subject"])
+	}
+
+	if err := store.Delete(123); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	sessions, _ = store.LoadAll()
+	if len(sessions) != 0 {
+		t.Errorf("Expected 0 sessions after delete, got %d", len(sessions))
+	}
+
+	// Deleting a missing session should not fail
+	if err := store.Delete(999); err != nil {
+		t.Errorf("Delete() of missing session error = %v", err)
+	}
+}
+
+func TestManagerRestore(t *testing.T) {
+	store := NewMemoryStore()
+
+	m := NewManager(time.Minute, WithStore(store))
+	wiz := m.StartWizard(123, 456, ContentTypePoem)
+	wiz.SetAnswer(wiz.GetCurrentKey(), "haiku")
+	wiz.SetPrompt("Write a haiku")
+
+	// A fresh manager sharing the store should pick up where we left off
+	restored := NewManager(time.Minute, WithStore(store))
+	n, err := restored.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("Restore() = %d, expect 1", n)
+	}
+
+	wiz, ok := restored.GetWizard(123)
+	if !ok {
+		t.Fatal("Wizard should be restored")
+	}
+	if wiz.GetStep() != 1 {
+		t.Errorf("Step = %d, expect 1", wiz.GetStep())
+	}
+	if wiz.GetAnswer("style") != "haiku" {
+		t.Errorf("Answer = %s, expect 'haiku'", wiz.GetAnswer("style"))
+	}
+	if wiz.GetPrompt() != "Write a haiku" {
+		t.Errorf("Prompt = %q, expect 'Write a haiku'", wiz.GetPrompt())
+	}
+
+	// Ending the wizard removes it from the store
+	restored.EndWizard(123)
+	sessions, _ := store.LoadAll()
+	if len(sessions) != 0 {
+		t.Errorf("Expected 0 stored sessions, got %d", len(sessions))
+	}
+}
+
+func TestManagerFlush(t *testing.T) {
+	store := NewMemoryStore()
+	m := NewManager(time.Minute, WithStore(store))
+	m.StartWizard(123, 456, ContentTypePoem)
+
+	// Simulate a failed save
+	store.Delete(123)
+
+	if err := m.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	sessions, _ := store.LoadAll()
+	if len(sessions) != 1 || sessions[0].UserID != 123 {
+		t.Errorf("Flush() should save the active session, stored %v", sessions)
+	}
+}
+
+func TestManagerDoesNotSaveEndedWizard(t *testing.T) {
+	store := NewMemoryStore()
+	m := NewManager(time.Minute, WithStore(store))
+	w := m.StartWizard(123, 456, ContentTypePoem)
+	m.CompleteWizard(123)
+
+	// A change racing with the end of the session must not bring it back
+	w.AddDraft("Roses are red", "")
+
+	if sessions, _ := store.LoadAll(); len(sessions) != 0 {
+		t.Errorf("An ended wizard should not be saved, stored %v", sessions)
+	}
+}
+
+func TestManagerRestoreDropsExpired(t *testing.T) {
+	store := NewMemoryStore()
+	store.Save(&Session{
+		UserID:      123,
+		ContentType: ContentTypePoem,
+		Answers:     map[string]string{},
+		StartedAt:   time.Now().Add(-48 * time.Hour),
+	})
+
+	m := NewManager(time.Minute, WithStore(store))
+	n, err := m.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if n != 0 {
+		t.Errorf("Restore() = %d, expect 0", n)
+	}
+
+	sessions, _ := store.LoadAll()
+	if len(sessions) != 0 {
+		t.Errorf("Expired session should be removed from the store")
+	}
+}
+
+func TestManagerSweep(t *testing.T) {
+	var reminded, expired []int64
+	m := NewManager(10*time.Minute, WithReminder(2*time.Minute))
+	m.SetHooks(Hooks{
+		OnReminder: func(ctx context.Context, w *Wizard, remaining time.Duration) {
+			reminded = append(reminded, w.UserID)
+		},
+		OnExpire: func(ctx context.Context, w *Wizard) {
+			expired = append(expired, w.UserID)
+		},
+	})
+
+	m.StartWizard(1, 1, ContentTypePoem)
+	idle := m.StartWizard(2, 2, ContentTypePoem)
+	stale := m.StartWizard(3, 3, ContentTypePoem)
+
+	stale.SetAnswer("style", "haiku")
+
+	idle.LastActivity = time.Now().Add(-9 * time.Minute)
+	stale.LastActivity = time.Now().Add(-11 * time.Minute)
+
+	m.Sweep(context.Background())
+	m.Sweep(context.Background())
+
+	if len(reminded) != 1 || reminded[0] != 2 {
+		t.Errorf("Reminded = %v, expect [2] exactly once", reminded)
+	}
+	if len(expired) != 1 || expired[0] != 3 {
+		t.Errorf("Expired = %v, expect [3]", expired)
+	}
+
+	if _, ok := m.GetWizard(3); ok {
+		t.Error("Expired wizard should not be active")
+	}
+
+	// Resuming restores the saved answers and restarts the timeout
+	wiz, ok := m.Resume(3)
+	if !ok {
+		t.Fatal("Expired wizard should be resumable")
+	}
+	if wiz.GetAnswer("style") != "haiku" {
+		t.Errorf("Answer = %s, expect 'haiku'", wiz.GetAnswer("style"))
+	}
+	if _, ok := m.GetWizard(3); !ok {
+		t.Error("Resumed wizard should be active")
+	}
+	if _, ok := m.Resume(3); ok {
+		t.Error("Wizard should only be resumable once")
+	}
+}
+
+func TestGetWizardUsesLastActivity(t *testing.T) {
+	m := NewManager(10 * time.Minute)
+	wiz := m.StartWizard(1, 1, ContentTypePoem)
+
+	// A long-running session that is still active should not expire
+	wiz.StartedAt = time.Now().Add(-time.Hour)
+	if _, ok := m.GetWizard(1); !ok {
+		t.Error("Active wizard should not expire based on start time")
+	}
+
+	wiz.LastActivity = time.Now().Add(-11 * time.Minute)
+	if _, ok := m.GetWizard(1); ok {
+		t.Error("Inactive wizard should expire")
+	}
+}
+
+func TestDrafts(t *testing.T) {
+	m := NewManager(time.Minute)
+	wiz := m.StartWizard(1, 1, ContentTypeMarketing)
+
+	if wiz.IsRefining() {
+		t.Error("Wizard should not be refining before a draft exists")
+	}
+
+	wiz.SetPrompt("prompt")
+	wiz.AddDraft("Buy now", "")
+	wiz.AddDraft("Buy now!\nLimited offer", "make the CTA punchier")
+
+	if !wiz.IsRefining() {
+		t.Error("Wizard should be refining once a draft exists")
+	}
+
+	current, _ := wiz.CurrentDraft()
+	if current.Version != 2 {
+		t.Errorf("Current version = %d, expect 2", current.Version)
+	}
+
+	draft, err := wiz.Rollback(1)
+	if err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if draft.Version != 3 || draft.Content != "Buy now" {
+		t.Errorf("Rollback() = v%d %q, expect v3 'Buy now'", draft.Version, draft.Content)
+	}
+
+	if _, err := wiz.Rollback(10); err == nil {
+		t.Error("Rollback() to a missing version should fail")
+	}
+}
+
+func TestDiffDrafts(t *testing.T) {
+	from := Draft{Version: 1, Content: "Hello\nWorld"}
+	to := Draft{Version: 2, Content: "Hello\nThere\nWorld!"}
+
+	diff := DiffDrafts(from, to)
+	for _, want := range []string{"+ There", "- World", "+ World!"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("DiffDrafts() missing %q in:\n%s", want, diff)
+		}
+	}
+	if strings.Contains(diff, "- Hello") || strings.Contains(diff, "+ Hello") {
+		t.Errorf("Unchanged lines should not be reported:\n%s", diff)
+	}
+
+	if !strings.Contains(DiffDrafts(from, from), "(no changes)") {
+		t.Error("Identical drafts should report no changes")
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string][]string
+	}{
+		{"multi-word value", "email -t newsletter signup -s friendly", map[string][]string{"prompt": {"newsletter signup"}, "style": {"friendly"}}},
+		{"quoted value", `email -t "use -s sparingly" -q`, map[string][]string{"prompt": {"use -s sparingly"}, "quick": {"true"}}},
+		{"smart quotes", "email -t “don't panic” -n3", map[string][]string{"prompt": {"don't panic"}, "count": {"3"}}},
+		{"long options", `marketing --count=2 --website-name="Acme Inc" --tone casual`, map[string][]string{"count": {"2"}, "website-name": {"Acme Inc"}, "tone": {"casual"}}},
+		{"repeated flag", "report -m be brief -m cite sources", map[string][]string{"message": {"be brief", "cite sources"}}},
+		{"terminator", "marketing -s bold -- -50% off -t", map[string][]string{"style": {"bold"}, "prompt": {"-50% off -t"}}},
+		{"attached value", "story -tdragons", map[string][]string{"prompt": {"dragons"}}},
+		{"attached quoted value", `story -t"dragons and knights" -s'dark fantasy'`, map[string][]string{"prompt": {"dragons and knights"}, "style": {"dark fantasy"}}},
+		{"quoted word after text", `email -t hello "world" -q`, map[string][]string{"prompt": {"hello world"}, "quick": {"true"}}},
+		{"leading apostrophe", "poem -t 'tis fine", map[string][]string{"prompt": {"'tis fine"}}},
+		{"apostrophe inside a quote", "poem -t 'Bob's poem' -q", map[string][]string{"prompt": {"Bob's poem"}, "quick": {"true"}}},
+		{"unclosed apostrophes", "poem -s 'tis Bob's -q", map[string][]string{"style": {"'tis Bob's"}, "quick": {"true"}}},
+		{"case insensitive type", "Poem", map[string][]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := ParseArgs(tt.input)
+			if err != nil {
+				t.Fatalf("ParseArgs(%q) error = %v", tt.input, err)
+			}
+			if len(args.Flags) != len(tt.want) {
+				t.Errorf("ParseArgs(%q) = %v, expect %v", tt.input, args.Flags, tt.want)
+			}
+			for name, want := range tt.want {
+				if got := strings.Join(args.Strings(name), "|"); got != strings.Join(want, "|") {
+					t.Errorf("%s = %q, expect %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"-t hello", "expected a content type"},
+		{"novel", "unknown content type"},
+		{"email -x", "unknown flag -x"},
+		{"email --website-name Acme", "unknown flag --website-name"},
+		{"email -n many", "expects a whole number"},
+		{"email -t", "needs a value"},
+		{"email -s formal -s casual", "more than once"},
+		{`email -t "unterminated`, "missing closing quote"},
+		{"email signup", "unexpected argument"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseArgs(tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseArgs(%q) error = %v, expect %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestPrefillSkipsAnswered(t *testing.T) {
+	m := NewManager(time.Minute)
+	wiz := m.StartWizard(1, 1, ContentTypePoem)
+
+	args, err := ParseArgs("poem -s haiku --mood calm")
+	if err != nil {
+		t.Fatalf("ParseArgs() error = %v", err)
+	}
+	wiz.Prefill(args.Answers())
+
+	// style is answered, so the wizard starts at topic
+	if key := wiz.GetCurrentKey(); key != "topic" {
+		t.Errorf("Current key = %s, expect 'topic'", key)
+	}
+
+	// mood is answered too, so answering topic moves on to length
+	wiz.SetAnswer("topic", "autumn")
+	if key := wiz.GetCurrentKey(); key != "length" {
+		t.Errorf("Current key = %s, expect 'length'", key)
+	}
+}
+
+func TestQuickMode(t *testing.T) {
+	m := NewManager(time.Minute)
+	wiz := m.StartWizard(1, 1, ContentTypeStory)
+	wiz.SetFlags(map[string]string{FlagQuick: "true"})
+	wiz.Prefill(nil)
+
+	var asked []string
+	for !wiz.IsComplete() {
+		asked = append(asked, wiz.GetCurrentKey())
+		wiz.SetAnswer(wiz.GetCurrentKey(), "answer")
+	}
+	if strings.Join(asked, ",") != "genre,premise" {
+		t.Errorf("Asked %v, expect only the essential steps", asked)
+	}
+
+	missing := wiz.MissingSteps()
+	if len(missing) != 4 {
+		t.Fatalf("MissingSteps() = %d steps, expect 4", len(missing))
+	}
+
+	reply := "Sure!\n```json\n{\"setting\": \"a lighthouse\", \"tone\": \"\"}\n```"
+	answers := ParseInferred(reply, missing)
+	if answers["setting"] != "a lighthouse" {
+		t.Errorf("setting = %q, expect the inferred answer", answers["setting"])
+	}
+	if answers["length"] != "short story" {
+		t.Errorf("length = %q, expect the default", answers["length"])
+	}
+	if _, ok := answers["tone"]; !ok {
+		t.Error("Every missing step should be filled")
+	}
+}
+
+func TestSelectVariant(t *testing.T) {
+	m := NewManager(time.Minute)
+	wiz := m.StartWizard(1, 1, ContentTypeEmail)
+	wiz.SetVariants([]string{"Subject A", "Subject B"})
+
+	if _, err := wiz.SelectVariant(3); err == nil {
+		t.Error("SelectVariant() out of range should fail")
+	}
+
+	draft, err := wiz.SelectVariant(2)
+	if err != nil {
+		t.Fatalf("SelectVariant() error = %v", err)
+	}
+	if draft.Content != "Subject B" || draft.Version != 1 {
+		t.Errorf("SelectVariant() = v%d %q, expect v1 'Subject B'", draft.Version, draft.Content)
+	}
+	if wiz.HasVariants() {
+		t.Error("Variants should be cleared after selection")
+	}
+	if !wiz.IsRefining() {
+		t.Error("Selected variant should become the draft to refine")
+	}
+}
+
+func TestBuildPrompt(t *testing.T) {
+	m := NewManager(time.Minute)
+	wiz := m.StartWizard(1, 1, ContentTypeEmail)
+	wiz.Prefill(map[string]string{"subject": "Spring sale", "tone": "casual"})
+	wiz.SetFlags(map[string]string{FlagMessage: "mention free shipping"})
+
+	prompt := wiz.BuildPrompt()
+	for _, want := range []string{"Subject: Spring sale\n", "Tone: casual\n", "Recipient: \n", "Additional Instructions: mention free shipping\n"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("BuildPrompt() missing %q in:\n%s", want, prompt)
+		}
+	}
+}
+
+func TestPromptOverrides(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("poem.tmpl", "A {{.Answers.mood}} poem about {{.Answers.topic}} in {{.Locale}}")
+	prompts, err := NewPrompts(dir)
+	if err != nil {
+		t.Fatalf("NewPrompts() error = %v", err)
+	}
+
+	m := NewManager(time.Minute, WithPrompts(prompts))
+	wiz := m.StartWizard(1, 1, ContentTypePoem)
+	wiz.SetLocale("de")
+	wiz.Prefill(map[string]string{"topic": "rain", "mood": "calm"})
+	if got := wiz.BuildPrompt(); got != "A calm poem about rain in de" {
+		t.Errorf("BuildPrompt() = %q", got)
+	}
+
+	// Templates referring to unknown keys or files are rejected
+	write("poem.tmpl", "{{.Answers.colour}}")
+	if err := prompts.Reload(); err == nil || !strings.Contains(err.Error(), "colour") {
+		t.Errorf("Reload() error = %v, expect the unknown key to be reported", err)
+	}
+	if got := wiz.BuildPrompt(); got != "A calm poem about rain in de" {
+		t.Errorf("A failed reload should keep the previous templates, got %q", got)
+	}
+
+	write("poem.tmpl", "Poem about {{.Answers.topic}}")
+	write("sonnet.tmpl", "")
+	if _, err := NewPrompts(dir); err == nil {
+		t.Error("NewPrompts() with an unknown template file should fail")
+	}
+}
+
+func TestViolations(t *testing.T) {
+	long := strings.Repeat("a", 281)
+	tests := []struct {
+		contentType ContentType
+		content     string
+		want        []string
+	}{
+		{ContentTypeTwitter, "First tweet\n---\nSecond tweet", nil},
+		{ContentTypeTwitter, "First tweet\n---\n" + long, []string{"Tweet 2 is 281 characters"}},
+		{ContentTypeLinkedIn, "Big news! #one #two #three #four #five #six", []string{"6 hashtags, the limit is 5"}},
+		{ContentTypeInstagram, "Cozy mornings ☕ #coffee", nil},
+		{ContentTypeGoogleAds, "Headline 1: Fast Shipping\nHeadline 2: Shop Now\n**Headline 3:** Big Spring Sale On Every Single Item\nDescription 1: Free returns.\nDescription 2: Order today.", []string{"Headline 3 (\"Big Spring Sale On Every Single Item\") is 36 characters"}},
+		{ContentTypeGoogleAds, "Headline 1: Fast Shipping", []string{"There are 1 headlines", "There are 0 descriptions"}},
+		{ContentTypeStory, long, nil},
+	}
+
+	m := NewManager(time.Minute)
+	for _, tt := range tests {
+		wiz := m.StartWizard(1, 1, tt.contentType)
+		got := wiz.Violations(tt.content)
+		if len(got) != len(tt.want) {
+			t.Errorf("Violations(%s) = %v, expect %d violations", tt.contentType, got, len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if !strings.Contains(got[i], want) {
+				t.Errorf("Violations(%s)[%d] = %q, expect it to contain %q", tt.contentType, i, got[i], want)
+			}
+		}
+	}
+}
+
+func TestAnswerViolations(t *testing.T) {
+	words := func(n int) string {
+		return strings.TrimSpace(strings.Repeat("word ", n))
+	}
+	tests := []struct {
+		name        string
+		contentType ContentType
+		answers     map[string]string
+		content     string
+		want        []string
+	}{
+		{"length in range", ContentTypeMarketing, map[string]string{"length": "short", "cta": "none"}, words(100), nil},
+		{"length too short", ContentTypeMarketing, map[string]string{"length": "Long", "cta": "none"}, words(100), []string{"100 words, it should have between 400 and 1000"}},
+		{"explicit word count", ContentTypeReport, map[string]string{"length": "about 500 words"}, words(300), []string{"between 400 and 600"}},
+		{"word range", ContentTypeProduct, map[string]string{"length": "50-60 words"}, words(55), nil},
+		{"open-ended length", ContentTypeReport, map[string]string{"length": "comprehensive"}, words(1100), []string{"at least 1200"}},
+		{"longest length name wins", ContentTypeStory, map[string]string{"length": "novel excerpt"}, words(1200), nil},
+		{"poem lines", ContentTypePoem, map[string]string{"length": "4"}, "One\nTwo\n\nThree\nFour", nil},
+		{"poem title", ContentTypePoem, map[string]string{"length": "2"}, "Title\n\nOne\nTwo", nil},
+		{"poem too long", ContentTypePoem, map[string]string{"length": "2 lines"}, "One\nTwo\nThree", []string{"3 lines, it should have exactly 2"}},
+		{"fixed form", ContentTypePoem, map[string]string{"style": "Haiku", "length": "16"}, "An old silent pond\nA frog jumps into the pond\nSplash! Silence again", nil},
+		{"script duration", ContentTypeScript, map[string]string{"duration": "30 seconds"}, "NARRATOR: " + words(75) + "\n[Music fades]", nil},
+		{"script too long", ContentTypeScript, map[string]string{"duration": "0:30"}, "SCENE 1\nHOST: " + words(150), []string{"150 spoken words"}},
+		{"tweet count", ContentTypeTwitter, map[string]string{"tweets": "3", "cta": "none"}, "One\n---\nTwo", []string{"There are 2 tweets, there should be exactly 3"}},
+		{"hashtag answer", ContentTypeInstagram, map[string]string{"hashtags": "2", "cta": "none"}, "Hi #a #b #c", []string{"3 hashtags, the limit is 2"}},
+		{"cta present", ContentTypeEmail, map[string]string{"cta": "Sign up now!"}, "Don't wait, sign up now.", nil},
+		{"cta words present", ContentTypeEmail, map[string]string{"cta": "Visit our website"}, "Our new website is live, visit it today.", nil},
+		{"cta missing", ContentTypeEmail, map[string]string{"cta": "Book a demo"}, "Thanks for reading.", []string{`"Book a demo" is missing`}},
+	}
+
+	m := NewManager(time.Minute)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wiz := m.StartWizard(1, 1, tt.contentType)
+			wiz.Prefill(tt.answers)
+			got := wiz.Violations(tt.content)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Violations() = %v, expect %d violations", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("Violations()[%d] = %q, expect it to contain %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSpokenDuration(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"30 seconds", 30 * time.Second},
+		{"5 min", 5 * time.Minute},
+		{"1 minute 30 seconds", 90 * time.Second},
+		{"1:30", 90 * time.Second},
+		{"90s", 90 * time.Second},
+		{"1.5 hours", 90 * time.Minute},
+		{"short", 0},
+	}
+
+	for _, tt := range tests {
+		got, _ := parseSpokenDuration(tt.input)
+		if got != tt.want {
+			t.Errorf("parseSpokenDuration(%q) = %v, expect %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLifecycleMetrics(t *testing.T) {
+	ct := string(ContentTypePoem)
+	started := wizardsStarted.With(ct).Value()
+	completed := wizardsCompleted.With(ct).Value()
+	cancelled := wizardsAbandoned.With(ct, "cancelled").Value()
+	replaced := wizardsAbandoned.With(ct, "replaced").Value()
+
+	m := NewManager(time.Minute)
+	m.StartWizard(1, 1, ContentTypePoem)
+	m.StartWizard(1, 1, ContentTypePoem)
+	m.CompleteWizard(1)
+	m.StartWizard(2, 2, ContentTypePoem)
+	m.CancelWizard(2)
+	m.CancelWizard(2)
+
+	if got := wizardsStarted.With(ct).Value() - started; got != 3 {
+		t.Errorf("started = %v, want 3", got)
+	}
+	if got := wizardsCompleted.With(ct).Value() - completed; got != 1 {
+		t.Errorf("completed = %v, want 1", got)
+	}
+	if got := wizardsAbandoned.With(ct, "cancelled").Value() - cancelled; got != 1 {
+		t.Errorf("cancelled = %v, want 1", got)
+	}
+	if got := wizardsAbandoned.With(ct, "replaced").Value() - replaced; got != 1 {
+		t.Errorf("replaced = %v, want 1", got)
+	}
+	if m.ActiveCount() != 0 {
+		t.Errorf("ActiveCount() = %d, want 0", m.ActiveCount())
+	}
+}
@@ -2,20 +2,21 @@
 package config
 
 import (
-	"fmt"
 	"os"
 	"strconv"
 	"time"
 )
 
-// Config holds all configuration settings for the bot.
+// Config holds all configuration settings for the bot. Settings tagged
+// reload:"restart" only take effect on restart; the others can be changed
+// while the bot runs, see Watcher.
 type Config struct {
 	// Telegram Bot Configuration
-	TelegramBotToken string `mapstructure:"telegram_bot_token"`
+	TelegramBotToken Secret `mapstructure:"telegram_bot_token" reload:"restart"`
 
 	// Minimax API Configuration
-	MinimaxAPIKey  string        `mapstructure:"minimax_api_key"`
-	MinimaxBaseURL string        `mapstructure:"minimax_base_url"`
+	MinimaxAPIKey  Secret        `mapstructure:"minimax_api_key" reload:"restart"`
+	MinimaxBaseURL string        `mapstructure:"minimax_base_url" reload:"restart"`
 	MinimaxModel   string        `mapstructure:"minimax_model"`
 	MinimaxTimeout time.Duration `mapstructure:"minimax_timeout"`
 
@@ -26,12 +27,66 @@ type Config struct {
 	EnableGroupChat bool    `mapstructure:"enable_group_chat"`
 
 	// Polling Configuration
-	PollInterval time.Duration `mapstructure:"poll_interval"`
-	LongPolling  bool          `mapstructure:"long_polling"`
+	PollInterval time.Duration `mapstructure:"poll_interval" reload:"restart"`
+	LongPolling  bool          `mapstructure:"long_polling" reload:"restart"`
 
 	// Message Configuration
 	MaxMessageLength int           `mapstructure:"max_message_length"`
 	ReplyTimeout     time.Duration `mapstructure:"reply_timeout"`
+	RateLimit        time.Duration `mapstructure:"rate_limit"`
+
+	// InboxSize is how many chat messages of a user may wait while a reply
+	// is being generated. MergeMessages answers the waiting messages in one
+	// turn instead of one by one.
+	InboxSize     int  `mapstructure:"inbox_size"`
+	MergeMessages bool `mapstructure:"merge_messages"`
+
+	// Workers is how many updates are handled at the same time; updates
+	// from the same chat are always handled one after another.
+	// UpdateQueueSize is how many more updates may wait for a worker before
+	// polling pauses.
+	Workers         int `mapstructure:"workers" reload:"restart"`
+	UpdateQueueSize int `mapstructure:"update_queue_size" reload:"restart"`
+
+	// ShutdownTimeout is how long requests in progress may take to finish
+	// on shutdown before they are aborted.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+
+	// Wizard Configuration
+	WizardTimeout  time.Duration `mapstructure:"wizard_timeout"`
+	WizardReminder time.Duration `mapstructure:"wizard_reminder"`
+
+	// MaxRegenerationAttempts caps how often the model is asked to fix a
+	// draft that breaks its constraints, such as length or platform limits.
+	MaxRegenerationAttempts int `mapstructure:"max_regeneration_attempts"`
+
+	// Storage Configuration
+	DataDir    string `mapstructure:"data_dir" reload:"restart"`
+	PromptsDir string `mapstructure:"prompts_dir" reload:"restart"`
+
+	// Logging Configuration
+	LogLevel  string `mapstructure:"log_level"`
+	LogFormat string `mapstructure:"log_format" reload:"restart"`
+	// LogComponentLevels overrides log_level for parts of the bot, e.g.
+	// "minimax=debug,telegram=warn".
+	LogComponentLevels string `mapstructure:"log_component_levels"`
+	// LogRedactContent hides message text in debug output of API calls.
+	LogRedactContent bool `mapstructure:"log_redact_content" reload:"restart"`
+
+	// LogFile is also written to if set, rotated by size or age.
+	LogFile               string        `mapstructure:"log_file" reload:"restart"`
+	LogFileLevel          string        `mapstructure:"log_file_level" reload:"restart"`
+	LogFileMaxSize        int           `mapstructure:"log_file_max_size" reload:"restart"`
+	LogFileRotateInterval time.Duration `mapstructure:"log_file_rotate_interval" reload:"restart"`
+	LogFileMaxBackups     int           `mapstructure:"log_file_max_backups" reload:"restart"`
+	LogFileMaxAge         time.Duration `mapstructure:"log_file_max_age" reload:"restart"`
+
+	// HTTPAddr is the address of the HTTP listener serving metrics, health
+	// checks and the admin API, e.g. ":9090". Empty disables it.
+	HTTPAddr string `mapstructure:"http_addr" reload:"restart"`
+	// AdminToken is the bearer token required by the admin API. Empty
+	// disables the admin API.
+	AdminToken Secret `mapstructure:"admin_token" reload:"restart"`
 
 	// Feature Flags
 	EnableMarkdown   bool `mapstructure:"enable_markdown"`
@@ -42,118 +97,70 @@ type Config struct {
 // Default returns a Config with default values.
 func Default() *Config {
 	return &Config{
-		MinimaxBaseURL:   "https://api.minimax.chat/v1",
-		MinimaxModel:     "abab5.5-chat",
-		MinimaxTimeout:   60 * time.Second,
-		PollInterval:     1 * time.Second,
-		LongPolling:      true,
-		MaxMessageLength: 4096,
-		ReplyTimeout:     30 * time.Second,
-		EnableMarkdown:   true,
-		EnableCommands:   true,
-		EnableInlineMode: false,
-		EnableGroupChat:  false,
+		MinimaxBaseURL:          "https://api.minimax.chat/v1",
+		MinimaxModel:            "abab5.5-chat",
+		MinimaxTimeout:          60 * time.Second,
+		PollInterval:            1 * time.Second,
+		LongPolling:             true,
+		MaxMessageLength:        4096,
+		ReplyTimeout:            30 * time.Second,
+		RateLimit:               1 * time.Second,
+		InboxSize:               10,
+		MergeMessages:           true,
+		Workers:                 8,
+		UpdateQueueSize:         100,
+		ShutdownTimeout:         30 * time.Second,
+		WizardTimeout:           10 * time.Minute,
+		WizardReminder:          2 * time.Minute,
+		MaxRegenerationAttempts: 2,
+		DataDir:                 "data",
+		LogLevel:                "info",
+		LogFormat:               "text",
+		LogRedactContent:        true,
+		LogFileMaxSize:          100,
+		LogFileMaxBackups:       5,
+		EnableMarkdown:          true,
+		EnableCommands:          true,
+		EnableInlineMode:        false,
+		EnableGroupChat:         false,
 	}
 }
 
-// Validate checks if the configuration is valid.
-func (c *Config) Validate() error {
-	if c.TelegramBotToken == "" {
-		return fmt.Errorf("telegram bot token is required")
-	}
-
-	if c.MinimaxAPIKey == "" {
-		return fmt.Errorf("minimax api key is required")
-	}
-
-	if c.MinimaxBaseURL == "" {
-		return fmt.Errorf("minimax base url is required")
-	}
-
-	if c.PollInterval <= 0 {
-		c.PollInterval = 1 * time.Second
-	}
-
-	if c.MinimaxTimeout <= 0 {
-		c.MinimaxTimeout = 60 * time.Second
-	}
-
-	return nil
-}
-
-// LoadFromEnv loads configuration from environment variables.
+// LoadFromEnv loads configuration from environment variables. Invalid
+// values are ignored; use Load to have them reported.
 func LoadFromEnv() *Config {
 	cfg := Default()
-
-	// Telegram configuration
-	if token := os.Getenv("TELEGRAM_BOT_TOKEN"); token != "" {
-		cfg.TelegramBotToken = token
-	}
-
-	// Minimax configuration
-	if apiKey := os.Getenv("MINIMAX_API_KEY"); apiKey != "" {
-		cfg.MinimaxAPIKey = apiKey
-	}
-
-	if baseURL := os.Getenv("MINIMAX_BASE_URL"); baseURL != "" {
-		cfg.MinimaxBaseURL = baseURL
-	}
-
-	if model := os.Getenv("MINIMAX_MODEL"); model != "" {
-		cfg.MinimaxModel = model
-	}
-
-	// Bot configuration
-	if name := os.Getenv("BOT_NAME"); name != "" {
-		cfg.BotName = name
-	}
-
-	if adminIDs := os.Getenv("ADMIN_USER_IDS"); adminIDs != "" {
-		cfg.AdminUserIDs = parseInt64List(adminIDs)
-	}
-
-	if allowedUsers := os.Getenv("ALLOWED_USERS"); allowedUsers != "" {
-		cfg.AllowedUsers = parseInt64List(allowedUsers)
-	}
-
-	// Feature flags
-	if enableGroup := os.Getenv("ENABLE_GROUP_CHAT"); enableGroup != "" {
-		cfg.EnableGroupChat = enableGroup == "true" || enableGroup == "1"
-	}
-
-	if enableMarkdown := os.Getenv("ENABLE_MARKDOWN"); enableMarkdown != "" {
-		cfg.EnableMarkdown = enableMarkdown == "true" || enableMarkdown == "1"
-	}
-
-	// Timeouts
-	if pollInterval := os.Getenv("POLL_INTERVAL"); pollInterval != "" {
-		if duration, err := time.ParseDuration(pollInterval); err == nil {
-			cfg.PollInterval = duration
-		}
-	}
-
-	if timeout := os.Getenv("MINIMAX_TIMEOUT"); timeout != "" {
-		if duration, err := time.ParseDuration(timeout); err == nil {
-			cfg.MinimaxTimeout = duration
-		}
-	}
-
+	_ = cfg.applyEnv(os.LookupEnv)
 	return cfg
 }
 
-// parseInt64List parses a comma-separated string of integers into a slice.
+// parseInt64List parses a comma-separated string of integers into a slice,
+// skipping malformed entries.
 func parseInt64List(s string) []int64 {
+	result, _ := parseIDs(s)
+	return result
+}
+
+// parseIDs parses a comma-separated string of integers into a slice and
+// returns the malformed entries separately.
+func parseIDs(s string) ([]int64, []string) {
 	if s == "" {
-		return nil
+		return nil, nil
 	}
 
-	var result []int64
+	var (
+		result    []int64
+		malformed []string
+	)
 	for _, part := range splitAndTrim(s, ",") {
-		if id, err := strconv.ParseInt(part, 10, 64); err == nil {
-			result = append(result, id)
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			malformed = append(malformed, part)
+			continue
 		}
+		result = append(result, id)
 	}
-	return result
+	return result, malformed
 }
 
 // splitAndTrim splits a string by separator and trims whitespace from each part.
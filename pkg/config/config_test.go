@@ -1,7 +1,11 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -165,3 +169,455 @@ func TestParseInt64List(t *testing.T) {
 		})
 	}
 }
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadFileFormats(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "telegram_bot_token: file_token\nminimax:\n  model: file-model\nwizard_timeout: 15m\nadmin_user_ids: [1, 2]\nlong_polling: false\nmax_message_length: 1000\n",
+		"config.toml": "telegram_bot_token = \"file_token\"\nwizard_timeout = \"15m\"\nadmin_user_ids = [1, 2]\nlong_polling = false\nmax_message_length = 1000\n[minimax]\nmodel = \"file-model\"\n",
+		"config.json": `{"telegram_bot_token": "file_token", "minimax": {"model": "file-model"}, "wizard_timeout": 900, "admin_user_ids": [1, 2], "long_polling": false, "max_message_length": 1000}`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg := Default()
+			if err := cfg.LoadFile(writeConfigFile(t, name, content)); err != nil {
+				t.Fatalf("LoadFile() error = %v", err)
+			}
+			if cfg.TelegramBotToken != "file_token" || cfg.MinimaxModel != "file-model" {
+				t.Errorf("Expected token and model from file, got %q and %q", cfg.TelegramBotToken, cfg.MinimaxModel)
+			}
+			if cfg.WizardTimeout != 15*time.Minute {
+				t.Errorf("Expected WizardTimeout 15m, got %v", cfg.WizardTimeout)
+			}
+			if len(cfg.AdminUserIDs) != 2 || cfg.AdminUserIDs[1] != 2 {
+				t.Errorf("Expected AdminUserIDs [1 2], got %v", cfg.AdminUserIDs)
+			}
+			if cfg.LongPolling || cfg.MaxMessageLength != 1000 {
+				t.Errorf("Expected LongPolling false and MaxMessageLength 1000, got %v and %d", cfg.LongPolling, cfg.MaxMessageLength)
+			}
+			if cfg.MinimaxBaseURL != Default().MinimaxBaseURL {
+				t.Errorf("Expected default MinimaxBaseURL to be kept, got %s", cfg.MinimaxBaseURL)
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"unknown key", "config.yaml", "telegram_token: x\n", `unknown setting "telegram_token"`},
+		{"invalid duration", "config.yaml", "wizard_timeout: soon\n", `invalid duration "soon"`},
+		{"fractional number", "config.json", `{"max_message_length": 1.5}`, "whole number"},
+		{"unsupported format", "config.ini", "", "unsupported config file format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Default().LoadFile(writeConfigFile(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadFile() error = %v, expect it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "minimax_model: file-model\nbot_name: file-bot\nwizard_timeout: 15m\npoll_interval: 3s\n")
+	t.Setenv("MINIMAX_MODEL", "env-model")
+	t.Setenv("BOT_NAME", "env-bot")
+	t.Setenv("REPLY_TIMEOUT", "")
+
+	cfg, cli, err := Load([]string{"--config", path, "--bot-name", "flag-bot", "--enable-inline-mode", "check"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cli.ConfigFile != path || len(cli.Args) != 1 || cli.Args[0] != "check" {
+		t.Errorf("Unexpected command line %+v", cli)
+	}
+	if cfg.WizardTimeout != 15*time.Minute {
+		t.Errorf("Expected WizardTimeout from file, got %v", cfg.WizardTimeout)
+	}
+	if cfg.MinimaxModel != "env-model" {
+		t.Errorf("Expected environment to override file, got %s", cfg.MinimaxModel)
+	}
+	if cfg.BotName != "flag-bot" {
+		t.Errorf("Expected flag to override environment, got %s", cfg.BotName)
+	}
+	if !cfg.EnableInlineMode {
+		t.Error("Expected EnableInlineMode from flag")
+	}
+	if cfg.ReplyTimeout != Default().ReplyTimeout {
+		t.Errorf("Expected empty REPLY_TIMEOUT to be ignored, got %v", cfg.ReplyTimeout)
+	}
+}
+
+func TestLoadInvalidEnv(t *testing.T) {
+	t.Setenv("MAX_MESSAGE_LENGTH", "lots")
+
+	if _, _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "MAX_MESSAGE_LENGTH") {
+		t.Errorf("Load() error = %v, expect invalid MAX_MESSAGE_LENGTH", err)
+	}
+
+	// LoadFromEnv keeps ignoring invalid values
+	if cfg := LoadFromEnv(); cfg.MaxMessageLength != Default().MaxMessageLength {
+		t.Errorf("Expected default MaxMessageLength, got %d", cfg.MaxMessageLength)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cfg := Default()
+	cfg.TelegramBotToken = "secret_token"
+	cfg.AdminUserIDs = []int64{42}
+
+	var sb strings.Builder
+	if err := cfg.Print(&sb); err != nil {
+		t.Fatalf("Print() error = %v", err)
+	}
+	out := sb.String()
+
+	if strings.Contains(out, "secret_token") {
+		t.Errorf("Expected token to be redacted:\n%s", out)
+	}
+	if !strings.Contains(out, "telegram_bot_token: '[REDACTED]'") || !strings.Contains(out, `minimax_api_key: ""`) {
+		t.Errorf("Expected set secrets redacted and empty ones shown as empty:\n%s", out)
+	}
+
+	// The output is a valid config file
+	loaded := Default()
+	if err := loaded.LoadFile(writeConfigFile(t, "printed.yaml", out)); err != nil {
+		t.Fatalf("LoadFile() of printed config error = %v", err)
+	}
+	if loaded.WizardTimeout != cfg.WizardTimeout || len(loaded.AdminUserIDs) != 1 {
+		t.Errorf("Printed config did not round-trip: %+v", loaded)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	valid := func() *Config {
+		cfg := Default()
+		cfg.TelegramBotToken = "123456:ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghij"
+		cfg.MinimaxAPIKey = "test_key"
+		return cfg
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(*Config)
+		errors   []string
+		warnings []string
+	}{
+		{"valid", func(c *Config) {}, nil, nil},
+		{"missing credentials", func(c *Config) { c.TelegramBotToken, c.MinimaxAPIKey = "", "" }, []string{"telegram_bot_token", "minimax_api_key"}, nil},
+		{"odd token", func(c *Config) { c.TelegramBotToken = "test_token" }, nil, []string{"telegram_bot_token"}},
+		{"malformed url", func(c *Config) { c.MinimaxBaseURL = "api.minimax.chat/v1" }, []string{"minimax_base_url"}, nil},
+		{"plain http", func(c *Config) { c.MinimaxBaseURL = "http://localhost:8080" }, nil, []string{"minimax_base_url"}},
+		{"unknown model", func(c *Config) { c.MinimaxModel = "gpt-4" }, nil, []string{"minimax_model"}},
+		{"negative durations", func(c *Config) { c.PollInterval, c.WizardTimeout = -time.Second, -time.Minute }, []string{"poll_interval", "wizard_timeout"}, nil},
+		{"reminder after timeout", func(c *Config) { c.WizardReminder = c.WizardTimeout }, nil, []string{"wizard_reminder"}},
+		{"message too long", func(c *Config) { c.MaxMessageLength = 5000 }, []string{"max_message_length"}, nil},
+		{"negative length", func(c *Config) { c.MaxMessageLength = -1 }, []string{"max_message_length"}, nil},
+		{"message too short", func(c *Config) { c.MaxMessageLength = 3 }, []string{"max_message_length"}, nil},
+		{"bad user ids", func(c *Config) { c.AdminUserIDs = []int64{1, 1, -5} }, []string{"admin_user_ids"}, []string{"admin_user_ids"}},
+		{"admin not allowed", func(c *Config) { c.AdminUserIDs, c.AllowedUsers = []int64{1}, []int64{2} }, nil, []string{"admin_user_ids"}},
+		{"long polling disabled", func(c *Config) { c.LongPolling = false }, nil, []string{"long_polling"}},
+		{"missing prompts dir", func(c *Config) { c.PromptsDir = filepath.Join(t.TempDir(), "missing") }, []string{"prompts_dir"}, nil},
+	}
+
+	keys := func(problems []Problem) []string {
+		var result []string
+		for _, p := range problems {
+			result = append(result, p.Key)
+		}
+		return result
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.modify(cfg)
+			before := *cfg
+
+			report := cfg.Check()
+			if got := keys(report.Errors()); strings.Join(got, ",") != strings.Join(tt.errors, ",") {
+				t.Errorf("Check() errors = %v, expect %v\n%s", got, tt.errors, report)
+			}
+			if got := keys(report.Warnings()); strings.Join(got, ",") != strings.Join(tt.warnings, ",") {
+				t.Errorf("Check() warnings = %v, expect %v\n%s", got, tt.warnings, report)
+			}
+			if (report.Err() != nil) != (len(tt.errors) > 0) {
+				t.Errorf("Check().Err() = %v, expect error %v", report.Err(), len(tt.errors) > 0)
+			}
+			if cfg.PollInterval != before.PollInterval || cfg.MaxMessageLength != before.MaxMessageLength {
+				t.Error("Check() changed the config")
+			}
+		})
+	}
+}
+
+func TestValidateAppliesDefaults(t *testing.T) {
+	cfg := &Config{
+		TelegramBotToken: "test_token",
+		MinimaxAPIKey:    "test_key",
+		MinimaxBaseURL:   "https://api.minimax.chat/v1",
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if cfg.ShutdownTimeout != Default().ShutdownTimeout {
+		t.Errorf("Expected an unset shutdown_timeout to default to %v, got %v", Default().ShutdownTimeout, cfg.ShutdownTimeout)
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	cfg := &Config{MinimaxBaseURL: "ftp://example.com", MaxMessageLength: 9000, ReplyTimeout: -time.Second}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() expected an error")
+	}
+	for _, key := range []string{"telegram_bot_token", "minimax_api_key", "minimax_base_url", "max_message_length", "reply_timeout"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Validate() error = %v, expect it to mention %s", err, key)
+		}
+	}
+	if cfg.ReplyTimeout != -time.Second {
+		t.Errorf("Validate() changed an invalid setting to %v", cfg.ReplyTimeout)
+	}
+}
+
+func TestParseIDs(t *testing.T) {
+	ids, malformed := parseIDs("1, 12a3, 3, x")
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Errorf("parseIDs() ids = %v, want [1 3]", ids)
+	}
+	if strings.Join(malformed, ",") != "12a3,x" {
+		t.Errorf("parseIDs() malformed = %v, want [12a3 x]", malformed)
+	}
+}
+
+func TestLoadReportsEverySource(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "wizard_timout: 5m\n")
+	t.Setenv("ADMIN_USER_IDS", "1,12a3")
+
+	cfg, _, err := Load([]string{"--config", path, "--poll-interval", "often"})
+	if err == nil {
+		t.Fatal("Load() expected an error")
+	}
+	for _, want := range []string{"wizard_timout", "ADMIN_USER_IDS", "--poll-interval"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Load() error = %v, expect it to mention %s", err, want)
+		}
+	}
+	if cfg == nil {
+		t.Fatal("Load() expected the partially loaded config")
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	base := func() *Config {
+		cfg := Default()
+		cfg.TelegramBotToken = "123456:ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghij"
+		cfg.MinimaxAPIKey = "test_key"
+		return cfg
+	}
+
+	next := base()
+	w := NewWatcher(base(), func() (*Config, error) {
+		c := *next
+		return &c, nil
+	})
+
+	var published []*Config
+	w.Subscribe(func(c *Config) { published = append(published, c) })
+
+	// Nothing changed
+	if changes, err := w.Reload(); err != nil || len(changes) != 0 {
+		t.Fatalf("Reload() = %v, %v, expect no changes", changes, err)
+	}
+
+	// Settings that can change at runtime are published
+	next.MinimaxModel = "abab6.5s-chat"
+	next.AllowedUsers = []int64{42}
+	changes, err := w.Reload()
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(changes) != 2 || changes[0].Key != "minimax_model" || changes[1].Key != "allowed_users" {
+		t.Errorf("Reload() changes = %v, expect minimax_model and allowed_users", changes)
+	}
+	if len(published) != 1 || w.Current().MinimaxModel != "abab6.5s-chat" {
+		t.Errorf("Expected the new configuration to be published, got %d publications", len(published))
+	}
+
+	// Settings that need a restart reject the whole reload
+	next.BotName = "renamed"
+	next.TelegramBotToken = "654321:ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghij"
+	if _, err := w.Reload(); err == nil || !strings.Contains(err.Error(), "telegram_bot_token") {
+		t.Errorf("Reload() error = %v, expect telegram_bot_token to require a restart", err)
+	}
+	if strings.Contains(fmt.Sprint(err), "654321") {
+		t.Error("Reload() error leaks the token")
+	}
+
+	// Invalid configurations are rejected
+	next = base()
+	next.MaxMessageLength = 10000
+	if _, err := w.Reload(); err == nil {
+		t.Error("Reload() expected an error for an invalid configuration")
+	}
+
+	if len(published) != 1 || w.Current().BotName != "" {
+		t.Errorf("Expected rejected reloads to keep the current configuration")
+	}
+}
+
+func TestDiffRedactsSecrets(t *testing.T) {
+	old, new := Default(), Default()
+	old.MinimaxAPIKey, new.MinimaxAPIKey = "old_key", "new_key"
+	new.WizardTimeout = 5 * time.Minute
+
+	changes := Diff(old, new)
+	if len(changes) != 2 {
+		t.Fatalf("Diff() = %v, expect 2 changes", changes)
+	}
+	if s := changes[0].String(); strings.Contains(s, "old_key") || strings.Contains(s, "new_key") || !changes[0].Restart {
+		t.Errorf("Diff()[0] = %s, expect a redacted restart-only change", s)
+	}
+	if s := changes[1].String(); s != "wizard_timeout: 10m0s -> 5m0s" || changes[1].Restart {
+		t.Errorf("Diff()[1] = %s, expect wizard_timeout: 10m0s -> 5m0s", s)
+	}
+}
+
+func TestDiffNilAndEmptyLists(t *testing.T) {
+	old, new := Default(), Default()
+	old.AllowedUsers, new.AllowedUsers = nil, []int64{}
+	old.AdminUserIDs, new.AdminUserIDs = []int64{}, nil
+
+	if changes := Diff(old, new); len(changes) != 0 {
+		t.Errorf("Diff() = %v, expect nil and empty lists to be equal", changes)
+	}
+}
+
+func TestSecretNeverPrints(t *testing.T) {
+	cfg := Default()
+	cfg.MinimaxAPIKey = "super_secret"
+
+	outputs := []string{
+		fmt.Sprintf("%v", cfg),
+		fmt.Sprintf("%+v", cfg),
+		fmt.Sprintf("%#v", *cfg),
+		fmt.Sprintf("%s %q %x", cfg.MinimaxAPIKey, cfg.MinimaxAPIKey, cfg.MinimaxAPIKey),
+		fmt.Sprint(cfg.MinimaxAPIKey),
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	outputs = append(outputs, string(data))
+
+	for _, out := range outputs {
+		if strings.Contains(out, "super_secret") {
+			t.Errorf("Secret leaked in %s", out)
+		}
+		if !strings.Contains(out, "[REDACTED]") {
+			t.Errorf("Expected [REDACTED] in %s", out)
+		}
+	}
+
+	if cfg.MinimaxAPIKey.Value() != "super_secret" {
+		t.Errorf("Value() = %q, want super_secret", cfg.MinimaxAPIKey.Value())
+	}
+	if Secret("").String() != "" {
+		t.Error("An empty secret should print as empty")
+	}
+}
+
+func TestSecretSources(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("file_token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("TELEGRAM_BOT_TOKEN_FILE", tokenFile)
+	t.Setenv("MINIMAX_API_KEY", "${vault:bot/minimax}")
+
+	vault := SecretProviderFunc(func(ref string) (string, error) {
+		return "vault:" + ref, nil
+	})
+	cfg, _, err := Load(nil, WithSecretProvider("vault", vault))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.TelegramBotToken.Value() != "file_token" {
+		t.Errorf("Expected token from TELEGRAM_BOT_TOKEN_FILE, got %q", cfg.TelegramBotToken.Value())
+	}
+	if cfg.MinimaxAPIKey.Value() != "vault:bot/minimax" {
+		t.Errorf("Expected key from the vault provider, got %q", cfg.MinimaxAPIKey.Value())
+	}
+}
+
+func TestSecretProviders(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte("file_key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OTHER_KEY", "env_key")
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{"literal_key", "literal_key", ""},
+		{"${file:" + keyFile + "}", "file_key", ""},
+		{"${env:OTHER_KEY}", "env_key", ""},
+		{"${exec:echo exec_key}", "exec_key", ""},
+		{"${env:MISSING_KEY}", "", "MISSING_KEY is not set"},
+		{"${vault:key}", "", `unknown secret provider "vault"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("MINIMAX_API_KEY", tt.value)
+			cfg, _, err := Load(nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Load() error = %v, expect %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.MinimaxAPIKey.Value() != tt.want {
+				t.Errorf("MinimaxAPIKey = %q, want %q", cfg.MinimaxAPIKey.Value(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretFileConflict(t *testing.T) {
+	t.Setenv("MINIMAX_API_KEY", "literal")
+	t.Setenv("MINIMAX_API_KEY_FILE", "/run/secrets/minimax")
+
+	if _, _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "both MINIMAX_API_KEY and MINIMAX_API_KEY_FILE") {
+		t.Errorf("Load() error = %v, expect a conflict", err)
+	}
+}
@@ -0,0 +1,440 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the environment variable that may point at a config
+// file when --config is not given.
+const ConfigFileEnv = "CONFIG_FILE"
+
+// redacted replaces secret values in printed configuration.
+const redacted = "[REDACTED]"
+
+// loader holds the options of a Load.
+type loader struct {
+	providers map[string]SecretProvider
+}
+
+// LoadOption configures Load.
+type LoadOption func(*loader)
+
+// WithSecretProvider makes secret references ${<name>:<ref>} resolve
+// through p, replacing any provider of the same name. The built-in
+// providers are file, env and exec.
+func WithSecretProvider(name string, p SecretProvider) LoadOption {
+	return func(l *loader) {
+		l.providers[name] = p
+	}
+}
+
+// CommandLine holds the command-line options that are not configuration
+// settings.
+type CommandLine struct {
+	// ConfigFile is the config file that was loaded, if any.
+	ConfigFile string
+	// PrintConfig asks for the effective configuration to be printed.
+	PrintConfig bool
+	// Args are the arguments left after the flags.
+	Args []string
+}
+
+// field describes one configuration setting.
+type field struct {
+	key     string
+	index   int
+	secret  bool
+	restart bool
+}
+
+// fields lists the settings of Config in declaration order, keyed by their
+// mapstructure tag.
+var fields = configFields()
+
+func configFields() []field {
+	t := reflect.TypeOf(Config{})
+	result := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag
+		key := tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		result = append(result, field{
+			key:     key,
+			index:   i,
+			secret:  t.Field(i).Type == reflect.TypeOf(Secret("")),
+			restart: tag.Get("reload") == "restart",
+		})
+	}
+	return result
+}
+
+// EnvName returns the environment variable for a setting, e.g.
+// TELEGRAM_BOT_TOKEN for telegram_bot_token.
+func EnvName(key string) string {
+	return strings.ToUpper(key)
+}
+
+// FlagName returns the command-line flag for a setting, e.g.
+// telegram-bot-token for telegram_bot_token.
+func FlagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// emptyEnv lists the settings an empty environment variable may set.
+// Other settings ignore empty variables.
+var emptyEnv = map[string]bool{
+	"data_dir": true,
+}
+
+// Load builds the configuration from, in increasing order of precedence,
+// the defaults, the config file, the environment and the command-line flags
+// in args. The config file is named by --config or CONFIG_FILE and may be
+// YAML, TOML or JSON. Every setting can be given in each source: the file
+// uses the mapstructure key, the environment its upper-case form and the
+// flags its dashed form. In the environment, <NAME>_FILE may name a file
+// holding the value instead, as used for container secrets. Secrets may
+// also be given in any source as a reference such as
+// ${file:/run/secrets/token}, ${env:VAR} or ${exec:pass show bot/token},
+// resolved by the secret providers.
+//
+// Invalid settings in every source are reported together. The returned
+// config then has all valid settings applied, so it can still be checked;
+// it is nil only if the command line itself could not be parsed.
+func Load(args []string, opts ...LoadOption) (*Config, CommandLine, error) {
+	var cli CommandLine
+
+	l := &loader{providers: defaultSecretProviders()}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	fs := flag.NewFlagSet(commandName(), flag.ContinueOnError)
+	fs.StringVar(&cli.ConfigFile, "config", os.Getenv(ConfigFileEnv), "path to a YAML, TOML or JSON config file")
+	fs.BoolVar(&cli.PrintConfig, "print-config", false, "print the effective configuration with secrets redacted and exit")
+
+	byFlag := make(map[string]field, len(fields))
+	t := reflect.TypeOf(Config{})
+	for _, f := range fields {
+		byFlag[FlagName(f.key)] = f
+		v := &flagValue{isBool: t.Field(f.index).Type.Kind() == reflect.Bool}
+		fs.Var(v, FlagName(f.key), fmt.Sprintf("%s (env %s)", usage[f.key], EnvName(f.key)))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, cli, err
+	}
+	cli.Args = fs.Args()
+
+	cfg := Default()
+	var errs []error
+
+	if cli.ConfigFile != "" {
+		if err := cfg.LoadFile(cli.ConfigFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		errs = append(errs, err)
+	}
+
+	fs.Visit(func(fl *flag.Flag) {
+		f, ok := byFlag[fl.Name]
+		if !ok {
+			return
+		}
+		if err := cfg.set(f, fl.Value.String()); err != nil {
+			errs = append(errs, fmt.Errorf("invalid flag --%s: %w", fl.Name, err))
+		}
+	})
+
+	if err := cfg.resolveSecrets(l.providers); err != nil {
+		errs = append(errs, err)
+	}
+	return cfg, cli, errors.Join(errs...)
+}
+
+// LoadFile applies the settings in a YAML (.yaml, .yml), TOML (.toml) or
+// JSON (.json) file. Nested sections are joined with underscores, so
+// minimax: {api_key: ...} sets minimax_api_key. Unknown keys are an error.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	raw := make(map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	default:
+		return fmt.Errorf("unsupported config file format %q, expected .yaml, .yml, .toml or .json", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	settings := make(map[string]interface{})
+	flatten("", raw, settings)
+
+	byKey := make(map[string]field, len(fields))
+	for _, f := range fields {
+		byKey[f.key] = f
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		f, ok := byKey[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown setting %q", key))
+			continue
+		}
+		if err := c.setAny(f, settings[key]); err != nil {
+			errs = append(errs, fmt.Errorf("invalid setting %q: %w", key, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv applies the settings found by lookup, returning every invalid
+// value. Valid values are applied even if others are invalid. A setting
+// may be read from the file named by <NAME>_FILE instead of <NAME>.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	for _, f := range fields {
+		name := EnvName(f.key)
+		value, ok := lookup(name)
+
+		if path, _ := lookup(name + "_FILE"); path != "" {
+			if ok && value != "" {
+				errs = append(errs, fmt.Errorf("both %s and %s_FILE are set", name, name))
+				continue
+			}
+			data, err := FileProvider{}.Resolve(path)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s_FILE: %w", name, err))
+				continue
+			}
+			value, ok = data, true
+		}
+
+		if !ok || (value == "" && !emptyEnv[f.key]) {
+			continue
+		}
+		if err := c.set(f, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Print writes the configuration as YAML, which can be used as a config
+// file. Secrets are redacted by their MarshalText.
+func (c *Config) Print(w io.Writer) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	v := reflect.ValueOf(c).Elem()
+	for _, f := range fields {
+		var value interface{} = v.Field(f.index).Interface()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+
+		var node yaml.Node
+		if err := node.Encode(value); err != nil {
+			return fmt.Errorf("failed to encode %s: %w", f.key, err)
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.key}, &node)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to print config: %w", err)
+	}
+	return enc.Close()
+}
+
+// set parses a setting from its string form, as given in the environment
+// or on the command line.
+func (c *Config) set(f field, s string) error {
+	v := reflect.ValueOf(c).Elem().Field(f.index)
+	switch v.Interface().(type) {
+	case time.Duration:
+		d, err := parseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case string, Secret:
+		v.SetString(s)
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetInt(int64(n))
+	case []int64:
+		ids, malformed := parseIDs(s)
+		if len(malformed) > 0 {
+			return fmt.Errorf("malformed IDs %s", strings.Join(malformed, ", "))
+		}
+		v.Set(reflect.ValueOf(ids))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// setAny sets a setting from a value decoded from a config file.
+func (c *Config) setAny(f field, value interface{}) error {
+	switch x := value.(type) {
+	case string:
+		return c.set(f, x)
+	case bool:
+		return c.set(f, strconv.FormatBool(x))
+	case int:
+		return c.set(f, strconv.Itoa(x))
+	case int64:
+		return c.set(f, strconv.FormatInt(x, 10))
+	case float64:
+		if x != float64(int64(x)) {
+			return fmt.Errorf("expected a whole number, got %v", x)
+		}
+		return c.set(f, strconv.FormatInt(int64(x), 10))
+	case []interface{}:
+		parts := make([]string, len(x))
+		for i, item := range x {
+			parts[i] = fmt.Sprint(item)
+		}
+		return c.set(f, strings.Join(parts, ","))
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+// flatten copies the values of nested maps into settings, joining keys
+// with underscores.
+func flatten(prefix string, raw map[string]interface{}, settings map[string]interface{}) {
+	for key, value := range raw {
+		key = strings.ReplaceAll(strings.ToLower(key), "-", "_")
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flatten(key, nested, settings)
+			continue
+		}
+		settings[key] = value
+	}
+}
+
+// parseDuration parses a Go duration such as "1m30s", or a whole number
+// of seconds.
+func parseDuration(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+func commandName() string {
+	if len(os.Args) == 0 {
+		return "telegram-bot"
+	}
+	return filepath.Base(os.Args[0])
+}
+
+// flagValue records the raw value of a configuration flag so it can be
+// applied after the config file and environment.
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (v *flagValue) String() string     { return v.value }
+func (v *flagValue) Set(s string) error { v.value = s; return nil }
+func (v *flagValue) IsBoolFlag() bool   { return v.isBool }
+
+// usage describes each setting in the --help output.
+var usage = map[string]string{
+	"telegram_bot_token":        "Telegram Bot API token",
+	"minimax_api_key":           "Minimax API key",
+	"minimax_base_url":          "Minimax API base URL",
+	"minimax_model":             "Minimax model to use",
+	"minimax_timeout":           "timeout for Minimax API calls",
+	"bot_name":                  "bot name",
+	"admin_user_ids":            "comma-separated admin user IDs",
+	"allowed_users":             "comma-separated user IDs allowed to use the bot (empty allows everyone)",
+	"enable_group_chat":         "respond in group chats",
+	"poll_interval":             "interval between polls for updates",
+	"long_polling":              "use long polling",
+	"max_message_length":        "maximum message length in characters",
+	"reply_timeout":             "timeout for replying to a message",
+	"inbox_size":                "number of chat messages of a user that may wait for a reply (0 is unlimited)",
+	"merge_messages":            "answer chat messages that arrived while busy in one turn",
+	"workers":                   "number of updates handled at the same time",
+	"update_queue_size":         "number of updates that may wait for a worker before polling pauses",
+	"shutdown_timeout":          "how long requests in progress may take to finish on shutdown",
+	"rate_limit":                "minimum time between two replies to a user's chat messages (0 disables)",
+	"wizard_timeout":            "how long a wizard may be inactive before it times out",
+	"wizard_reminder":           "how long before the timeout the user is reminded (0 disables)",
+	"max_regeneration_attempts": "how often a draft that misses its constraints is regenerated",
+	"data_dir":                  "directory for persistent state (empty disables persistence)",
+	"prompts_dir":               "directory of prompt template overrides",
+	"log_level":                 "minimum log level: debug, info, warn, error or fatal (debug also logs API calls)",
+	"log_format":                "log output format: text or json",
+	"log_component_levels":      "log levels of parts of the bot, e.g. minimax=debug,telegram=warn",
+	"log_redact_content":        "hide message text in logged API calls",
+	"log_file":                  "also write the log to this file (empty disables)",
+	"log_file_level":            "minimum level written to log_file (default log_level)",
+	"log_file_max_size":         "rotate log_file when it would grow beyond this many megabytes (0 disables)",
+	"log_file_rotate_interval":  "rotate log_file this long after it was opened (0 disables)",
+	"log_file_max_backups":      "number of rotated log files to keep (0 keeps all)",
+	"log_file_max_age":          "remove rotated log files older than this (0 keeps all)",
+	"http_addr":                 "address to serve metrics, health checks and the admin API on, e.g. :9090 (empty disables)",
+	"admin_token":               "bearer token for the admin API (empty disables it)",
+	"enable_markdown":           "format replies as Markdown",
+	"enable_commands":           "handle bot commands",
+	"enable_inline_mode":        "enable inline mode",
+}
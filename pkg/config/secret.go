@@ -0,0 +1,162 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Secret is a configuration value, such as an API key, that must never
+// appear in logs. It prints as [REDACTED] with every fmt verb, including
+// %+v and %#v of a struct holding it, and marshals as [REDACTED] too. Use
+// Value to get the actual value.
+type Secret string
+
+// Value returns the secret value.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String returns [REDACTED], or "" for an empty secret.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// Format writes the redacted form for every verb.
+func (s Secret) Format(f fmt.State, verb rune) {
+	if verb == 'q' {
+		io.WriteString(f, strconv.Quote(s.String()))
+		return
+	}
+	io.WriteString(f, s.String())
+}
+
+// MarshalText returns the redacted form, so encoders never see the value.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// SecretProvider resolves references to secrets kept outside the
+// configuration, such as in a file or a password manager.
+type SecretProvider interface {
+	Resolve(ref string) (string, error)
+}
+
+// SecretProviderFunc adapts a function to a SecretProvider.
+type SecretProviderFunc func(ref string) (string, error)
+
+// Resolve calls f(ref).
+func (f SecretProviderFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+// FileProvider reads a secret from the file at ref, such as a mounted
+// container secret. A trailing newline is dropped.
+type FileProvider struct{}
+
+// Resolve reads the file.
+func (FileProvider) Resolve(ref string) (string, error) {
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// EnvProvider reads a secret from the environment variable named ref.
+type EnvProvider struct{}
+
+// Resolve looks up the variable, which must be set and not empty.
+func (EnvProvider) Resolve(ref string) (string, error) {
+	value := os.Getenv(ref)
+	if value == "" {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return value, nil
+}
+
+// ExecProvider runs the command in ref and uses its output as the secret,
+// e.g. "pass show telegram/bot". The command is split on spaces and run
+// without a shell. A trailing newline is dropped.
+type ExecProvider struct {
+	// Timeout limits how long the command may run. Zero means 10 seconds.
+	Timeout time.Duration
+}
+
+// Resolve runs the command.
+func (p ExecProvider) Resolve(ref string) (string, error) {
+	args := strings.Fields(ref)
+	if len(args) == 0 {
+		return "", fmt.Errorf("no command given")
+	}
+
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// defaultSecretProviders are the providers available to every Load.
+func defaultSecretProviders() map[string]SecretProvider {
+	return map[string]SecretProvider{
+		"file": FileProvider{},
+		"env":  EnvProvider{},
+		"exec": ExecProvider{},
+	}
+}
+
+// secretRefPattern matches a reference such as ${file:/run/secrets/token}.
+var secretRefPattern = regexp.MustCompile(`^\$\{([a-z][a-z0-9_-]*):(.+)\}$`)
+
+// resolveSecrets replaces secret settings given as ${<provider>:<ref>}
+// with the value from that provider.
+func (c *Config) resolveSecrets(providers map[string]SecretProvider) error {
+	v := reflect.ValueOf(c).Elem()
+	var errs []error
+	for _, f := range fields {
+		if !f.secret {
+			continue
+		}
+		field := v.Field(f.index)
+		m := secretRefPattern.FindStringSubmatch(field.String())
+		if m == nil {
+			continue
+		}
+
+		provider, ok := providers[m[1]]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown secret provider %q", f.key, m[1]))
+			continue
+		}
+		value, err := provider.Resolve(m[2])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to resolve %s: %w", f.key, err))
+			continue
+		}
+		field.SetString(value)
+	}
+	return errors.Join(errs...)
+}
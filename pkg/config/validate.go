@@ -0,0 +1,355 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minimax-agent/telegram-bot/pkg/logger"
+)
+
+// TelegramMaxMessageLength is the longest text message Telegram accepts.
+const TelegramMaxMessageLength = 4096
+
+// MinMessageLength is the shortest max_message_length allowed, which leaves
+// room for some text before a truncated reply's "...".
+const MinMessageLength = 16
+
+// KnownModels lists the Minimax models the bot is known to work with.
+// Other models are allowed but reported as a warning.
+var KnownModels = []string{
+	"abab5.5-chat",
+	"abab5.5s-chat",
+	"abab6-chat",
+	"abab6.5-chat",
+	"abab6.5g-chat",
+	"abab6.5s-chat",
+	"abab6.5t-chat",
+	"abab7-chat-preview",
+	"MiniMax-Text-01",
+	"MiniMax-M1",
+}
+
+var botTokenPattern = regexp.MustCompile(`^\d+:[A-Za-z0-9_-]{30,}$`)
+
+// Severity tells whether a problem prevents the bot from starting.
+type Severity int
+
+const (
+	// SeverityWarning marks a setting that is allowed but likely a mistake.
+	SeverityWarning Severity = iota
+	// SeverityError marks a setting the bot cannot run with.
+	SeverityError
+)
+
+// String returns the string representation of the severity.
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Problem is one issue found in the configuration.
+type Problem struct {
+	Severity Severity
+	// Key is the setting the problem is about, e.g. "wizard_timeout".
+	Key     string
+	Message string
+}
+
+// String returns the problem as "<severity>: <key>: <message>".
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Severity, p.Key, p.Message)
+}
+
+// Report is the result of checking a configuration.
+type Report struct {
+	Problems []Problem
+}
+
+func (r *Report) errorf(key, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, Problem{Severity: SeverityError, Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *Report) warnf(key, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, Problem{Severity: SeverityWarning, Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+// Errors returns the problems that prevent the bot from starting.
+func (r *Report) Errors() []Problem {
+	return r.filter(SeverityError)
+}
+
+// Warnings returns the problems that are allowed but likely mistakes.
+func (r *Report) Warnings() []Problem {
+	return r.filter(SeverityWarning)
+}
+
+func (r *Report) filter(severity Severity) []Problem {
+	var problems []Problem
+	for _, p := range r.Problems {
+		if p.Severity == severity {
+			problems = append(problems, p)
+		}
+	}
+	return problems
+}
+
+// Err returns every error in the report joined into one, or nil if there
+// are none. Warnings are not included.
+func (r *Report) Err() error {
+	var errs []error
+	for _, p := range r.Errors() {
+		errs = append(errs, fmt.Errorf("%s: %s", p.Key, p.Message))
+	}
+	return errors.Join(errs...)
+}
+
+// String returns one problem per line, errors first.
+func (r *Report) String() string {
+	problems := append(r.Errors(), r.Warnings()...)
+	lines := make([]string, len(problems))
+	for i, p := range problems {
+		lines[i] = p.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Check reports every problem with the configuration without changing it.
+// Zero durations and lengths mean "use the default" and are not problems.
+func (c *Config) Check() *Report {
+	r := &Report{}
+
+	// Credentials
+	if c.TelegramBotToken == "" {
+		r.errorf("telegram_bot_token", "is required")
+	} else if !botTokenPattern.MatchString(c.TelegramBotToken.Value()) {
+		r.warnf("telegram_bot_token", "does not look like a bot token from @BotFather (<bot id>:<secret>)")
+	}
+	if c.MinimaxAPIKey == "" {
+		r.errorf("minimax_api_key", "is required")
+	}
+
+	// Minimax API
+	if c.MinimaxBaseURL == "" {
+		r.errorf("minimax_base_url", "is required")
+	} else if u, err := url.Parse(c.MinimaxBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		r.errorf("minimax_base_url", "%q is not an http or https URL", c.MinimaxBaseURL)
+	} else if u.Scheme == "http" {
+		r.warnf("minimax_base_url", "uses http, so the API key is sent unencrypted")
+	}
+	if c.MinimaxModel != "" && !isKnownModel(c.MinimaxModel) {
+		r.warnf("minimax_model", "unknown model %q, known models are: %s", c.MinimaxModel, strings.Join(KnownModels, ", "))
+	}
+
+	// Durations
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"minimax_timeout", c.MinimaxTimeout},
+		{"poll_interval", c.PollInterval},
+		{"reply_timeout", c.ReplyTimeout},
+		{"rate_limit", c.RateLimit},
+		{"shutdown_timeout", c.ShutdownTimeout},
+		{"wizard_timeout", c.WizardTimeout},
+		{"wizard_reminder", c.WizardReminder},
+		{"log_file_rotate_interval", c.LogFileRotateInterval},
+		{"log_file_max_age", c.LogFileMaxAge},
+	} {
+		if d.value < 0 {
+			r.errorf(d.key, "must not be negative, got %s", d.value)
+		}
+	}
+	if c.WizardReminder > 0 && c.WizardTimeout > 0 && c.WizardReminder >= c.WizardTimeout {
+		r.warnf("wizard_reminder", "%s is not shorter than wizard_timeout %s, so users are reminded as soon as they stop answering", c.WizardReminder, c.WizardTimeout)
+	}
+
+	// Limits
+	if c.MaxMessageLength < 0 {
+		r.errorf("max_message_length", "must not be negative, got %d", c.MaxMessageLength)
+	} else if c.MaxMessageLength > 0 && c.MaxMessageLength < MinMessageLength {
+		r.errorf("max_message_length", "must be at least %d, got %d", MinMessageLength, c.MaxMessageLength)
+	} else if c.MaxMessageLength > TelegramMaxMessageLength {
+		r.errorf("max_message_length", "%d exceeds Telegram's limit of %d characters", c.MaxMessageLength, TelegramMaxMessageLength)
+	}
+	if c.InboxSize < 0 {
+		r.errorf("inbox_size", "must not be negative, got %d", c.InboxSize)
+	}
+	if c.Workers < 0 {
+		r.errorf("workers", "must not be negative, got %d", c.Workers)
+	}
+	if c.UpdateQueueSize < 0 {
+		r.errorf("update_queue_size", "must not be negative, got %d", c.UpdateQueueSize)
+	}
+	if c.MaxRegenerationAttempts < 0 {
+		r.errorf("max_regeneration_attempts", "must not be negative, got %d", c.MaxRegenerationAttempts)
+	} else if c.MaxRegenerationAttempts > 5 {
+		r.warnf("max_regeneration_attempts", "%d attempts can make a single draft take many Minimax calls", c.MaxRegenerationAttempts)
+	}
+
+	// Users
+	checkIDs(r, "admin_user_ids", c.AdminUserIDs)
+	checkIDs(r, "allowed_users", c.AllowedUsers)
+	if len(c.AllowedUsers) > 0 {
+		allowed := make(map[int64]bool, len(c.AllowedUsers))
+		for _, id := range c.AllowedUsers {
+			allowed[id] = true
+		}
+		for _, id := range c.AdminUserIDs {
+			if !allowed[id] {
+				r.warnf("admin_user_ids", "admin %d is not in allowed_users and cannot use the bot", id)
+			}
+		}
+	}
+
+	// Conflicting settings
+	if !c.LongPolling {
+		r.warnf("long_polling", "is disabled, but webhooks are not supported, so long polling is used anyway")
+	}
+
+	// Directories
+	checkDir(r, "data_dir", c.DataDir)
+	checkDir(r, "prompts_dir", c.PromptsDir)
+	if c.PromptsDir != "" && c.DataDir != "" && filepath.Clean(c.PromptsDir) == filepath.Clean(c.DataDir) {
+		r.warnf("prompts_dir", "is the same directory as data_dir")
+	}
+	if c.PromptsDir != "" {
+		if _, err := os.Stat(c.PromptsDir); os.IsNotExist(err) {
+			r.errorf("prompts_dir", "%s does not exist", c.PromptsDir)
+		}
+	}
+
+	// HTTP server
+	if c.HTTPAddr != "" {
+		if _, port, err := net.SplitHostPort(c.HTTPAddr); err != nil {
+			r.errorf("http_addr", "%q is not a host:port address: %v", c.HTTPAddr, err)
+		} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+			r.errorf("http_addr", "%q has an invalid port", c.HTTPAddr)
+		}
+	}
+	if c.AdminToken != "" {
+		if c.HTTPAddr == "" {
+			r.warnf("admin_token", "is set, but the admin API is not served without http_addr")
+		}
+		if len(c.AdminToken.Value()) < 16 {
+			r.warnf("admin_token", "is shorter than 16 characters and easy to guess")
+		}
+	}
+
+	// Logging
+	if _, err := logger.ParseLevel(c.LogLevel); err != nil && c.LogLevel != "" {
+		r.errorf("log_level", "%q is not a log level, expected debug, info, warn, error or fatal", c.LogLevel)
+	}
+	if _, err := logger.ParseFormat(c.LogFormat); err != nil {
+		r.errorf("log_format", "%q is not a log format, expected text or json", c.LogFormat)
+	}
+	if _, err := logger.ParseComponentLevels(c.LogComponentLevels); err != nil {
+		r.errorf("log_component_levels", "%v", err)
+	}
+	if _, err := logger.ParseLevel(c.LogFileLevel); err != nil && c.LogFileLevel != "" {
+		r.errorf("log_file_level", "%q is not a log level, expected debug, info, warn, error or fatal", c.LogFileLevel)
+	}
+	if c.LogFileMaxSize < 0 {
+		r.errorf("log_file_max_size", "must not be negative, got %d", c.LogFileMaxSize)
+	}
+	if c.LogFileMaxBackups < 0 {
+		r.errorf("log_file_max_backups", "must not be negative, got %d", c.LogFileMaxBackups)
+	}
+	if c.LogFile != "" {
+		if info, err := os.Stat(c.LogFile); err == nil && info.IsDir() {
+			r.errorf("log_file", "%s is a directory", c.LogFile)
+		}
+	} else if c.LogFileLevel != "" {
+		r.warnf("log_file_level", "is set but log_file is not, so it has no effect")
+	}
+
+	return r
+}
+
+// Validate checks the configuration, returning every error at once, and
+// then fills in defaults for settings left at zero.
+func (c *Config) Validate() error {
+	if err := c.Check().Err(); err != nil {
+		return err
+	}
+	c.applyDefaults()
+	return nil
+}
+
+// applyDefaults replaces unset settings with their defaults. Settings
+// where zero has a meaning of its own, such as wizard_reminder, are kept.
+func (c *Config) applyDefaults() {
+	d := Default()
+	if c.MinimaxModel == "" {
+		c.MinimaxModel = d.MinimaxModel
+	}
+	if c.MinimaxTimeout == 0 {
+		c.MinimaxTimeout = d.MinimaxTimeout
+	}
+	if c.PollInterval == 0 {
+		c.PollInterval = d.PollInterval
+	}
+	if c.ReplyTimeout == 0 {
+		c.ReplyTimeout = d.ReplyTimeout
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = d.ShutdownTimeout
+	}
+	if c.WizardTimeout == 0 {
+		c.WizardTimeout = d.WizardTimeout
+	}
+	if c.MaxMessageLength == 0 {
+		c.MaxMessageLength = d.MaxMessageLength
+	}
+	if c.Workers == 0 {
+		c.Workers = d.Workers
+	}
+}
+
+func isKnownModel(model string) bool {
+	for _, known := range KnownModels {
+		if strings.EqualFold(model, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIDs reports invalid and duplicate Telegram user IDs.
+func checkIDs(r *Report, key string, ids []int64) {
+	seen := make(map[int64]bool, len(ids))
+	var duplicates []string
+	for _, id := range ids {
+		if id <= 0 {
+			r.errorf(key, "%d is not a valid user ID", id)
+		}
+		if seen[id] {
+			duplicates = append(duplicates, fmt.Sprint(id))
+		}
+		seen[id] = true
+	}
+	if len(duplicates) > 0 {
+		sort.Strings(duplicates)
+		r.warnf(key, "lists %s more than once", strings.Join(duplicates, ", "))
+	}
+}
+
+// checkDir reports a path that exists but is not a directory.
+func checkDir(r *Report, key, dir string) {
+	if dir == "" {
+		return
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		r.errorf(key, "%s is not a directory", dir)
+	}
+}
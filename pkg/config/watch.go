@@ -0,0 +1,233 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/minimax-agent/telegram-bot/pkg/logger"
+)
+
+// Watcher holds the current configuration and reloads it when the config
+// file changes or the process receives SIGHUP. A reloaded configuration is
+// published to subscribers only if it is valid and changes no setting that
+// needs a restart; otherwise it is rejected as a whole and the current one
+// stays in use.
+type Watcher struct {
+	load   func() (*Config, error)
+	file   string
+	logger *logger.Logger
+
+	// reloadMu serializes reloads so subscribers see them in order
+	reloadMu sync.Mutex
+	// modTime is the config file's modification time last seen by Run
+	modTime time.Time
+
+	mu          sync.RWMutex
+	current     *Config
+	subscribers []func(*Config)
+}
+
+// WatcherOption configures a Watcher.
+type WatcherOption func(*Watcher)
+
+// WithWatchFile sets the config file whose changes trigger a reload.
+func WithWatchFile(path string) WatcherOption {
+	return func(w *Watcher) {
+		w.file = path
+	}
+}
+
+// WithWatcherLogger sets the logger used to report reloads.
+func WithWatcherLogger(l *logger.Logger) WatcherOption {
+	return func(w *Watcher) {
+		w.logger = l
+	}
+}
+
+// NewWatcher creates a watcher publishing cfg, which should already be
+// validated. load builds a fresh configuration on reload, normally by
+// calling Load with the original command-line arguments.
+func NewWatcher(cfg *Config, load func() (*Config, error), opts ...WatcherOption) *Watcher {
+	w := &Watcher{
+		load:    load,
+		logger:  logger.Default(),
+		current: cfg,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.modTime = w.fileModTime()
+	return w
+}
+
+// Current returns the configuration in use. It must not be modified.
+func (w *Watcher) Current() *Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.current
+}
+
+// Subscribe registers fn to be called with every configuration published
+// after a reload. Subscribers are called in order of subscription, one
+// reload at a time.
+func (w *Watcher) Subscribe(fn func(*Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Reload loads and validates the configuration and publishes it if it
+// changed. It returns the changed settings.
+func (w *Watcher) Reload() ([]Change, error) {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+
+	next, err := w.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err := next.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	changes := Diff(w.Current(), next)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	var restart []string
+	for _, change := range changes {
+		if change.Restart {
+			restart = append(restart, change.Key)
+		}
+	}
+	if len(restart) > 0 {
+		return nil, fmt.Errorf("changing %s requires a restart", strings.Join(restart, ", "))
+	}
+
+	w.mu.Lock()
+	w.current = next
+	subscribers := append([]func(*Config){}, w.subscribers...)
+	w.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(next)
+	}
+	return changes, nil
+}
+
+// Run reloads the configuration when the config file changes, checked
+// every interval, or on SIGHUP, until ctx is done. Failed reloads are
+// logged and the current configuration stays in use.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			w.modTime = w.fileModTime()
+			w.reload("SIGHUP")
+		case <-ticker.C:
+			if w.file == "" {
+				continue
+			}
+			modTime := w.fileModTime()
+			if modTime.Equal(w.modTime) {
+				continue
+			}
+			w.modTime = modTime
+			w.reload(w.file + " changed")
+		}
+	}
+}
+
+func (w *Watcher) reload(reason string) {
+	changes, err := w.Reload()
+	switch {
+	case err != nil:
+		w.logger.Error("Rejected configuration reload (%s), keeping the current configuration: %v", reason, err)
+	case len(changes) == 0:
+		w.logger.Info("Reloaded configuration (%s), nothing changed", reason)
+	default:
+		descriptions := make([]string, len(changes))
+		for i, change := range changes {
+			descriptions[i] = change.String()
+		}
+		w.logger.Info("Reloaded configuration (%s): %s", reason, strings.Join(descriptions, "; "))
+	}
+}
+
+func (w *Watcher) fileModTime() time.Time {
+	if w.file == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(w.file)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Change is a setting that differs between two configurations.
+type Change struct {
+	Key      string
+	Old, New string
+	// Restart tells whether the change only takes effect on restart.
+	Restart bool
+}
+
+// String returns the change as "key: old -> new".
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Key, c.Old, c.New)
+}
+
+// Diff returns the settings that differ between old and new, in
+// declaration order. Secret values are redacted.
+func Diff(old, new *Config) []Change {
+	ov := reflect.ValueOf(old).Elem()
+	nv := reflect.ValueOf(new).Elem()
+
+	var changes []Change
+	for _, f := range fields {
+		a, b := ov.Field(f.index).Interface(), nv.Field(f.index).Interface()
+		if equalValues(ov.Field(f.index), nv.Field(f.index)) {
+			continue
+		}
+		change := Change{Key: f.key, Old: formatValue(a), New: formatValue(b), Restart: f.restart}
+		if f.secret {
+			change.Old, change.New = redacted, redacted
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// equalValues reports whether two settings are the same. Nil and empty
+// lists are, as loading produces either for an unset list.
+func equalValues(a, b reflect.Value) bool {
+	if a.Kind() == reflect.Slice && a.Len() == 0 && b.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprint(v)
+}
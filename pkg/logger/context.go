@@ -0,0 +1,34 @@
+package logger
+
+import "context"
+
+// CorrelationIDKey is the field name of the correlation ID in log entries.
+const CorrelationIDKey = "correlation_id"
+
+type correlationIDKey struct{}
+
+// ContextWithCorrelationID returns a copy of ctx carrying id, which ties
+// together the log entries of one request, such as a Telegram update and
+// the API calls made while handling it.
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, or "".
+func CorrelationID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// WithContext returns a child logger that adds the correlation ID carried
+// by ctx to every entry, or l itself if ctx carries none.
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	id := CorrelationID(ctx)
+	if id == "" {
+		return l
+	}
+	return l.With(CorrelationIDKey, id)
+}
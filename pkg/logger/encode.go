@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// encode returns the entry in format, ending with a newline.
+func encode(format Format, timestamp string, level Level, prefix, message string, fields []Field) []byte {
+	var buf bytes.Buffer
+	if format == JSONFormat {
+		encodeJSON(&buf, timestamp, level, prefix, message, fields)
+	} else {
+		encodeText(&buf, timestamp, level, prefix, message, fields)
+	}
+	return buf.Bytes()
+}
+
+// encodeText writes "[time] [LEVEL] prefix: message key=value ..." and a
+// newline.
+func encodeText(buf *bytes.Buffer, timestamp string, level Level, prefix, message string, fields []Field) {
+	fmt.Fprintf(buf, "[%s] [%s] ", timestamp, levelNames[level])
+	if prefix != "" {
+		buf.WriteString(prefix)
+		buf.WriteString(": ")
+	}
+	buf.WriteString(message)
+	for _, f := range fields {
+		buf.WriteByte(' ')
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		buf.WriteString(quoteText(textValue(f.Value)))
+	}
+	buf.WriteByte('\n')
+}
+
+// textValue formats a field value for the text format.
+func textValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "<nil>"
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		if err != nil {
+			return fmt.Sprintf("!ERROR:%v", err)
+		}
+		return string(text)
+	}
+	return fmt.Sprint(v)
+}
+
+// quoteText quotes values that would otherwise be ambiguous in a
+// key=value line.
+func quoteText(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// encodeJSON writes one JSON object with the entry and its fields and a
+// newline. Fields named like the entry keys are written after them; JSON
+// readers keep the last value.
+func encodeJSON(buf *bytes.Buffer, timestamp string, level Level, prefix, message string, fields []Field) {
+	buf.WriteString(`{"time":`)
+	writeJSON(buf, timestamp)
+	buf.WriteString(`,"level":`)
+	writeJSON(buf, levelNames[level])
+	if prefix != "" {
+		buf.WriteString(`,"logger":`)
+		writeJSON(buf, prefix)
+	}
+	buf.WriteString(`,"msg":`)
+	writeJSON(buf, message)
+	for _, f := range fields {
+		buf.WriteByte(',')
+		writeJSON(buf, f.Key)
+		buf.WriteByte(':')
+		writeJSON(buf, jsonValue(f.Value))
+	}
+	buf.WriteString("}\n")
+}
+
+// jsonValue converts values that encoding/json would encode unhelpfully,
+// such as errors as {} and durations as nanoseconds.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	}
+	return v
+}
+
+// writeJSON encodes v, falling back to its fmt form if it cannot be
+// marshaled.
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(data)
+}
@@ -0,0 +1,105 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// levels holds the base level and the component levels shared by a logger
+// and its children. Changes replace the whole table, so logging reads it
+// without taking a lock.
+type levels struct {
+	// mu serializes changes
+	mu    sync.Mutex
+	table atomic.Pointer[levelTable]
+}
+
+type levelTable struct {
+	base       Level
+	components map[string]Level
+}
+
+func newLevels(base Level) *levels {
+	ls := &levels{}
+	ls.table.Store(&levelTable{base: base})
+	return ls
+}
+
+func (ls *levels) load() *levelTable {
+	return ls.table.Load()
+}
+
+// update stores a modified copy of the current table.
+func (ls *levels) update(fn func(t *levelTable)) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	current := ls.table.Load()
+	next := &levelTable{base: current.base, components: make(map[string]Level, len(current.components))}
+	for name, level := range current.components {
+		next.components[name] = level
+	}
+	fn(next)
+	ls.table.Store(next)
+}
+
+func (ls *levels) setBase(level Level) {
+	ls.update(func(t *levelTable) { t.base = level })
+}
+
+func (ls *levels) setComponent(name string, level Level) {
+	ls.update(func(t *levelTable) { t.components[name] = level })
+}
+
+func (ls *levels) setComponents(components map[string]Level) {
+	ls.update(func(t *levelTable) {
+		t.components = make(map[string]Level, len(components))
+		for name, level := range components {
+			t.components[name] = level
+		}
+	})
+}
+
+// level returns the level for a logger with prefix: that of the whole
+// prefix, e.g. "bot/minimax", or else of its most specific name with a
+// component level, or else the base level.
+func (t *levelTable) level(prefix string) Level {
+	if len(t.components) == 0 || prefix == "" {
+		return t.base
+	}
+	if level, ok := t.components[prefix]; ok {
+		return level
+	}
+	names := strings.Split(prefix, "/")
+	for i := len(names) - 1; i >= 0; i-- {
+		if level, ok := t.components[names[i]]; ok {
+			return level
+		}
+	}
+	return t.base
+}
+
+// ParseComponentLevels parses component levels given as a comma-separated
+// list of name=level pairs, e.g. "minimax=debug,telegram=warn".
+func ParseComponentLevels(s string) (map[string]Level, error) {
+	components := make(map[string]Level)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid component level %q, expected name=level", pair)
+		}
+		level, err := ParseLevel(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %w", name, err)
+		}
+		components[name] = level
+	}
+	return components, nil
+}
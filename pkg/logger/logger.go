@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
@@ -34,20 +36,92 @@ var levelNames = map[Level]string{
 	FatalLevel: "FATAL",
 }
 
-// Logger provides structured logging capabilities.
+// String returns the level's name, e.g. "INFO".
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// ParseLevel parses a level name such as "debug" or "WARN". "warning" is
+// accepted for WarnLevel.
+func ParseLevel(s string) (Level, error) {
+	name := strings.ToUpper(s)
+	if name == "WARNING" {
+		return WarnLevel, nil
+	}
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %q, expected debug, info, warn, error or fatal", s)
+}
+
+// Format selects how log entries are encoded.
+type Format int
+
+const (
+	// TextFormat writes "[time] [LEVEL] prefix: message key=value" lines.
+	TextFormat Format = iota
+	// JSONFormat writes one JSON object per line.
+	JSONFormat
+)
+
+// ParseFormat parses "text" or "json".
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "text":
+		return TextFormat, nil
+	case "json":
+		return JSONFormat, nil
+	}
+	return TextFormat, fmt.Errorf("unknown log format %q, expected text or json", s)
+}
+
+// Logger provides structured logging capabilities. Messages are printf
+// style; key-value fields added with With are written with every entry.
+// Messages and fields pass through a Redactor before they are written.
+//
+// A logger and the children created from it share their levels: SetLevel
+// and SetComponentLevel may be called at any time, from any goroutine.
 type Logger struct {
 	mu         sync.Mutex
 	output     io.Writer
+	sinks      []Sink
 	prefix     string
-	level      Level
+	levels     *levels
 	flags      int
 	timeFormat string
+	format     Format
+	fields     []Field
+	handler    slog.Handler
+	redactor   *Redactor
+}
+
+// Sink is an additional destination for log entries with its own minimum
+// level and format, e.g. a JSON log file with debug entries next to text
+// output on stderr. A sink's level is independent of the logger's levels,
+// which only apply to the logger's own output. The writer must be safe for
+// concurrent use if children of the logger log concurrently.
+type Sink struct {
+	Output io.Writer
+	Level  Level
+	Format Format
+}
+
+// Field is a key-value pair attached to log entries.
+type Field struct {
+	Key   string
+	Value interface{}
 }
 
 // Option configures a Logger.
 type Option func(*Logger)
 
-// WithOutput sets the output writer for the logger.
+// WithOutput sets the output writer for the logger. A nil writer disables
+// it, so that entries are only written to sinks.
 func WithOutput(w io.Writer) Option {
 	return func(l *Logger) {
 		l.mu.Lock()
@@ -67,10 +141,25 @@ func WithPrefix(prefix string) Option {
 
 // WithLevel sets the minimum log level.
 func WithLevel(level Level) Option {
+	return func(l *Logger) {
+		l.levels.setBase(level)
+	}
+}
+
+// WithComponentLevels sets the minimum levels of named children, see
+// SetComponentLevels.
+func WithComponentLevels(components map[string]Level) Option {
+	return func(l *Logger) {
+		l.levels.setComponents(components)
+	}
+}
+
+// WithSink adds a sink the logger writes to in addition to its output.
+func WithSink(sink Sink) Option {
 	return func(l *Logger) {
 		l.mu.Lock()
 		defer l.mu.Unlock()
-		l.level = level
+		l.sinks = append(l.sinks, sink)
 	}
 }
 
@@ -83,13 +172,43 @@ func WithTimeFormat(format string) Option {
 	}
 }
 
+// WithFormat sets the output encoding.
+func WithFormat(format Format) Option {
+	return func(l *Logger) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.format = format
+	}
+}
+
+// WithSlogHandler sends entries to an slog.Handler instead of the output.
+// The prefix is passed as a "logger" attribute and fields as attributes.
+func WithSlogHandler(h slog.Handler) Option {
+	return func(l *Logger) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.handler = h
+	}
+}
+
+// WithRedactor sets the redactor applied to every entry. By default
+// NewRedactor() is used; nil disables redaction.
+func WithRedactor(r *Redactor) Option {
+	return func(l *Logger) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.redactor = r
+	}
+}
+
 // New creates a new Logger with the given options.
 func New(opts ...Option) *Logger {
 	logger := &Logger{
 		output:     os.Stderr,
-		level:      InfoLevel,
+		levels:     newLevels(InfoLevel),
 		flags:      log.LstdFlags,
 		timeFormat: time.RFC3339,
+		redactor:   NewRedactor(),
 	}
 
 	for _, opt := range opts {
@@ -109,22 +228,90 @@ func Default() *Logger {
 
 // log writes a log message at the specified level.
 func (l *Logger) log(level Level, format string, args ...interface{}) {
-	if level < l.level {
+	if !l.Enabled(level) {
 		return
 	}
+	l.write(time.Now(), level, fmt.Sprintf(format, args...), nil)
+}
 
+// write encodes one entry with the logger's fields followed by extra.
+func (l *Logger) write(t time.Time, level Level, message string, extra []Field) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	timestamp := time.Now().Format(l.timeFormat)
-	levelName := levelNames[level]
-	message := fmt.Sprintf(format, args...)
+	fields := l.fields
+	if len(extra) > 0 {
+		fields = append(append([]Field{}, l.fields...), extra...)
+	}
+	if l.redactor != nil {
+		message, fields = l.redactor.redact(message, fields)
+	}
+
+	logged := level >= l.Level()
+	if l.handler != nil {
+		if logged {
+			l.handle(t, level, message, fields)
+		}
+		return
+	}
+
+	timestamp := t.Format(l.timeFormat)
+	if l.output != nil && logged {
+		l.output.Write(encode(l.format, timestamp, level, l.prefix, message, fields))
+	}
+	for _, sink := range l.sinks {
+		if level >= sink.Level {
+			sink.Output.Write(encode(sink.Format, timestamp, level, l.prefix, message, fields))
+		}
+	}
+}
+
+// Level returns the minimum level of entries the logger writes to its
+// output: its component level if one applies, otherwise the base level.
+func (l *Logger) Level() Level {
+	return l.levels.load().level(l.prefix)
+}
+
+// Enabled reports whether the logger writes entries at level to its
+// output or to any of its sinks.
+func (l *Logger) Enabled(level Level) bool {
+	if level >= l.Level() {
+		return true
+	}
+	for _, sink := range l.sinks {
+		if level >= sink.Level {
+			return true
+		}
+	}
+	return false
+}
+
+// SetLevel sets the base level of the logger and all loggers sharing its
+// levels, i.e. its parent and children.
+func (l *Logger) SetLevel(level Level) {
+	l.levels.setBase(level)
+}
+
+// SetComponentLevel sets the minimum level of the named children called
+// name, e.g. "minimax" for log.Named("minimax") and its own children.
+func (l *Logger) SetComponentLevel(name string, level Level) {
+	l.levels.setComponent(name, level)
+}
 
-	if l.prefix != "" {
-		fmt.Fprintf(l.output, "[%s] [%s] %s: %s\n", timestamp, levelName, l.prefix, message)
-	} else {
-		fmt.Fprintf(l.output, "[%s] [%s] %s\n", timestamp, levelName, message)
+// ComponentLevels returns a copy of the component levels, see
+// SetComponentLevel.
+func (l *Logger) ComponentLevels() map[string]Level {
+	components := l.levels.load().components
+	copied := make(map[string]Level, len(components))
+	for name, level := range components {
+		copied[name] = level
 	}
+	return copied
+}
+
+// SetComponentLevels replaces all component levels, see SetComponentLevel.
+func (l *Logger) SetComponentLevels(components map[string]Level) {
+	l.levels.setComponents(components)
 }
 
 // Debug logs a message at debug level.
@@ -153,22 +340,80 @@ func (l *Logger) Fatal(format string, args ...interface{}) {
 	os.Exit(1)
 }
 
-// With creates a child logger with the given prefix.
-func (l *Logger) With(prefix string) *Logger {
+// With creates a child logger that adds key-value fields to every entry,
+// e.g. l.With("user_id", id, "chat_id", chatID). As in log/slog, a key
+// without a value is logged under !BADKEY.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	child := l.clone()
+	child.fields = append(child.fields, toFields(keyvals)...)
+	return child
+}
+
+// Named creates a child logger whose prefix is the parent's followed by
+// "/name", e.g. "bot/wizard". The name selects the child's component
+// level, see SetComponentLevel.
+func (l *Logger) Named(name string) *Logger {
+	child := l.clone()
+	if child.prefix != "" {
+		name = child.prefix + "/" + name
+	}
+	child.prefix = name
+	return child
+}
+
+// WithSecrets creates a child logger that also redacts the given values,
+// e.g. the credentials of a client.
+func (l *Logger) WithSecrets(values ...string) *Logger {
+	child := l.clone()
+	if child.redactor == nil {
+		child.redactor = NewRedactor()
+	}
+	child.redactor = child.redactor.With(RedactSecrets(values...))
+	return child
+}
+
+func (l *Logger) clone() *Logger {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	child := &Logger{
+	return &Logger{
 		output:     l.output,
-		prefix:     l.prefix + "/" + prefix,
-		level:      l.level,
+		sinks:      l.sinks,
+		prefix:     l.prefix,
+		levels:     l.levels,
 		flags:      l.flags,
 		timeFormat: l.timeFormat,
+		format:     l.format,
+		fields:     append([]Field{}, l.fields...),
+		handler:    l.handler,
+		redactor:   l.redactor,
 	}
+}
 
-	return child
+// toFields pairs up keys and values the way slog does.
+func toFields(keyvals []interface{}) []Field {
+	fields := make([]Field, 0, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i++ {
+		switch key := keyvals[i].(type) {
+		case string:
+			if i+1 == len(keyvals) {
+				fields = append(fields, Field{Key: badKey, Value: key})
+				continue
+			}
+			fields = append(fields, Field{Key: key, Value: keyvals[i+1]})
+			i++
+		case Field:
+			fields = append(fields, key)
+		default:
+			fields = append(fields, Field{Key: badKey, Value: key})
+		}
+	}
+	return fields
 }
 
+// badKey is the key of a value passed to With without a key.
+const badKey = "!BADKEY"
+
 // Package-level logger instance
 var defaultLogger = Default()
 
@@ -199,5 +444,5 @@ func Fatal(format string, args ...interface{}) {
 
 // SetLevel sets the minimum log level for the default logger.
 func SetLevel(level Level) {
-	defaultLogger.level = level
+	defaultLogger.SetLevel(level)
 }
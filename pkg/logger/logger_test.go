@@ -2,8 +2,17 @@ package logger
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestLoggerOptions(t *testing.T) {
@@ -149,3 +158,360 @@ func TestLoggerLevels(t *testing.T) {
 		t.Errorf("Expected FatalLevel to be 4, got %d", FatalLevel)
 	}
 }
+
+func TestLoggerFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := New(WithOutput(buf), WithPrefix("bot"))
+
+	l.With("user_id", 42).Named("wizard").With("step", "tone of voice").Info("answered %d", 3)
+
+	output := buf.String()
+	if !strings.Contains(output, `bot/wizard: answered 3 user_id=42 step="tone of voice"`) {
+		t.Errorf("Unexpected output %q", output)
+	}
+
+	buf.Reset()
+	l.Info("plain")
+	if strings.Contains(buf.String(), "user_id") {
+		t.Errorf("Fields should not leak into the parent, got %q", buf.String())
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := New(WithOutput(buf), WithPrefix("bot"), WithFormat(JSONFormat))
+
+	l.With("user_id", int64(42), "err", errors.New("boom"), "took", 1500*time.Millisecond).Warn("slow %s", "reply")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Output is not JSON: %v: %s", err, buf.String())
+	}
+	want := map[string]interface{}{
+		"level":   "WARN",
+		"logger":  "bot",
+		"msg":     "slow reply",
+		"user_id": float64(42),
+		"err":     "boom",
+		"took":    "1.5s",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %v", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["time"]; !ok {
+		t.Error("Entry should have a time")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if f, err := ParseFormat("JSON"); err != nil || f != JSONFormat {
+		t.Errorf("ParseFormat(JSON) = %v, %v", f, err)
+	}
+	if f, err := ParseFormat(""); err != nil || f != TextFormat {
+		t.Errorf("ParseFormat(\"\") = %v, %v", f, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat(xml) should fail")
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := New(WithOutput(buf), WithLevel(InfoLevel))
+	s := l.With("chat_id", 7).Slog()
+
+	s.Debug("hidden")
+	if buf.Len() != 0 {
+		t.Errorf("Debug should be filtered, got %q", buf.String())
+	}
+
+	s.WithGroup("request").Info("done", "id", "abc", slog.Group("usage", "tokens", 12))
+	output := buf.String()
+	if !strings.Contains(output, "[INFO] done chat_id=7 request.id=abc request.usage.tokens=12") {
+		t.Errorf("Unexpected output %q", output)
+	}
+}
+
+func TestWithSlogHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := New(WithPrefix("bot"), WithLevel(DebugLevel), WithSlogHandler(slog.NewJSONHandler(buf, nil)))
+
+	l.With("user_id", 42).Error("failed: %v", "timeout")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Output is not JSON: %v: %s", err, buf.String())
+	}
+	if entry["level"] != "ERROR" || entry["msg"] != "failed: timeout" || entry["logger"] != "bot" || entry["user_id"] != float64(42) {
+		t.Errorf("Unexpected entry %v", entry)
+	}
+
+	buf.Reset()
+	l.Debug("hidden")
+	if buf.Len() != 0 {
+		t.Errorf("The slog handler's level should apply, got %q", buf.String())
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	r := NewRedactor(RedactSecrets("sk-live-42"), RedactPatterns(regexp.MustCompile(`\+\d{11}`)))
+
+	tests := []struct {
+		name, in, want string
+	}{
+		{"bot token in URL", "POST https://api.telegram.org/bot123456789:AAE-abcdefghijklmnopqrstuvwxyz01234/getMe", "POST https://api.telegram.org/bot[REDACTED]/getMe"},
+		{"bearer", "Authorization: Bearer abc.def-123", "Authorization: Bearer [REDACTED]"},
+		{"json key", `{"api_key":"xyz","max_tokens":100}`, `{"api_key":"[REDACTED]","max_tokens":100}`},
+		{"query", "url?token=abc&chat=1", "url?token=[REDACTED]&chat=1"},
+		{"known secret", "key sk-live-42 rejected", "key [REDACTED] rejected"},
+		{"extra pattern", "call +49123456789 now", "call [REDACTED] now"},
+		{"content kept", `{"text":"hello"}`, `{"text":"hello"}`},
+	}
+	for _, tt := range tests {
+		if got := r.Redact(tt.in); got != tt.want {
+			t.Errorf("%s: Redact(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+
+	content := r.With(RedactContent(true))
+	in := `{"chat_id":1,"text":"my \"secret\" plans","messages":[{"role":"user","content":"hi"}]}`
+	want := `{"chat_id":1,"text":"[REDACTED]","messages":[{"role":"user","content":"[REDACTED]"}]}`
+	if got := content.Redact(in); got != want {
+		t.Errorf("Redact(%q) = %q, want %q", in, got, want)
+	}
+	if got := r.Redact(`{"text":"hello"}`); got != `{"text":"hello"}` {
+		t.Errorf("With should not change the original redactor, got %q", got)
+	}
+}
+
+func TestLoggerRedacts(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := New(WithOutput(buf)).WithSecrets("hunter2")
+
+	l.With("bot_token", "abc", "max_tokens", 100, "err", errors.New("login hunter2 failed")).Info("password is hunter2")
+
+	output := buf.String()
+	if strings.Contains(output, "hunter2") || strings.Contains(output, "abc") {
+		t.Errorf("Output leaks a secret: %q", output)
+	}
+	if !strings.Contains(output, "max_tokens=100") || !strings.Contains(output, `bot_token=[REDACTED]`) {
+		t.Errorf("Unexpected output %q", output)
+	}
+}
+
+func TestCorrelationID(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := New(WithOutput(buf))
+
+	if l.WithContext(context.Background()) != l {
+		t.Error("A context without a correlation ID should not create a child logger")
+	}
+
+	ctx := ContextWithCorrelationID(context.Background(), "update-7")
+	l.WithContext(ctx).Info("handled")
+	if !strings.Contains(buf.String(), "handled correlation_id=update-7") {
+		t.Errorf("Unexpected output %q", buf.String())
+	}
+
+	buf.Reset()
+	l.Slog().InfoContext(ctx, "via slog")
+	if !strings.Contains(buf.String(), "via slog correlation_id=update-7") {
+		t.Errorf("Unexpected output %q", buf.String())
+	}
+}
+
+func TestComponentLevels(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := New(WithOutput(buf), WithPrefix("bot"), WithComponentLevels(map[string]Level{"minimax": DebugLevel}))
+	minimax := l.Named("minimax")
+	stream := minimax.Named("stream").With("user_id", 1)
+	telegram := l.Named("telegram")
+
+	minimax.Debug("minimax debug")
+	stream.Debug("stream debug")
+	telegram.Debug("telegram debug")
+	l.Debug("root debug")
+
+	output := buf.String()
+	for _, want := range []string{"bot/minimax: minimax debug", "bot/minimax/stream: stream debug"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in output %q", want, output)
+		}
+	}
+	if strings.Contains(output, "telegram debug") || strings.Contains(output, "root debug") {
+		t.Errorf("Only minimax should log at debug level, got %q", output)
+	}
+
+	// Changes apply to existing children
+	buf.Reset()
+	l.SetComponentLevel("telegram", WarnLevel)
+	l.SetLevel(DebugLevel)
+	l.SetComponentLevels(map[string]Level{"minimax": ErrorLevel})
+	telegram.Info("telegram info")
+	minimax.Warn("minimax warn")
+	l.Debug("root debug")
+	output = buf.String()
+	if !strings.Contains(output, "telegram info") || !strings.Contains(output, "root debug") || strings.Contains(output, "minimax warn") {
+		t.Errorf("Unexpected output after level changes %q", output)
+	}
+}
+
+func TestParseComponentLevels(t *testing.T) {
+	levels, err := ParseComponentLevels(" minimax=debug, telegram=WARN,")
+	if err != nil {
+		t.Fatalf("ParseComponentLevels() error = %v", err)
+	}
+	if len(levels) != 2 || levels["minimax"] != DebugLevel || levels["telegram"] != WarnLevel {
+		t.Errorf("ParseComponentLevels() = %v", levels)
+	}
+
+	for _, in := range []string{"minimax", "=debug", "minimax=loud"} {
+		if _, err := ParseComponentLevels(in); err == nil {
+			t.Errorf("ParseComponentLevels(%q) should fail", in)
+		}
+	}
+}
+
+func TestSetLevelConcurrently(t *testing.T) {
+	l := New(WithOutput(&bytes.Buffer{}), WithLevel(ErrorLevel))
+	child := l.Named("child")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.SetLevel(Level(j % 4))
+				l.SetComponentLevel("child", Level(i))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				child.Enabled(InfoLevel)
+				l.Level()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSinks(t *testing.T) {
+	console := &bytes.Buffer{}
+	file := &bytes.Buffer{}
+	l := New(
+		WithOutput(console),
+		WithLevel(WarnLevel),
+		WithSink(Sink{Output: file, Level: DebugLevel, Format: JSONFormat}),
+	)
+
+	l.Debug("details")
+	l.Error("failure")
+
+	if strings.Contains(console.String(), "details") || !strings.Contains(console.String(), "[ERROR] failure") {
+		t.Errorf("Unexpected console output %q", console.String())
+	}
+	lines := strings.Split(strings.TrimSpace(file.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"msg":"details"`) || !strings.Contains(lines[1], `"msg":"failure"`) {
+		t.Errorf("Unexpected sink output %q", file.String())
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs", "bot.log")
+
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.Local)
+	f, err := NewRotatingFile(path, WithMaxFileSize(10), WithMaxBackups(2))
+	if err != nil {
+		t.Fatalf("NewRotatingFile() error = %v", err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+
+	for _, entry := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		now = now.Add(time.Second)
+		if _, err := f.Write([]byte(entry)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "fourth\n" {
+		t.Errorf("Current file = %q, want %q", data, "fourth\n")
+	}
+	backups, _ := filepath.Glob(filepath.Join(dir, "logs", "bot-*.log"))
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, got %v", backups)
+	}
+	if data, _ := os.ReadFile(backups[0]); string(data) != "second\n" {
+		t.Errorf("Oldest kept backup = %q, want %q", data, "second\n")
+	}
+}
+
+func TestRotatingFileRenameFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bot.log")
+
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.Local)
+	f, err := NewRotatingFile(path, WithMaxFileSize(10))
+	if err != nil {
+		t.Fatalf("NewRotatingFile() error = %v", err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+
+	// A non-empty directory in the way of the backup makes renaming fail
+	blocker := f.backupName(now)
+	if err := os.MkdirAll(filepath.Join(blocker, "x"), 0o755); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+
+	for _, entry := range []string{"first\n", "second\n"} {
+		if _, err := f.Write([]byte(entry)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first\nsecond\n" {
+		t.Errorf("Current file = %q, want both entries after a failed rotation", data)
+	}
+
+	if err := os.RemoveAll(blocker); err != nil {
+		t.Fatalf("RemoveAll() error = %v", err)
+	}
+	if _, err := f.Write([]byte("third\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "third\n" {
+		t.Errorf("Current file = %q, want rotation to work again", data)
+	}
+}
+
+func TestRotatingFileInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bot.log")
+
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)
+	f, err := NewRotatingFile(path, WithRotateInterval(24*time.Hour), WithMaxBackupAge(48*time.Hour))
+	if err != nil {
+		t.Fatalf("NewRotatingFile() error = %v", err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+	f.opened = now
+
+	for day := 0; day < 5; day++ {
+		f.Write([]byte("entry\n"))
+		now = now.Add(24 * time.Hour)
+	}
+
+	// Rotated on January 3rd to 6th; the backup of the 3rd is more than
+	// two days older than the last rotation and removed
+	backups, _ := filepath.Glob(filepath.Join(dir, "bot-*.log"))
+	if len(backups) != 3 || !strings.HasSuffix(backups[0], "bot-20240104T000000.000.log") {
+		t.Errorf("Expected the backups of January 4th to 6th, got %v", backups)
+	}
+}
@@ -0,0 +1,153 @@
+package logger
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secrets and redacted content in log output.
+const Redacted = "[REDACTED]"
+
+// Built-in patterns applied by every Redactor.
+var (
+	// botTokenPattern matches Telegram bot tokens, also inside API URLs
+	// such as https://api.telegram.org/bot<token>/getMe.
+	botTokenPattern = regexp.MustCompile(`\d{5,}:[A-Za-z0-9_-]{30,}`)
+	// bearerPattern matches the credentials of an Authorization header.
+	bearerPattern = regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+	// assignmentPattern matches credentials in JSON, query strings and
+	// key=value pairs, such as "api_key":"..." or password=....
+	assignmentPattern = regexp.MustCompile(`(?i)((?:api[_-]?key|access[_-]?token|token|secret|password)"?\s*[:=]\s*"?)[^\s"&,}]+`)
+	// contentPattern matches message content in JSON request and response
+	// bodies of the Telegram and Minimax APIs.
+	contentPattern = regexp.MustCompile(`("(?:text|content|caption)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+)
+
+// nonWord separates the words of a field name.
+var nonWord = regexp.MustCompile(`[^a-z0-9]+`)
+
+// sensitiveKeys are field names, or words in them such as the "token" of
+// "bot_token", whose values are always redacted.
+var sensitiveKeys = []string{"token", "secret", "password", "api_key", "apikey", "authorization"}
+
+// Redactor scrubs secrets from log messages and fields. It always removes
+// bot tokens, bearer credentials and credential assignments, and, if
+// configured, known secret values, extra patterns and message content.
+// A Redactor is immutable and safe for concurrent use.
+type Redactor struct {
+	secrets  []string
+	patterns []*regexp.Regexp
+	fields   []string
+	content  bool
+}
+
+// RedactorOption configures a Redactor.
+type RedactorOption func(*Redactor)
+
+// RedactSecrets adds exact values to redact, such as the configured API
+// keys. Empty values are ignored.
+func RedactSecrets(values ...string) RedactorOption {
+	return func(r *Redactor) {
+		for _, v := range values {
+			if v != "" {
+				r.secrets = append(r.secrets, v)
+			}
+		}
+	}
+}
+
+// RedactPatterns adds patterns whose matches are redacted.
+func RedactPatterns(patterns ...*regexp.Regexp) RedactorOption {
+	return func(r *Redactor) {
+		r.patterns = append(r.patterns, patterns...)
+	}
+}
+
+// RedactFields adds field names, or words in them, whose values are
+// redacted, in addition to names like "token" and "password".
+func RedactFields(names ...string) RedactorOption {
+	return func(r *Redactor) {
+		for _, name := range names {
+			r.fields = append(r.fields, strings.ToLower(name))
+		}
+	}
+}
+
+// RedactContent sets whether message content, the "text", "content" and
+// "caption" values of JSON bodies, is redacted.
+func RedactContent(redact bool) RedactorOption {
+	return func(r *Redactor) {
+		r.content = redact
+	}
+}
+
+// NewRedactor creates a Redactor with the built-in patterns and the given
+// options.
+func NewRedactor(opts ...RedactorOption) *Redactor {
+	r := &Redactor{fields: append([]string{}, sensitiveKeys...)}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// With returns a copy of r with more options applied.
+func (r *Redactor) With(opts ...RedactorOption) *Redactor {
+	c := &Redactor{
+		secrets:  append([]string{}, r.secrets...),
+		patterns: append([]*regexp.Regexp{}, r.patterns...),
+		fields:   append([]string{}, r.fields...),
+		content:  r.content,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Redact returns s with every secret replaced by [REDACTED].
+func (r *Redactor) Redact(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	s = botTokenPattern.ReplaceAllString(s, Redacted)
+	s = bearerPattern.ReplaceAllString(s, "${1}"+Redacted)
+	s = assignmentPattern.ReplaceAllString(s, "${1}"+Redacted)
+	if r.content {
+		s = contentPattern.ReplaceAllString(s, `${1}"`+Redacted+`"`)
+	}
+	for _, p := range r.patterns {
+		s = p.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+// RedactField returns the value to log for the field key. Values of
+// sensitive fields are replaced; strings and errors are scrubbed.
+func (r *Redactor) RedactField(key string, value interface{}) interface{} {
+	words := "_" + nonWord.ReplaceAllString(strings.ToLower(key), "_") + "_"
+	for _, name := range r.fields {
+		if strings.Contains(words, "_"+name+"_") {
+			return Redacted
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return r.Redact(v)
+	case []byte:
+		return r.Redact(string(v))
+	case error:
+		return r.Redact(v.Error())
+	}
+	return value
+}
+
+// redact applies r to a message and its fields.
+func (r *Redactor) redact(message string, fields []Field) (string, []Field) {
+	redacted := make([]Field, len(fields))
+	for i, f := range fields {
+		redacted[i] = Field{Key: f.Key, Value: r.RedactField(f.Key, f.Value)}
+	}
+	return r.Redact(message), redacted
+}
@@ -0,0 +1,135 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// LevelFatal is the slog level used for FatalLevel entries.
+const LevelFatal = slog.LevelError + 4
+
+// SlogLevel returns the slog level matching level.
+func SlogLevel(level Level) slog.Level {
+	switch level {
+	case DebugLevel:
+		return slog.LevelDebug
+	case InfoLevel:
+		return slog.LevelInfo
+	case WarnLevel:
+		return slog.LevelWarn
+	case ErrorLevel:
+		return slog.LevelError
+	}
+	return LevelFatal
+}
+
+// FromSlogLevel returns the level matching an slog level. Levels between
+// the standard ones round down.
+func FromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return DebugLevel
+	case level < slog.LevelWarn:
+		return InfoLevel
+	case level < slog.LevelError:
+		return WarnLevel
+	case level < LevelFatal:
+		return ErrorLevel
+	}
+	return FatalLevel
+}
+
+// handle forwards an entry to the slog handler set by WithSlogHandler.
+// l.mu must be held.
+func (l *Logger) handle(t time.Time, level Level, message string, fields []Field) {
+	ctx := context.Background()
+	slogLevel := SlogLevel(level)
+	if !l.handler.Enabled(ctx, slogLevel) {
+		return
+	}
+
+	r := slog.NewRecord(t, slogLevel, message, 0)
+	if l.prefix != "" {
+		r.AddAttrs(slog.String("logger", l.prefix))
+	}
+	for _, f := range fields {
+		r.AddAttrs(slog.Any(f.Key, f.Value))
+	}
+	l.handler.Handle(ctx, r)
+}
+
+// Handler returns an slog.Handler that writes through l, so code using
+// log/slog logs in the same format and at the same level as the rest of
+// the bot. Groups are written as dotted keys, e.g. "request.id".
+func (l *Logger) Handler() slog.Handler {
+	return &slogHandler{logger: l}
+}
+
+// Slog returns an slog.Logger that writes through l.
+func (l *Logger) Slog() *slog.Logger {
+	return slog.New(l.Handler())
+}
+
+type slogHandler struct {
+	logger *Logger
+	fields []Field
+	// group is the key prefix of the open groups, e.g. "request."
+	group string
+}
+
+// Enabled reports whether l logs entries at level.
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Enabled(FromSlogLevel(level))
+}
+
+// Handle writes the record with the handler's and the record's attributes
+// and the correlation ID carried by ctx.
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := append([]Field{}, h.fields...)
+	if id := CorrelationID(ctx); id != "" {
+		fields = append(fields, Field{Key: CorrelationIDKey, Value: id})
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, h.group, a)
+		return true
+	})
+	h.logger.write(r.Time, FromSlogLevel(r.Level), r.Message, fields)
+	return nil
+}
+
+// WithAttrs returns a handler that adds attrs to every record.
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := append([]Field{}, h.fields...)
+	for _, a := range attrs {
+		fields = appendAttr(fields, h.group, a)
+	}
+	return &slogHandler{logger: h.logger, fields: fields, group: h.group}
+}
+
+// WithGroup returns a handler that puts later attributes in group name.
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{logger: h.logger, fields: h.fields, group: h.group + name + "."}
+}
+
+// appendAttr appends a as a field, flattening groups into dotted keys.
+func appendAttr(fields []Field, group string, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		prefix := group
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+	return append(fields, Field{Key: group + a.Key, Value: a.Value.Any()})
+}
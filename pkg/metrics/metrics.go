@@ -0,0 +1,481 @@
+// Package metrics provides counters, gauges and histograms exposed in the
+// Prometheus text format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are the default histogram buckets, in seconds, suited to
+// request latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is a metric family that can write itself in the text format.
+type collector interface {
+	name() string
+	write(buf *bytes.Buffer)
+}
+
+// Registry holds metrics and writes them in the Prometheus text format.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// Default is the registry the package-level constructors register with.
+var Default = NewRegistry()
+
+// register adds c. Metric names are fixed at compile time, so a duplicate
+// is a programming error and panics.
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.collectors[c.name()]; ok {
+		panic(fmt.Sprintf("metrics: %s registered twice", c.name()))
+	}
+	r.collectors[c.name()] = c
+}
+
+// Unregister removes the metric called name, reporting whether it existed.
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.collectors[name]
+	delete(r.collectors, name)
+	return ok
+}
+
+// WriteText writes every metric in the Prometheus text format, sorted by
+// name.
+func (r *Registry) WriteText(buf *bytes.Buffer) {
+	r.mu.Lock()
+	collectors := make([]collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].name() < collectors[j].name()
+	})
+	for _, c := range collectors {
+		c.write(buf)
+	}
+}
+
+// Handler returns an HTTP handler serving the metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		var buf bytes.Buffer
+		r.WriteText(&buf)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+}
+
+// desc is the name, help text and label names of a metric family.
+type desc struct {
+	metricName string
+	help       string
+	typ        string
+	labels     []string
+}
+
+func (d *desc) name() string {
+	return d.metricName
+}
+
+func (d *desc) writeHeader(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", d.metricName, escapeHelp(d.help))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", d.metricName, d.typ)
+}
+
+// value is a float64 updated atomically.
+type value struct {
+	bits uint64
+}
+
+func (v *value) add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&v.bits)
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&v.bits, old, next) {
+			return
+		}
+	}
+}
+
+func (v *value) set(f float64) {
+	atomic.StoreUint64(&v.bits, math.Float64bits(f))
+}
+
+func (v *value) get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.bits))
+}
+
+// Counter is a value that only goes up, such as a number of requests.
+type Counter struct {
+	v value
+}
+
+// Inc adds one.
+func (c *Counter) Inc() {
+	c.v.add(1)
+}
+
+// Add adds delta, which must not be negative.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.add(delta)
+}
+
+// Value returns the current value.
+func (c *Counter) Value() float64 {
+	return c.v.get()
+}
+
+// Gauge is a value that goes up and down, such as a queue length.
+type Gauge struct {
+	v value
+}
+
+// Set sets the value.
+func (g *Gauge) Set(f float64) {
+	g.v.set(f)
+}
+
+// Inc adds one.
+func (g *Gauge) Inc() {
+	g.v.add(1)
+}
+
+// Dec subtracts one.
+func (g *Gauge) Dec() {
+	g.v.add(-1)
+}
+
+// Add adds delta, which may be negative.
+func (g *Gauge) Add(delta float64) {
+	g.v.add(delta)
+}
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 {
+	return g.v.get()
+}
+
+// Histogram counts observations, such as latencies, in buckets.
+type Histogram struct {
+	upperBounds []float64
+	// counts[i] counts observations in bucket i, not cumulatively; the
+	// last one is for observations above every bound
+	counts []uint64
+	sum    value
+	count  uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{upperBounds: buckets, counts: make([]uint64, len(buckets)+1)}
+}
+
+// Observe records v.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	atomic.AddUint64(&h.counts[i], 1)
+	h.sum.add(v)
+	atomic.AddUint64(&h.count, 1)
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+// Sum returns the sum of the observations.
+func (h *Histogram) Sum() float64 {
+	return h.sum.get()
+}
+
+func (h *Histogram) write(buf *bytes.Buffer, name string, labels string) {
+	var cumulative uint64
+	for i, bound := range h.upperBounds {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", name, joinLabels(labels, `le="`+formatFloat(bound)+`"`), cumulative)
+	}
+	cumulative += atomic.LoadUint64(&h.counts[len(h.upperBounds)])
+	fmt.Fprintf(buf, "%s_bucket%s %d\n", name, joinLabels(labels, `le="+Inf"`), cumulative)
+	fmt.Fprintf(buf, "%s_sum%s %s\n", name, braces(labels), formatFloat(h.sum.get()))
+	fmt.Fprintf(buf, "%s_count%s %d\n", name, braces(labels), cumulative)
+}
+
+// vec holds one metric per combination of label values.
+type vec[M any] struct {
+	desc
+	newMetric func() *M
+
+	mu      sync.RWMutex
+	metrics map[string]*M
+	values  map[string][]string
+}
+
+func newVec[M any](d desc, newMetric func() *M) *vec[M] {
+	return &vec[M]{desc: d, newMetric: newMetric, metrics: make(map[string]*M), values: make(map[string][]string)}
+}
+
+// with returns the metric for the label values, creating it on first use.
+func (v *vec[M]) with(values []string) *M {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", v.metricName, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	m, ok := v.metrics[key]
+	v.mu.RUnlock()
+	if ok {
+		return m
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if m, ok := v.metrics[key]; ok {
+		return m
+	}
+	m = v.newMetric()
+	v.metrics[key] = m
+	v.values[key] = append([]string{}, values...)
+	return m
+}
+
+// each calls fn with the formatted labels and metric of every label
+// combination, sorted by labels.
+func (v *vec[M]) each(fn func(labels string, m *M)) {
+	v.mu.RLock()
+	type entry struct {
+		labels string
+		metric *M
+	}
+	entries := make([]entry, 0, len(v.metrics))
+	for key, m := range v.metrics {
+		entries = append(entries, entry{formatLabels(v.labels, v.values[key]), m})
+	}
+	v.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].labels < entries[j].labels
+	})
+	for _, e := range entries {
+		fn(e.labels, e.metric)
+	}
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	*vec[Counter]
+}
+
+// With returns the counter for the label values, in the order of the
+// label names.
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.with(values)
+}
+
+func (c *CounterVec) write(buf *bytes.Buffer) {
+	c.writeHeader(buf)
+	c.each(func(labels string, m *Counter) {
+		fmt.Fprintf(buf, "%s%s %s\n", c.metricName, braces(labels), formatFloat(m.Value()))
+	})
+}
+
+// GaugeVec is a gauge partitioned by labels.
+type GaugeVec struct {
+	*vec[Gauge]
+}
+
+// With returns the gauge for the label values, in the order of the label
+// names.
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return g.with(values)
+}
+
+func (g *GaugeVec) write(buf *bytes.Buffer) {
+	g.writeHeader(buf)
+	g.each(func(labels string, m *Gauge) {
+		fmt.Fprintf(buf, "%s%s %s\n", g.metricName, braces(labels), formatFloat(m.Value()))
+	})
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	*vec[Histogram]
+}
+
+// With returns the histogram for the label values, in the order of the
+// label names.
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.with(values)
+}
+
+func (h *HistogramVec) write(buf *bytes.Buffer) {
+	h.writeHeader(buf)
+	h.each(func(labels string, m *Histogram) {
+		m.write(buf, h.metricName, labels)
+	})
+}
+
+// gaugeFunc is a gauge whose value is computed when it is collected.
+type gaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+func (g *gaugeFunc) write(buf *bytes.Buffer) {
+	g.writeHeader(buf)
+	fmt.Fprintf(buf, "%s %s\n", g.metricName, formatFloat(g.fn()))
+}
+
+// NewCounter registers a counter without labels.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).With()
+}
+
+// NewCounterVec registers a counter with the given label names.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(desc{name, help, "counter", labels}, func() *Counter { return &Counter{} })}
+	r.register(c)
+	return c
+}
+
+// NewGauge registers a gauge without labels.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.NewGaugeVec(name, help).With()
+}
+
+// NewGaugeVec registers a gauge with the given label names.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(desc{name, help, "gauge", labels}, func() *Gauge { return &Gauge{} })}
+	r.register(g)
+	return g
+}
+
+// NewGaugeFunc registers a gauge whose value is fn's result at the time
+// the metrics are collected.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&gaugeFunc{desc{name, help, "gauge", nil}, fn})
+}
+
+// NewHistogram registers a histogram without labels. Nil buckets mean
+// DefBuckets.
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	return r.NewHistogramVec(name, help, buckets).With()
+}
+
+// NewHistogramVec registers a histogram with the given label names. Nil
+// buckets mean DefBuckets.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{newVec(desc{name, help, "histogram", labels}, func() *Histogram { return newHistogram(buckets) })}
+	r.register(h)
+	return h
+}
+
+// NewCounter registers a counter with the default registry.
+func NewCounter(name, help string) *Counter {
+	return Default.NewCounter(name, help)
+}
+
+// NewCounterVec registers a labeled counter with the default registry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// NewGauge registers a gauge with the default registry.
+func NewGauge(name, help string) *Gauge {
+	return Default.NewGauge(name, help)
+}
+
+// NewGaugeVec registers a labeled gauge with the default registry.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labels...)
+}
+
+// NewGaugeFunc registers a computed gauge with the default registry.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.NewGaugeFunc(name, help, fn)
+}
+
+// NewHistogram registers a histogram with the default registry.
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return Default.NewHistogram(name, help, buckets)
+}
+
+// NewHistogramVec registers a labeled histogram with the default registry.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return "{" + extra + "}"
+	}
+	return "{" + labels + "," + extra + "}"
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Requests by method.", "method", "code")
+	requests.With("GET", "200").Inc()
+	requests.With("GET", "200").Add(2)
+	requests.With("POST", `5"0\0`).Inc()
+	r.NewGauge("queue_length", "Queued items.\nSecond line.").Set(-1.5)
+	r.NewGaugeFunc("active", "Active users.", func() float64 { return 7 })
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{1, 0.1})
+	latency.Observe(0.05)
+	latency.Observe(0.1)
+	latency.Observe(3)
+
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+
+	want := `# HELP active Active users.
+# TYPE active gauge
+active 7
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.15
+latency_seconds_count 3
+# HELP queue_length Queued items.\nSecond line.
+# TYPE queue_length gauge
+queue_length -1.5
+# HELP requests_total Requests by method.
+# TYPE requests_total counter
+requests_total{method="GET",code="200"} 3
+requests_total{method="POST",code="5\"0\\0"} 1
+`
+	if buf.String() != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("duration_seconds", "Durations.", []float64{1}, "outcome")
+	h.With("error").Observe(2)
+
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+	for _, want := range []string{
+		`duration_seconds_bucket{outcome="error",le="1"} 0`,
+		`duration_seconds_bucket{outcome="error",le="+Inf"} 1`,
+		`duration_seconds_sum{outcome="error"} 2`,
+		`duration_seconds_count{outcome="error"} 1`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %q in\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("events_total", "Events.")
+	defer func() {
+		if recover() == nil {
+			t.Error("Registering a name twice should panic")
+		}
+	}()
+	r.NewGauge("events_total", "Events.")
+}
+
+func TestUnregister(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("events_total", "Events.")
+	if !r.Unregister("events_total") || r.Unregister("events_total") {
+		t.Error("Unregister should report whether the metric existed")
+	}
+	r.NewCounter("events_total", "Events.")
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("events_total", "Events.", "kind")
+	h := r.NewHistogram("sizes", "Sizes.", nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.With("a").Inc()
+				h.Observe(0.2)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := c.With("a").Value(); got != 8000 {
+		t.Errorf("Counter = %v, want 8000", got)
+	}
+	if h.Count() != 8000 {
+		t.Errorf("Histogram count = %d, want 8000", h.Count())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("events_total", "Events.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	if !strings.Contains(string(body), "events_total 1\n") {
+		t.Errorf("Unexpected body %q", body)
+	}
+}